@@ -0,0 +1,260 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// requireAdmin пропускает к h только администраторов (см. isAdmin),
+// остальным отвечает 403. Его ставят внутри protect, который уже
+// положил пользователя в контекст.
+func requireAdmin(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isAdmin(userFromContext(r.Context())) {
+			errorHandler(w, r, http.StatusForbidden, "Administrator access required")
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// requireEditor пропускает только пользователей, которые могут менять
+// страницы (isEditor). Как и requireAdmin, ставится после protect.
+func requireEditor(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isEditor(userFromContext(r.Context())) {
+			errorHandler(w, r, http.StatusForbidden, "Your account may not edit pages")
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// archiveMeta - запись meta/{title}.json полного архива: метаданные
+// страницы и время ее изменения на момент выгрузки.
+type archiveMeta struct {
+	PageMeta
+	Modified time.Time `json:"modified"`
+}
+
+// adminExportHandler отдает полный архив вики: тексты страниц
+// в pages/{title}.txt и метаданные в meta/{title}.json. Как и /export,
+// архив пишется прямо в ответ.
+func adminExportHandler(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	titles, err := store.List()
+	if err != nil {
+		errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition",
+		fmt.Sprintf(`attachment; filename="wiki-export-%s.zip"`, time.Now().Format("20060102")))
+	zw := zip.NewWriter(w)
+	for _, t := range titles {
+		if err := writeArchivePage(zw, t); err != nil {
+			slog.Error("ошибка экспорта", "title", t, "err", err)
+			return
+		}
+	}
+	if err := zw.Close(); err != nil {
+		slog.Error("ошибка экспорта", "err", err)
+	}
+}
+
+func writeArchivePage(zw *zip.Writer, title string) error {
+	p, err := store.Load(title)
+	if err != nil {
+		return err
+	}
+	meta, err := metas.Load(title)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(archiveMeta{PageMeta: *meta, Modified: p.Modified})
+	if err != nil {
+		return err
+	}
+	for name, content := range map[string][]byte{"pages/" + title + ".txt": p.Body, "meta/" + title + ".json": data} {
+		f, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: p.Modified})
+		if err != nil {
+			return err
+		}
+		if _, err := f.Write(content); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// archivePage - страница полного архива вместе с метаданными.
+type archivePage struct {
+	title string
+	body  []byte
+	meta  *archiveMeta
+}
+
+// readArchiveEntry читает запись архива не длиннее limit байт.
+func readArchiveEntry(f *zip.File, limit int64) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	data, err := ioutil.ReadAll(io.LimitReader(rc, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, errPageTooLarge
+	}
+	return data, nil
+}
+
+// readFullArchive проверяет и читает архив формата /admin/export.
+// Любая запись, кроме pages/{title}.txt и meta/{title}.json
+// с допустимым заголовком, отклоняет весь архив.
+func readFullArchive(zr *zip.Reader) ([]*archivePage, error) {
+	if len(zr.File) > maxImportEntries {
+		return nil, errArchiveTooLarge
+	}
+	var budget archiveBudget
+	byTitle := make(map[string]*archivePage)
+	var pages []*archivePage
+	get := func(title string) *archivePage {
+		if p, ok := byTitle[title]; ok {
+			return p
+		}
+		p := &archivePage{title: title}
+		byTitle[title] = p
+		pages = append(pages, p)
+		return p
+	}
+	for _, f := range zr.File {
+		if strings.HasSuffix(f.Name, "/") {
+			continue
+		}
+		var dir, name, ext string
+		if i := strings.IndexByte(f.Name, '/'); i >= 0 {
+			dir, name = f.Name[:i], f.Name[i+1:]
+		}
+		switch dir {
+		case "pages":
+			ext = ".txt"
+		case "meta":
+			ext = ".json"
+		}
+		title := normalizeTitle(strings.TrimSuffix(name, ext))
+		if ext == "" || !strings.HasSuffix(name, ext) || validateTitle(title) != nil {
+			return nil, fmt.Errorf("%q: only pages/Title.txt and meta/Title.json entries are allowed", f.Name)
+		}
+		data, err := readArchiveEntry(f, maxPageSize)
+		if err != nil {
+			return nil, fmt.Errorf("%q: %v", f.Name, err)
+		}
+		if err := budget.add(data); err != nil {
+			return nil, err
+		}
+		p := get(title)
+		if dir == "pages" {
+			p.body = data
+			continue
+		}
+		p.meta = &archiveMeta{PageMeta: PageMeta{Public: true}}
+		if err := json.Unmarshal(data, p.meta); err != nil {
+			return nil, fmt.Errorf("%q: %v", f.Name, err)
+		}
+	}
+	for _, p := range pages {
+		if p.body == nil {
+			return nil, fmt.Errorf("%q: metadata without page text", "meta/"+p.title+".json")
+		}
+	}
+	return pages, nil
+}
+
+// adminImportHandler восстанавливает страницы из архива формата
+// /admin/export (POST, поле file). Страница, которая в вики изменена
+// тогда же или позже, чем записано в ее метаданных в архиве, не
+// перезаписывается и попадает в список skipped; без метаданных
+// в архиве перезаписываются только отсутствующие страницы.
+func adminImportHandler(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodPost) {
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportSize)
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeJSONError(w, http.StatusRequestEntityTooLarge, "archive is larger than the allowed size")
+			return
+		}
+		writeJSONError(w, http.StatusBadRequest, "no archive uploaded")
+		return
+	}
+	defer file.Close()
+	zr, err := zip.NewReader(file, header.Size)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "not a zip archive")
+		return
+	}
+	pages, err := readFullArchive(zr)
+	if err == errArchiveTooLarge {
+		writeJSONError(w, http.StatusRequestEntityTooLarge, err.Error())
+		return
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "rejected archive entry "+err.Error())
+		return
+	}
+	imported, skipped := 0, []string{}
+	for _, ap := range pages {
+		action := auditCreate
+		old, err := store.Load(ap.title)
+		if err == nil {
+			action = auditEdit
+			if ap.meta == nil || !old.Modified.Before(ap.meta.Modified) {
+				skipped = append(skipped, ap.title)
+				continue
+			}
+		} else if !errors.Is(err, os.ErrNotExist) {
+			serverError(w, err)
+			return
+		}
+		// Страницу, открытую в форме редактирования, восстановление
+		// из копии не затирает.
+		if checkEditLock(ap.title, "", time.Now()) != nil {
+			skipped = append(skipped, ap.title)
+			continue
+		}
+		if err := store.Save(&Page{Title: ap.title, Body: ap.body}); err != nil {
+			serverError(w, err)
+			return
+		}
+		if ap.meta != nil {
+			if err := metas.Update(ap.title, func(m *PageMeta) { *m = ap.meta.PageMeta }); err != nil {
+				serverError(w, err)
+				return
+			}
+		}
+		if _, err := slugs.Assign(ap.title); err != nil {
+			serverError(w, err)
+			return
+		}
+		audit(r, action, ap.title)
+		imported++
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"imported": imported, "skipped": skipped})
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// Архив /admin/export загружается обратно через /admin/import
+// вместе с метаданными, не затирая страницы новее копии.
+func TestAdminExportImportRoundTrip(t *testing.T) {
+	testDataDir(t)
+	savePage(t, "Foo", "foo")
+	savePage(t, "Secret", "secret")
+	savePage(t, "Newer", "archived")
+	savePage(t, "Older", "archived")
+	if err := metas.Update("Foo", func(m *PageMeta) { m.Tags = []string{"go"} }); err != nil {
+		t.Fatal(err)
+	}
+	if err := metas.Update("Secret", func(m *PageMeta) { m.Public = false }); err != nil {
+		t.Fatal(err)
+	}
+
+	w := serve(adminExportHandler, http.MethodGet, "/admin/export", "")
+	if want := `attachment; filename="wiki-export-` + time.Now().Format("20060102") + `.zip"`; w.Header().Get("Content-Disposition") != want {
+		t.Errorf("Content-Disposition = %q, want %q", w.Header().Get("Content-Disposition"), want)
+	}
+	archive := w.Body.Bytes()
+	files := unzipResponse(t, archive)
+	for _, name := range []string{"pages/Foo.txt", "meta/Foo.json", "pages/Secret.txt", "meta/Secret.json"} {
+		if _, ok := files[name]; !ok {
+			t.Errorf("archive has no %s: %v", name, files)
+		}
+	}
+
+	// Новая пустая вики, где Newer изменена после выгрузки,
+	// а Older - задолго до нее.
+	dir := testDataDir(t)
+	savePage(t, "Newer", "local")
+	savePage(t, "Older", "local")
+	old := time.Now().Add(-24 * time.Hour)
+	if err := os.Chtimes(filepath.Join(dir, "Older.txt"), old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	f, err := mw.CreateFormFile("file", "wiki-export.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write(archive)
+	mw.Close()
+	r := httptest.NewRequest(http.MethodPost, "/admin/import", &body)
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+	w = httptest.NewRecorder()
+	adminImportHandler(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("import status = %d: %s", w.Code, w.Body)
+	}
+	var result struct {
+		Imported int
+		Skipped  []string
+	}
+	if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Imported != 3 || !reflect.DeepEqual(result.Skipped, []string{"Newer"}) {
+		t.Errorf("import result = %+v, want 3 imported and Newer skipped", result)
+	}
+
+	for title, want := range map[string]string{"Foo": "foo", "Secret": "secret", "Newer": "local", "Older": "archived"} {
+		if p, err := store.Load(title); err != nil || string(p.Body) != want {
+			t.Errorf("page %s = %v, %v; want body %q", title, p, err, want)
+		}
+	}
+	if m, err := metas.Load("Foo"); err != nil || !reflect.DeepEqual(m.Tags, []string{"go"}) {
+		t.Errorf("Foo meta = %+v, %v; want tags [go]", m, err)
+	}
+	if m, err := metas.Load("Secret"); err != nil || m.Public {
+		t.Errorf("Secret meta = %+v, %v; want it private", m, err)
+	}
+}
@@ -0,0 +1,456 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// API страниц доступен по /api/v1/pages/; старый путь /api/pages/
+// оставлен для совместимости.
+var apiPagePath = regexp.MustCompile(`^/api(?:/v1)?/pages/(` + titleChars + `)$`)
+var apiRenamePath = regexp.MustCompile(`^/api/v1/pages/(` + titleChars + `)/rename$`)
+var apiClonePath = regexp.MustCompile(`^/api/v1/pages/(` + titleChars + `)/clone$`)
+var apiRestorePath = regexp.MustCompile(`^/api/v1/trash/(` + titleChars + `)/restore$`)
+
+// apiTitlePath выделяет заголовок из любого пути API страниц,
+// чтобы проверить его до разбора остальной части пути.
+var apiTitlePath = regexp.MustCompile("^/api(?:/v1)?/pages/([^/]*)")
+
+// pageJSON - представление Page в JSON API: тело передается
+// строкой, а не base64, как было бы для []byte.
+// Время создания и изменения только выдается: при записи его
+// выставляет хранилище.
+type pageJSON struct {
+	Title     string     `json:"title"`
+	Slug      string     `json:"slug,omitempty"`
+	Body      string     `json:"body"`
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+	// Meta записывается в текст блоком "---", если в body его нет.
+	Meta map[string]string `json:"meta,omitempty"`
+	// Авторов, как и время, выставляет хранилище.
+	OriginalAuthor string `json:"original_author,omitempty"`
+	LastEditor     string `json:"last_editor,omitempty"`
+}
+
+// optionalTime возвращает nil для нулевого времени, чтобы оно
+// не попадало в JSON.
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+func (p *Page) MarshalJSON() ([]byte, error) {
+	return json.Marshal(pageJSON{
+		Title:          p.Title,
+		Slug:           p.Slug,
+		Body:           string(p.Body),
+		CreatedAt:      optionalTime(p.CreatedAt),
+		UpdatedAt:      optionalTime(p.UpdatedAt),
+		Meta:           p.Meta,
+		OriginalAuthor: p.OriginalAuthor,
+		LastEditor:     p.LastEditor,
+	})
+}
+
+func (p *Page) UnmarshalJSON(data []byte) error {
+	var v pageJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	p.Title, p.Body, p.Meta = v.Title, []byte(v.Body), v.Meta
+	return nil
+}
+
+// writeJSON отправляет v в виде JSON с кодом status.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeJSONError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
+
+// Функция apiPageHandler обслуживает /api/v1/pages/{title}: GET возвращает
+// страницу в JSON, PUT создает или обновляет ее, DELETE удаляет.
+// Изменение страниц, как и в HTML-интерфейсе, пропускается через protect
+// и requireEditor, а чтение - через identify, чтобы вошедшим были видны
+// закрытые страницы.
+func apiPageHandler(protect, identify func(http.Handler) http.Handler) http.Handler {
+	get := identify(http.HandlerFunc(apiGetPage))
+	put := protect(requireEditor(http.HandlerFunc(apiPutPage)))
+	visibility := protect(requireEditor(http.HandlerFunc(apiVisibilityHandler)))
+	share := protect(requireEditor(http.HandlerFunc(apiShareHandler)))
+	del := protect(requireEditor(http.HandlerFunc(apiDeletePage)))
+	rename := protect(requireEditor(http.HandlerFunc(apiRenamePage)))
+	clone := protect(requireEditor(http.HandlerFunc(apiClonePage)))
+	comments := identify(apiCommentsHandler(protect))
+	stats := identify(http.HandlerFunc(apiStatsHandler))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if m := apiTitlePath.FindStringSubmatch(r.URL.Path); m != nil {
+			if err := validateTitle(m[1]); err != nil {
+				writeJSONError(w, http.StatusBadRequest, "invalid title: "+err.Error())
+				return
+			}
+		}
+		if apiRenamePath.MatchString(r.URL.Path) {
+			rename.ServeHTTP(w, r)
+			return
+		}
+		if apiClonePath.MatchString(r.URL.Path) {
+			clone.ServeHTTP(w, r)
+			return
+		}
+		if apiVisibilityPath.MatchString(r.URL.Path) {
+			visibility.ServeHTTP(w, r)
+			return
+		}
+		if apiSharePath.MatchString(r.URL.Path) {
+			share.ServeHTTP(w, r)
+			return
+		}
+		if apiStatsPath.MatchString(r.URL.Path) {
+			stats.ServeHTTP(w, r)
+			return
+		}
+		if apiCommentsPath.MatchString(r.URL.Path) || apiCommentPath.MatchString(r.URL.Path) {
+			comments.ServeHTTP(w, r)
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			get.ServeHTTP(w, r)
+		case http.MethodPut:
+			put.ServeHTTP(w, r)
+		case http.MethodDelete:
+			del.ServeHTTP(w, r)
+		default:
+			w.Header().Set("Allow", "GET, PUT, DELETE")
+			writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		}
+	})
+}
+
+func apiGetPage(w http.ResponseWriter, r *http.Request) {
+	m := apiPagePath.FindStringSubmatch(r.URL.Path)
+	if m == nil {
+		writeJSONError(w, http.StatusNotFound, "not found")
+		return
+	}
+	p, err := store.Load(m[1])
+	if errors.Is(err, os.ErrNotExist) {
+		writeJSONError(w, http.StatusNotFound, "page not found")
+		return
+	}
+	if err != nil {
+		serverError(w, err)
+		return
+	}
+	if ok, err := canRead(r, p.Title); err != nil || !ok {
+		if err != nil {
+			serverError(w, err)
+		} else {
+			writeJSONError(w, http.StatusUnauthorized, "authentication required")
+		}
+		return
+	}
+	if p.Slug, err = slugs.Get(p.Title); err != nil {
+		serverError(w, err)
+		return
+	}
+	if notModified(w, r, pageETag(p, nil), p.Modified) {
+		return
+	}
+	writeJSON(w, http.StatusOK, p)
+}
+
+// apiPutPage сохраняет страницу из тела запроса. Заголовок всегда
+// берется из URL; поле "title" в JSON игнорируется.
+func apiPutPage(w http.ResponseWriter, r *http.Request) {
+	m := apiPagePath.FindStringSubmatch(r.URL.Path)
+	if m == nil {
+		writeJSONError(w, http.StatusNotFound, "not found")
+		return
+	}
+	// Тело ограничивается так же, как у формы сохранения.
+	r.Body = http.MaxBytesReader(w, r.Body, maxFormSize())
+	var p Page
+	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeJSONError(w, http.StatusRequestEntityTooLarge, errPageTooLarge.Error())
+			return
+		}
+		writeJSONError(w, http.StatusBadRequest, "malformed JSON: "+err.Error())
+		return
+	}
+	if int64(len(p.Body)) > maxPageSize {
+		writeJSONError(w, http.StatusRequestEntityTooLarge, errPageTooLarge.Error())
+		return
+	}
+	p.Title = m[1]
+	p.LastEditor = editorName(r)
+	lockToken := r.Header.Get(lockTokenHeader)
+	if l := checkEditLock(p.Title, lockToken, time.Now()); l != nil {
+		lockConflict(w, l)
+		return
+	}
+	_, err := store.Load(p.Title)
+	created := errors.Is(err, os.ErrNotExist)
+	if err := store.Save(&p); err == errPageTooLarge {
+		writeJSONError(w, http.StatusRequestEntityTooLarge, err.Error())
+		return
+	} else if err != nil {
+		serverError(w, err)
+		return
+	}
+	if p.Slug, err = slugs.Assign(p.Title); err != nil {
+		serverError(w, err)
+		return
+	}
+	status, action := http.StatusOK, auditEdit
+	if created {
+		status, action = http.StatusCreated, auditCreate
+	}
+	releaseEditLock(p.Title, lockToken)
+	audit(r, action, p.Title)
+	writeJSON(w, status, &p)
+}
+
+// apiDeletePage перемещает страницу в корзину и отвечает 204.
+// С параметром ?purge=1 (или любым непустым значением) страница
+// удаляется безвозвратно.
+func apiDeletePage(w http.ResponseWriter, r *http.Request) {
+	m := apiPagePath.FindStringSubmatch(r.URL.Path)
+	if m == nil {
+		writeJSONError(w, http.StatusNotFound, "not found")
+		return
+	}
+	title := m[1]
+	if l := checkEditLock(title, r.Header.Get(lockTokenHeader), time.Now()); l != nil {
+		lockConflict(w, l)
+		return
+	}
+	err := store.Delete(title)
+	if errors.Is(err, os.ErrNotExist) {
+		writeJSONError(w, http.StatusNotFound, "page not found")
+		return
+	}
+	if err != nil {
+		serverError(w, err)
+		return
+	}
+	if r.URL.Query().Get("purge") != "" {
+		// Хранилище, у которого нет корзины, уже удалило страницу
+		// насовсем, так что отсутствие копии в корзине - не ошибка.
+		if err := trash.Remove(title, 0); err != nil && !errors.Is(err, os.ErrNotExist) {
+			serverError(w, err)
+			return
+		}
+	}
+	audit(r, auditDelete, title)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// apiRenamePage переименовывает страницу:
+// POST /api/v1/pages/{title}/rename с телом {"new_title":"..."}.
+// Старый заголовок запоминается в redirects, и /view/{title} дальше
+// отвечает 301 на новый адрес. Если новый заголовок занят - 409.
+func apiRenamePage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	m := apiRenamePath.FindStringSubmatch(r.URL.Path)
+	var req struct {
+		NewTitle string `json:"new_title"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "malformed JSON: "+err.Error())
+		return
+	}
+	req.NewTitle = normalizeTitle(req.NewTitle)
+	if err := validateTitle(req.NewTitle); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid new_title: "+err.Error())
+		return
+	}
+	if req.NewTitle == m[1] {
+		writeJSONError(w, http.StatusConflict, errPageExists.Error())
+		return
+	}
+	for _, title := range []string{m[1], req.NewTitle} {
+		if l := checkEditLock(title, r.Header.Get(lockTokenHeader), time.Now()); l != nil {
+			lockConflict(w, l)
+			return
+		}
+	}
+	err := renamePage(m[1], req.NewTitle)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		writeJSONError(w, http.StatusNotFound, "page not found")
+		return
+	case err == errPageExists:
+		writeJSONError(w, http.StatusConflict, err.Error())
+		return
+	case err != nil:
+		serverError(w, err)
+		return
+	}
+	audit(r, auditRename, m[1])
+	p, err := store.Load(req.NewTitle)
+	if err == nil {
+		p.Slug, err = slugs.Get(p.Title)
+	}
+	if err != nil {
+		serverError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, p)
+}
+
+// apiClonePage копирует страницу под новым заголовком:
+// POST /api/v1/pages/{title}/clone с телом {"new_title":"..."}.
+// Текст копируется как есть. Метаданные копии новые: с собственным
+// временем создания и без просмотров; от оригинала берутся только
+// теги и видимость, чтобы копия закрытой страницы не стала открытой.
+// Страницу из корзины скопировать нельзя - для нее ответ 404.
+func apiClonePage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	m := apiClonePath.FindStringSubmatch(r.URL.Path)
+	var req struct {
+		NewTitle string `json:"new_title"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "malformed JSON: "+err.Error())
+		return
+	}
+	req.NewTitle = normalizeTitle(req.NewTitle)
+	if err := validateTitle(req.NewTitle); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid new_title: "+err.Error())
+		return
+	}
+	src, err := store.Load(m[1])
+	if errors.Is(err, os.ErrNotExist) {
+		writeJSONError(w, http.StatusNotFound, "page not found")
+		return
+	}
+	if err != nil {
+		serverError(w, err)
+		return
+	}
+	// Новую страницу с этим заголовком может уже писать кто-то
+	// в форме редактирования.
+	if l := checkEditLock(req.NewTitle, r.Header.Get(lockTokenHeader), time.Now()); l != nil {
+		lockConflict(w, l)
+		return
+	}
+	srcMeta, err := metas.Load(src.Title)
+	if err != nil {
+		serverError(w, err)
+		return
+	}
+	// Save с Create проверяет, что страницы еще нет, под блокировкой
+	// записи, так что одновременно созданная страница не затирается.
+	// Метаданные пишутся только после удачного сохранения. От
+	// метаданных, оставшихся от удаленной страницы с тем же заголовком,
+	// не остается ничего: копия создана тем сохранением, которое
+	// хранилище только что отметило как последнее.
+	p := &Page{Title: req.NewTitle, Body: src.Body, LastEditor: editorName(r), Create: true}
+	if err := store.Save(p); err == errPageExists {
+		writeJSONError(w, http.StatusConflict, err.Error())
+		return
+	} else if err != nil {
+		serverError(w, err)
+		return
+	}
+	err = metas.Update(p.Title, func(meta *PageMeta) {
+		*meta = PageMeta{
+			Tags:           srcMeta.Tags,
+			Public:         srcMeta.Public,
+			CreatedAt:      meta.UpdatedAt,
+			UpdatedAt:      meta.UpdatedAt,
+			OriginalAuthor: meta.LastEditor,
+			LastEditor:     meta.LastEditor,
+		}
+	})
+	if err != nil {
+		serverError(w, err)
+		return
+	}
+	p.CreatedAt, p.OriginalAuthor = p.UpdatedAt, p.LastEditor
+	if p.Slug, err = slugs.Assign(p.Title); err != nil {
+		serverError(w, err)
+		return
+	}
+	audit(r, auditCreate, p.Title)
+	writeJSON(w, http.StatusCreated, p)
+}
+
+// apiTrashHandler отдает содержимое корзины: GET /api/v1/trash.
+func apiTrashHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	list, err := trash.List()
+	if err != nil {
+		serverError(w, err)
+		return
+	}
+	if list == nil {
+		list = []TrashEntry{}
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+// apiRestoreHandler восстанавливает страницу из корзины:
+// POST /api/v1/trash/{title}/restore[?version=N]. Без version
+// восстанавливается последняя удаленная копия. Если страница с таким
+// заголовком уже есть, ответ - 409 Conflict.
+func apiRestoreHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	m := apiRestorePath.FindStringSubmatch(r.URL.Path)
+	if m == nil {
+		writeJSONError(w, http.StatusNotFound, "not found")
+		return
+	}
+	var version int64
+	if v := r.URL.Query().Get("version"); v != "" {
+		var err error
+		if version, err = strconv.ParseInt(v, 10, 64); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "invalid version")
+			return
+		}
+	}
+	p, err := restorePage(m[1], version, editorName(r))
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		writeJSONError(w, http.StatusNotFound, "no such page in trash")
+	case err == errPageExists:
+		writeJSONError(w, http.StatusConflict, err.Error())
+	case err != nil:
+		serverError(w, err)
+	default:
+		audit(r, auditRestore, m[1])
+		writeJSON(w, http.StatusOK, p)
+	}
+}
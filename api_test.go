@@ -0,0 +1,323 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testDataDir переносит все данные сервера во временный каталог
+// теста, а store - в FileStorage в этом каталоге. Блокировки
+// редактирования, которые живут только в памяти, снимаются. После
+// теста прежние значения восстанавливаются.
+func testDataDir(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	s, err := NewFileStorage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := store
+	store = s
+	useDataDir(dir)
+	clearEditLocks()
+	t.Cleanup(func() {
+		store = old
+		useDataDir(".")
+		clearEditLocks()
+	})
+	return dir
+}
+
+func clearEditLocks() {
+	editLocks.Range(func(key, _ interface{}) bool {
+		editLocks.Delete(key)
+		return true
+	})
+}
+
+// savePage сохраняет страницу title с текстом body через store.
+func savePage(t *testing.T, title, body string) {
+	t.Helper()
+	if err := store.Save(&Page{Title: title, Body: []byte(body)}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// serve выполняет запрос к h и возвращает ответ.
+func serve(h http.HandlerFunc, method, target, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	if body != "" {
+		r.Header.Set("Content-Type", "application/json")
+	}
+	w := httptest.NewRecorder()
+	h(w, r)
+	return w
+}
+
+func TestAPIDeleteAndRestore(t *testing.T) {
+	tests := []struct {
+		name        string
+		noTrashDir  bool   // каталога trash/ еще нет
+		query       string // параметры DELETE
+		wantTrashed int    // копий в корзине после удаления
+		wantRestore int    // ответ на восстановление
+	}{
+		{"soft delete", false, "", 1, http.StatusOK},
+		{"trash directory is created", true, "", 1, http.StatusOK},
+		{"purge", false, "?purge=1", 0, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := testDataDir(t)
+			if tt.noTrashDir {
+				if err := os.RemoveAll(filepath.Join(dir, "trash")); err != nil {
+					t.Fatal(err)
+				}
+			}
+			savePage(t, "Foo", "hello")
+
+			w := serve(apiDeletePage, http.MethodDelete, "/api/v1/pages/Foo"+tt.query, "")
+			if w.Code != http.StatusNoContent {
+				t.Fatalf("DELETE status = %d, want 204", w.Code)
+			}
+			if _, err := os.Stat(filepath.Join(dir, "Foo.txt")); !os.IsNotExist(err) {
+				t.Errorf("page file still exists after delete: %v", err)
+			}
+
+			w = serve(apiTrashHandler, http.MethodGet, "/api/v1/trash", "")
+			var list []TrashEntry
+			if err := json.NewDecoder(w.Body).Decode(&list); err != nil {
+				t.Fatal(err)
+			}
+			if len(list) != tt.wantTrashed {
+				t.Fatalf("trash = %v, want %d entries", list, tt.wantTrashed)
+			}
+			if len(list) > 0 && list[0].Title != "Foo" {
+				t.Errorf("trashed title = %q, want Foo", list[0].Title)
+			}
+
+			w = serve(apiRestoreHandler, http.MethodPost, "/api/v1/trash/Foo/restore", "")
+			if w.Code != tt.wantRestore {
+				t.Fatalf("restore status = %d, want %d", w.Code, tt.wantRestore)
+			}
+			if tt.wantRestore != http.StatusOK {
+				return
+			}
+			p, err := store.Load("Foo")
+			if err != nil || string(p.Body) != "hello" {
+				t.Errorf("restored page = %v, %v; want body hello", p, err)
+			}
+		})
+	}
+}
+
+func TestAPIRestoreConflict(t *testing.T) {
+	testDataDir(t)
+	savePage(t, "Foo", "old")
+	if w := serve(apiDeletePage, http.MethodDelete, "/api/v1/pages/Foo", ""); w.Code != http.StatusNoContent {
+		t.Fatalf("DELETE status = %d", w.Code)
+	}
+	savePage(t, "Foo", "new")
+	if w := serve(apiRestoreHandler, http.MethodPost, "/api/v1/trash/Foo/restore", ""); w.Code != http.StatusConflict {
+		t.Errorf("restore over an existing page: status = %d, want 409", w.Code)
+	}
+}
+
+// Заголовок из URL проверяется до того, как он попадет в путь файла.
+func TestAPIPageRejectsBadTitles(t *testing.T) {
+	testDataDir(t)
+	h := apiPageHandler(func(h http.Handler) http.Handler { return h }, func(h http.Handler) http.Handler { return h })
+	for _, target := range []string{"/api/v1/pages/..", "/api/v1/pages/a.b", "/api/v1/pages/%2e%2e%2fetc"} {
+		r := httptest.NewRequest(http.MethodDelete, target, nil)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != http.StatusBadRequest && w.Code != http.StatusNotFound {
+			t.Errorf("DELETE %s: status = %d, want 400 or 404", target, w.Code)
+		}
+	}
+}
+
+// Восстановление сохраняет страницу через store, так что подписчики
+// /events узнают о нем, а копия уходит из корзины.
+func TestAPIRestoreGoesThroughStore(t *testing.T) {
+	testDataDir(t)
+	store = eventStorage{store}
+	savePage(t, "Foo", "hello")
+	if w := serve(apiDeletePage, http.MethodDelete, "/api/v1/pages/Foo", ""); w.Code != http.StatusNoContent {
+		t.Fatalf("DELETE status = %d", w.Code)
+	}
+	events := broker.Subscribe()
+	defer broker.Unsubscribe(events)
+
+	if w := serve(apiRestoreHandler, http.MethodPost, "/api/v1/trash/Foo/restore", ""); w.Code != http.StatusOK {
+		t.Fatalf("restore status = %d, want 200", w.Code)
+	}
+	select {
+	case data := <-events:
+		if want := `{"event":"saved","title":"Foo"}`; string(data) != want {
+			t.Errorf("event = %s, want %s", data, want)
+		}
+	case <-time.After(500 * time.Millisecond):
+		t.Error("no event after restore")
+	}
+	if list, err := trash.List(); err != nil || len(list) != 0 {
+		t.Errorf("trash after restore = %v, %v; want empty", list, err)
+	}
+}
+
+func TestAPIClonePage(t *testing.T) {
+	tests := []struct {
+		name       string
+		source     string
+		body       string
+		want       int
+		wantPublic bool
+	}{
+		{"copy", "Foo", `{"new_title":"Copy"}`, http.StatusCreated, true},
+		{"copy of a private page stays private", "Secret", `{"new_title":"Copy"}`, http.StatusCreated, false},
+		{"existing title", "Foo", `{"new_title":"Taken"}`, http.StatusConflict, true},
+		{"missing source", "Missing", `{"new_title":"Copy"}`, http.StatusNotFound, true},
+		{"invalid title", "Foo", `{"new_title":"../Copy"}`, http.StatusBadRequest, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testDataDir(t)
+			store = timestampStorage{store}
+			savePage(t, "Foo", "#go\nfoo")
+			savePage(t, "Secret", "hidden")
+			savePage(t, "Taken", "taken")
+			for title, public := range map[string]bool{"Foo": true, "Secret": false} {
+				if err := metas.Update(title, func(m *PageMeta) { m.Tags, m.Public, m.Views = []string{"go"}, public, 7 }); err != nil {
+					t.Fatal(err)
+				}
+			}
+			// Метаданные удаленной страницы Copy копии не достаются.
+			if err := metas.Update("Copy", func(m *PageMeta) { m.Views, m.CreatedAt = 99, time.Unix(0, 0) }); err != nil {
+				t.Fatal(err)
+			}
+
+			w := serve(apiClonePage, http.MethodPost, "/api/v1/pages/"+tt.source+"/clone", tt.body)
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+			if p, err := store.Load("Taken"); err != nil || string(p.Body) != "taken" {
+				t.Errorf("page Taken = %v, %v; want it untouched", p, err)
+			}
+			if tt.want != http.StatusCreated {
+				return
+			}
+			src, _ := store.Load(tt.source)
+			p, err := store.Load("Copy")
+			if err != nil || string(p.Body) != string(src.Body) {
+				t.Fatalf("copy = %v, %v; want the text of %s", p, err, tt.source)
+			}
+			m, err := metas.Load("Copy")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if m.Public != tt.wantPublic || len(m.Tags) != 1 || m.Views != 0 || time.Since(m.CreatedAt) > time.Minute {
+				t.Errorf("copy meta = %+v, want public %v, tags [go], no views and a fresh creation time", m, tt.wantPublic)
+			}
+		})
+	}
+}
+
+// Из одновременных копий под одним заголовком создается одна,
+// остальные получают 409.
+func TestAPIClonePageConcurrent(t *testing.T) {
+	testDataDir(t)
+	savePage(t, "Foo", "foo")
+	const n = 20
+	codes := make(chan int, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			codes <- serve(apiClonePage, http.MethodPost, "/api/v1/pages/Foo/clone", `{"new_title":"Copy"}`).Code
+		}()
+	}
+	wg.Wait()
+	close(codes)
+	created := 0
+	for code := range codes {
+		switch code {
+		case http.StatusCreated:
+			created++
+		case http.StatusConflict:
+		default:
+			t.Errorf("status = %d, want 201 or 409", code)
+		}
+	}
+	if created != 1 {
+		t.Errorf("%d clones created, want 1", created)
+	}
+}
+
+func TestAPIGetAndPutPage(t *testing.T) {
+	testDataDir(t)
+	// protect здесь только кладет в контекст вошедшего редактора.
+	asBob := func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), userContextKey, &User{Username: "bob"})))
+		})
+	}
+	h := apiPageHandler(asBob, func(h http.Handler) http.Handler { return h })
+	tests := []struct {
+		name     string
+		method   string
+		target   string
+		body     string
+		want     int
+		wantBody string // поле body ответа
+	}{
+		{"get missing", http.MethodGet, "/api/v1/pages/Foo", "", http.StatusNotFound, ""},
+		{"create", http.MethodPut, "/api/v1/pages/Foo", `{"body":"first"}`, http.StatusCreated, "first"},
+		{"get", http.MethodGet, "/api/v1/pages/Foo", "", http.StatusOK, "first"},
+		{"update", http.MethodPut, "/api/v1/pages/Foo", `{"title":"Other","body":"second"}`, http.StatusOK, "second"},
+		{"legacy path", http.MethodGet, "/api/pages/Foo", "", http.StatusOK, "second"},
+		{"malformed JSON", http.MethodPut, "/api/v1/pages/Foo", `{"body":`, http.StatusBadRequest, ""},
+		{"wrong method", http.MethodPost, "/api/v1/pages/Foo", `{"body":"x"}`, http.StatusMethodNotAllowed, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+			if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+				t.Errorf("Content-Type = %q, want application/json", ct)
+			}
+			var resp struct{ Title, Body, Error string }
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatalf("response is not JSON: %v", err)
+			}
+			if tt.wantBody == "" {
+				if resp.Error == "" {
+					t.Errorf("error response has no error field")
+				}
+				return
+			}
+			// Заголовок всегда берется из URL.
+			if resp.Title != "Foo" || resp.Body != tt.wantBody {
+				t.Errorf("page = %+v, want Foo with body %q", resp, tt.wantBody)
+			}
+		})
+	}
+	if p, err := store.Load("Foo"); err != nil || string(p.Body) != "second" {
+		t.Errorf("stored page = %v, %v; want body second", p, err)
+	}
+	if _, err := store.Load("Other"); err == nil {
+		t.Error("the title field of the JSON body created a page")
+	}
+}
@@ -0,0 +1,3 @@
+ReactDOM.createRoot(document.getElementById("graphiql")).render(
+    React.createElement(GraphiQL, {fetcher: GraphiQL.createFetcher({url: "/graphql"})})
+);
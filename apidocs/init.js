@@ -0,0 +1,4 @@
+window.ui = SwaggerUIBundle({
+    url: "/api/v1/openapi.json",
+    dom_id: "#swagger-ui"
+});
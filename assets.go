@@ -0,0 +1,29 @@
+package main
+
+import (
+	"embed"
+	"io/fs"
+	"os"
+)
+
+// embeddedAssets - шаблоны html/ и статические файлы static/,
+// встроенные в бинарный файл, чтобы серверу не нужны были файлы
+// рядом с ним.
+//
+//go:embed html static
+var embeddedAssets embed.FS
+
+// assets - откуда берутся шаблоны и статические файлы: по умолчанию
+// встроенные, а в режиме разработки - с диска (см. useDiskAssets).
+var assets fs.FS = embeddedAssets
+
+// useDiskAssets читает шаблоны и статические файлы из каталога dir,
+// чтобы правки были видны без пересборки.
+func useDiskAssets(dir string) {
+	assets = os.DirFS(dir)
+}
+
+func assetExists(name string) bool {
+	_, err := fs.Stat(assets, name)
+	return err == nil
+}
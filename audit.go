@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AuditEntry - одна запись журнала аудита: кто, когда, откуда
+// и что сделал со страницей.
+type AuditEntry struct {
+	Time   time.Time `json:"time"`
+	User   string    `json:"user"`
+	Action string    `json:"action"`
+	Title  string    `json:"title"`
+	IPAddr string    `json:"ip"`
+}
+
+// Действия, которые попадают в журнал аудита.
+const (
+	auditCreate  = "create"
+	auditEdit    = "edit"
+	auditDelete  = "delete"
+	auditRename  = "rename"
+	auditRestore = "restore"
+	// Страница открыта или закрыта для анонимных пользователей.
+	auditVisibility = "visibility"
+)
+
+// AuditLogger записывает изменения страниц в журнал аудита.
+type AuditLogger interface {
+	Log(AuditEntry) error
+}
+
+// FileAuditLogger дописывает записи в файл Path по одной JSON-строке.
+// В начале новых суток текущий файл переименовывается с суффиксом
+// даты (audit.log -> audit-2006-01-02.log), и записи идут в новый.
+type FileAuditLogger struct {
+	Path string
+
+	mu  sync.Mutex
+	day string // дата записей в текущем файле Path
+}
+
+// auditLog - журнал, в который пишут обработчики изменения страниц.
+var auditLog = &FileAuditLogger{Path: "audit.log"}
+
+const auditDayLayout = "2006-01-02"
+
+// rotatedPath возвращает имя файла с записями за день day.
+func (l *FileAuditLogger) rotatedPath(day string) string {
+	ext := filepath.Ext(l.Path)
+	return strings.TrimSuffix(l.Path, ext) + "-" + day + ext
+}
+
+// Log дописывает e в журнал, при необходимости сначала
+// переименовывая файл за прошлый день.
+func (l *FileAuditLogger) Log(e AuditEntry) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	day := e.Time.Format(auditDayLayout)
+	if l.day == "" {
+		// После перезапуска день текущего файла узнаем по времени
+		// его последнего изменения.
+		if fi, err := os.Stat(l.Path); err == nil {
+			l.day = fi.ModTime().Format(auditDayLayout)
+		}
+	}
+	if l.day != "" && l.day != day {
+		if err := os.Rename(l.Path, l.rotatedPath(l.day)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	l.day = day
+	f, err := os.OpenFile(l.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Recent возвращает до n последних записей, от старых к новым.
+// Если в текущем файле записей меньше n, недостающие берутся
+// из файлов за прошлые дни.
+func (l *FileAuditLogger) Recent(n int) ([]AuditEntry, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	rotated, err := filepath.Glob(l.rotatedPath("*"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(rotated)
+	files := append(rotated, l.Path)
+	var entries []AuditEntry
+	for i := len(files) - 1; i >= 0 && len(entries) < n; i-- {
+		list, err := readAuditFile(files[i])
+		if err != nil {
+			return nil, err
+		}
+		entries = append(list, entries...)
+	}
+	if len(entries) > n {
+		entries = entries[len(entries)-n:]
+	}
+	return entries, nil
+}
+
+func readAuditFile(path string) ([]AuditEntry, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var list []AuditEntry
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var e AuditEntry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			return nil, err
+		}
+		list = append(list, e)
+	}
+	return list, sc.Err()
+}
+
+// audit записывает в auditLog действие action над страницей title,
+// выполненное в запросе r. Журнал не должен ломать уже выполненное
+// изменение, поэтому ошибка записи только логируется.
+func audit(r *http.Request, action, title string) {
+	e := AuditEntry{Time: time.Now(), Action: action, Title: title, IPAddr: clientIP(r)}
+	if u := userFromContext(r.Context()); u != nil {
+		e.User = u.Username
+	}
+	if err := auditLog.Log(e); err != nil {
+		loggerFromContext(r.Context()).Error("не удалось записать в журнал аудита",
+			"action", action, "title", title, "error", err)
+	}
+}
+
+// auditHandler отдает последние записи журнала аудита в JSON:
+// GET /admin/audit?limit=100.
+func auditHandler(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet, http.MethodHead) {
+		return
+	}
+	limit := queryInt(r, "limit", 100)
+	if limit < 1 {
+		writeJSONError(w, http.StatusBadRequest, "invalid limit")
+		return
+	}
+	entries, err := auditLog.Recent(limit)
+	if err != nil {
+		serverError(w, err)
+		return
+	}
+	if entries == nil {
+		entries = []AuditEntry{}
+	}
+	writeJSON(w, http.StatusOK, entries)
+}
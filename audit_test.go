@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSaveWritesAudit(t *testing.T) {
+	testDataDir(t)
+	for _, body := range []string{"first", "second"} {
+		r := httptest.NewRequest(http.MethodPost, "/save/Foo", strings.NewReader(url.Values{"body": {body}}.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.RemoteAddr = "192.0.2.1:1234"
+		r = r.WithContext(context.WithValue(r.Context(), userContextKey, &User{Username: "alice"}))
+		w := httptest.NewRecorder()
+		makeHandler(saveHandler)(w, r)
+		if w.Code != http.StatusFound {
+			t.Fatalf("save status = %d, want 302", w.Code)
+		}
+	}
+
+	entries, err := auditLog.Recent(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("audit entries = %+v, want 2", entries)
+	}
+	for i, action := range []string{auditCreate, auditEdit} {
+		e := entries[i]
+		if e.Action != action || e.Title != "Foo" || e.User != "alice" || e.IPAddr != "192.0.2.1" || time.Since(e.Time) > time.Minute {
+			t.Errorf("entry %d = %+v, want %s of Foo by alice from 192.0.2.1", i, e, action)
+		}
+	}
+
+	w := serve(auditHandler, http.MethodGet, "/admin/audit?limit=1", "")
+	var last []AuditEntry
+	if err := json.NewDecoder(w.Body).Decode(&last); err != nil {
+		t.Fatal(err)
+	}
+	if len(last) != 1 || last[0].Action != auditEdit {
+		t.Errorf("GET /admin/audit?limit=1 = %+v, want the edit entry", last)
+	}
+	if w := serve(auditHandler, http.MethodGet, "/admin/audit?limit=0", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("limit=0: status = %d, want 400", w.Code)
+	}
+}
+
+func TestFileAuditLoggerRotation(t *testing.T) {
+	dir := t.TempDir()
+	l := &FileAuditLogger{Path: filepath.Join(dir, "audit.log")}
+	day1 := time.Date(2024, time.March, 5, 23, 59, 0, 0, time.Local)
+	day2 := day1.Add(2 * time.Minute)
+	for _, e := range []AuditEntry{
+		{Time: day1, Action: auditCreate, Title: "Foo"},
+		{Time: day1, Action: auditEdit, Title: "Foo"},
+		{Time: day2, Action: auditDelete, Title: "Foo"},
+	} {
+		if err := l.Log(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rotated, err := readAuditFile(filepath.Join(dir, "audit-2024-03-05.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rotated) != 2 || rotated[1].Action != auditEdit {
+		t.Errorf("audit-2024-03-05.log = %+v, want the two entries of March 5", rotated)
+	}
+	current, err := readAuditFile(l.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(current) != 1 || current[0].Action != auditDelete {
+		t.Errorf("audit.log = %+v, want only the entry of March 6", current)
+	}
+	// Recent собирает записи и из файлов за прошлые дни.
+	if got, err := l.Recent(3); err != nil || len(got) != 3 || got[0].Action != auditCreate {
+		t.Errorf("Recent(3) = %+v, %v; want all three entries, oldest first", got, err)
+	}
+
+	// После перезапуска день текущего файла берется из времени его изменения.
+	if err := os.Chtimes(l.Path, day2, day2); err != nil {
+		t.Fatal(err)
+	}
+	restarted := &FileAuditLogger{Path: l.Path}
+	if err := restarted.Log(AuditEntry{Time: day2.Add(24 * time.Hour), Action: auditCreate, Title: "Bar"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "audit-2024-03-06.log")); err != nil {
+		t.Errorf("no rotated file for March 6 after restart: %v", err)
+	}
+}
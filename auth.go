@@ -0,0 +1,514 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// User - учетная запись из users.json. Пароль хранится только
+// в виде bcrypt-хеша.
+type User struct {
+	Username     string `json:"username"`
+	PasswordHash string `json:"password_hash"`
+	Email        string `json:"email,omitempty"`
+	// Unverified - пользователь зарегистрировался через /register,
+	// но еще не подтвердил адрес почты и войти не может.
+	Unverified bool `json:"unverified,omitempty"`
+	// Role ограничивает права пользователя: пустая - редактор,
+	// roleReader - читатель (так регистрируются через /register).
+	Role string `json:"role,omitempty"`
+}
+
+// roleReader - роль пользователя, который может войти, вести профиль
+// и комментировать, но не видит закрытых страниц и не меняет страницы.
+const roleReader = "reader"
+
+// UserStore читает пользователей из JSON-файла Path. Файл читается
+// при каждом обращении, поэтому новых пользователей можно добавлять
+// без перезапуска сервера.
+type UserStore struct {
+	Path string
+	mu   sync.Mutex
+}
+
+var (
+	errUnknownUser = errors.New("unknown user")
+	errUnverified  = errors.New("email address is not verified")
+	errUserExists  = errors.New("username is already taken")
+	errEmailExists = errors.New("email address is already registered")
+)
+
+func (s *UserStore) load() ([]User, error) {
+	data, err := ioutil.ReadFile(s.Path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var list []User
+	return list, json.Unmarshal(data, &list)
+}
+
+func (s *UserStore) store(list []User) error {
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.Path, data, 0600)
+}
+
+// Lookup возвращает пользователя с именем username или errUnknownUser.
+func (s *UserStore) Lookup(username string) (*User, error) {
+	list, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	for i := range list {
+		if list[i].Username == username {
+			return &list[i], nil
+		}
+	}
+	return nil, errUnknownUser
+}
+
+// dummyHash - bcrypt-хеш, с которым Authenticate сверяет пароль
+// неизвестного пользователя. Он создается при первом обращении
+// с той же стоимостью, что и хеши зарегистрированных пользователей.
+var dummyHash struct {
+	once sync.Once
+	hash []byte
+}
+
+func dummyPasswordHash() []byte {
+	dummyHash.once.Do(func() {
+		h, err := bcrypt.GenerateFromPassword([]byte("dummy password"), registerBcryptCost)
+		if err != nil {
+			panic(err)
+		}
+		dummyHash.hash = h
+	})
+	return dummyHash.hash
+}
+
+// Authenticate проверяет имя и пароль. Для неизвестного пользователя
+// возвращается та же ошибка, что и для неверного пароля, а для
+// неподтвержденного - errUnverified, но только при верном пароле.
+// Пароль неизвестного пользователя тоже сверяется с хешем, чтобы по
+// времени ответа нельзя было узнать, какие имена заняты.
+func (s *UserStore) Authenticate(username, password string) (*User, error) {
+	u, err := s.Lookup(username)
+	if errors.Is(err, errUnknownUser) {
+		bcrypt.CompareHashAndPassword(dummyPasswordHash(), []byte(password))
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+	if bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(password)) != nil {
+		return nil, errUnknownUser
+	}
+	if u.Unverified {
+		return nil, errUnverified
+	}
+	return u, nil
+}
+
+// Add добавляет пользователя u. Занятое имя или адрес почты -
+// ошибки errUserExists и errEmailExists.
+func (s *UserStore) Add(u User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list, err := s.load()
+	if err != nil {
+		return err
+	}
+	for _, v := range list {
+		switch {
+		case v.Username == u.Username:
+			return errUserExists
+		case u.Email != "" && strings.EqualFold(v.Email, u.Email):
+			return errEmailExists
+		}
+	}
+	return s.store(append(list, u))
+}
+
+// Update меняет пользователя username функцией fn.
+func (s *UserStore) Update(username string, fn func(*User)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list, err := s.load()
+	if err != nil {
+		return err
+	}
+	for i := range list {
+		if list[i].Username == username {
+			fn(&list[i])
+			return s.store(list)
+		}
+	}
+	return errUnknownUser
+}
+
+// Remove удаляет пользователя username, если он есть.
+func (s *UserStore) Remove(username string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list, err := s.load()
+	if err != nil {
+		return err
+	}
+	for i := range list {
+		if list[i].Username == username {
+			return s.store(append(list[:i], list[i+1:]...))
+		}
+	}
+	return nil
+}
+
+// adminUsers - имена пользователей с правами администратора
+// (переменная WEB_ADMIN_USERS, через запятую).
+var adminUsers = []string{"admin"}
+
+// isAdmin сообщает, является ли u администратором.
+func isAdmin(u *User) bool {
+	if u == nil {
+		return false
+	}
+	for _, name := range adminUsers {
+		if u.Username == name {
+			return true
+		}
+	}
+	return false
+}
+
+// isEditor сообщает, может ли u менять страницы и читать закрытые.
+// Это все вошедшие пользователи, кроме читателей (roleReader).
+func isEditor(u *User) bool {
+	return u != nil && u.Role != roleReader
+}
+
+// Sessions подписывает и проверяет cookie сессии. Значение cookie -
+// это "userID|expires" и HMAC-SHA256 от него на ключе Key. Смена ключа
+// делает недействительными все ранее выданные сессии.
+type Sessions struct {
+	Key []byte
+	TTL time.Duration
+}
+
+const sessionCookie = "session"
+
+var errBadSession = errors.New("invalid session")
+
+func (s *Sessions) mac(payload string) []byte {
+	m := hmac.New(sha256.New, s.Key)
+	m.Write([]byte(payload))
+	return m.Sum(nil)
+}
+
+// Sign возвращает значение cookie для пользователя userID,
+// действительное до expires.
+func (s *Sessions) Sign(userID string, expires time.Time) string {
+	payload := userID + "|" + strconv.FormatInt(expires.Unix(), 10)
+	enc := base64.RawURLEncoding
+	return enc.EncodeToString([]byte(payload)) + "." + enc.EncodeToString(s.mac(payload))
+}
+
+// Verify проверяет подпись и срок действия значения cookie
+// и возвращает userID.
+func (s *Sessions) Verify(value string, now time.Time) (string, error) {
+	enc := base64.RawURLEncoding
+	i := strings.IndexByte(value, '.')
+	if i < 0 {
+		return "", errBadSession
+	}
+	payload, err := enc.DecodeString(value[:i])
+	if err != nil {
+		return "", errBadSession
+	}
+	sig, err := enc.DecodeString(value[i+1:])
+	if err != nil || !hmac.Equal(sig, s.mac(string(payload))) {
+		return "", errBadSession
+	}
+	j := strings.LastIndexByte(string(payload), '|')
+	if j < 0 {
+		return "", errBadSession
+	}
+	expires, err := strconv.ParseInt(string(payload[j+1:]), 10, 64)
+	if err != nil || now.Unix() >= expires {
+		return "", errBadSession
+	}
+	return string(payload[:j]), nil
+}
+
+// userFromContext возвращает пользователя, которого authMiddleware
+// положил в контекст запроса, или nil.
+func userFromContext(ctx context.Context) *User {
+	u, _ := ctx.Value(userContextKey).(*User)
+	return u
+}
+
+// Authenticator - способ входа в вики. authMiddleware и identifyMiddleware
+// знают только этот интерфейс, поэтому новый способ входа (OAuth2, LDAP)
+// добавляется еще одной реализацией без изменения middleware.
+type Authenticator interface {
+	// Authenticate возвращает автора запроса r. Если запрос не несет
+	// действительных учетных данных, возвращается errNotAuthenticated.
+	Authenticate(r *http.Request) (*User, error)
+	// LoginHandler обслуживает /login, LogoutHandler - /logout.
+	LoginHandler() http.Handler
+	LogoutHandler() http.Handler
+}
+
+var errNotAuthenticated = errors.New("not authenticated")
+
+// challenger - необязательный интерфейс Authenticator: как ответить
+// на запрос к защищенной странице без учетных данных. Без него
+// authMiddleware отвечает 401.
+type challenger interface {
+	Challenge(w http.ResponseWriter, r *http.Request)
+}
+
+// newAuthenticator выбирает способ входа по cfg.AuthBackend
+// (WEB_AUTH_BACKEND): "json" - вход через /login по пользователям
+// из users.json, "basic" - HTTP Basic Auth с одним пользователем.
+// Без явного выбора используется basic, если задано имя -user, и json
+// в остальных случаях.
+func newAuthenticator(cfg *Config, sessions *Sessions, users *UserStore) (Authenticator, error) {
+	backend := cfg.AuthBackend
+	if backend == "" {
+		backend = "json"
+		if cfg.AuthUser != "" {
+			backend = "basic"
+		}
+	}
+	switch backend {
+	case "json":
+		return &JSONFileAuthenticator{Sessions: sessions, Users: users}, nil
+	case "basic":
+		return newBasicAuthenticator(cfg.AuthUser, cfg.AuthPass, cfg.AuthPassHash)
+	}
+	return nil, fmt.Errorf("unknown auth backend %q", backend)
+}
+
+// authMiddleware пропускает запрос дальше, только если a узнал его
+// автора, и кладет пользователя в контекст запроса. Остальным
+// отвечает a (см. challenger) или 401.
+func authMiddleware(a Authenticator) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			u, err := a.Authenticate(r)
+			if errors.Is(err, errNotAuthenticated) {
+				if c, ok := a.(challenger); ok {
+					c.Challenge(w, r)
+					return
+				}
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+			if err != nil {
+				serverError(w, err)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), userContextKey, u)))
+		})
+	}
+}
+
+// identifyMiddleware, в отличие от authMiddleware, пропускает все
+// запросы, но если a узнал автора запроса, кладет его в контекст.
+// Так страницы, открытые всем, могут показать больше вошедшим
+// пользователям.
+func identifyMiddleware(a Authenticator) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if u, err := a.Authenticate(r); err == nil {
+				r = r.WithContext(context.WithValue(r.Context(), userContextKey, u))
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// JSONFileAuthenticator - вход через форму /login по пользователям
+// из users.json (Users). После входа пользователя узнают по подписанной
+// cookie сессии.
+type JSONFileAuthenticator struct {
+	Sessions *Sessions
+	Users    *UserStore
+}
+
+func (a *JSONFileAuthenticator) Authenticate(r *http.Request) (*User, error) {
+	c, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return nil, errNotAuthenticated
+	}
+	id, err := a.Sessions.Verify(c.Value, time.Now())
+	if err != nil {
+		return nil, errNotAuthenticated
+	}
+	u, err := a.Users.Lookup(id)
+	if errors.Is(err, errUnknownUser) {
+		return nil, errNotAuthenticated
+	}
+	return u, err
+}
+
+func (a *JSONFileAuthenticator) LoginHandler() http.Handler {
+	return loginHandler(a.Sessions, a.Users)
+}
+
+func (a *JSONFileAuthenticator) LogoutHandler() http.Handler {
+	return http.HandlerFunc(logoutHandler)
+}
+
+// Challenge перенаправляет на страницу входа.
+func (a *JSONFileAuthenticator) Challenge(w http.ResponseWriter, r *http.Request) {
+	http.Redirect(w, r, "/login", http.StatusFound)
+}
+
+// loginView - данные шаблона login.html: ошибка входа или сообщение
+// (например, о подтвержденном адресе почты).
+type loginView struct {
+	Error     string
+	Notice    string
+	CSRFToken string
+}
+
+// Функция loginHandler показывает форму входа на GET, а на POST
+// проверяет имя и пароль, выставляет cookie сессии и перенаправляет на "/".
+func loginHandler(s *Sessions, users *UserStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			renderTemplate(w, "login", loginView{CSRFToken: csrfToken(r)})
+			return
+		}
+		u, err := users.Authenticate(r.FormValue("username"), r.FormValue("password"))
+		if err != nil {
+			msg := "Invalid username or password"
+			if errors.Is(err, errUnverified) {
+				msg = "Please confirm your email address before logging in"
+			}
+			// После WriteHeader заголовки уже не меняются, поэтому
+			// тип содержимого задается заранее.
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.WriteHeader(http.StatusUnauthorized)
+			renderTemplate(w, "login", loginView{Error: msg, CSRFToken: csrfToken(r)})
+			return
+		}
+		expires := time.Now().Add(s.TTL)
+		http.SetCookie(w, &http.Cookie{
+			Name:     sessionCookie,
+			Value:    s.Sign(u.Username, expires),
+			Path:     "/",
+			Expires:  expires,
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+		})
+		http.Redirect(w, r, "/", http.StatusFound)
+	}
+}
+
+// Функция logoutHandler удаляет cookie сессии. Выход принимается
+// только методом POST, чтобы его нельзя было вызвать простой ссылкой.
+func logoutHandler(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodPost) {
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, "/", http.StatusFound)
+}
+
+// BasicAuthenticator - HTTP Basic Auth с единственным пользователем
+// Username. Пароль хранится только в виде bcrypt-хеша PasswordHash.
+type BasicAuthenticator struct {
+	Username     string
+	PasswordHash []byte
+}
+
+// newBasicAuthenticator создает BasicAuthenticator для username.
+// Хеш пароля берется из hash (WEB_AUTH_PASSWORD_HASH), а если он
+// не задан - вычисляется из пароля password (-pass).
+func newBasicAuthenticator(username, password, hash string) (*BasicAuthenticator, error) {
+	if username == "" {
+		return nil, errors.New("basic auth: no username (-user or WEB_AUTH_USER)")
+	}
+	if hash == "" {
+		if password == "" {
+			return nil, errors.New("basic auth: no password (-pass or WEB_AUTH_PASSWORD_HASH)")
+		}
+		h, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		if err != nil {
+			return nil, err
+		}
+		hash = string(h)
+	}
+	if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+		return nil, fmt.Errorf("basic auth: bad password hash: %v", err)
+	}
+	return &BasicAuthenticator{Username: username, PasswordHash: []byte(hash)}, nil
+}
+
+// Authenticate проверяет учетные данные Basic Auth. Хеш сверяется
+// и при неверном имени, чтобы имя нельзя было подобрать по времени
+// ответа.
+func (a *BasicAuthenticator) Authenticate(r *http.Request) (*User, error) {
+	user, pass, ok := r.BasicAuth()
+	if !ok {
+		return nil, errNotAuthenticated
+	}
+	userOK := subtle.ConstantTimeCompare([]byte(user), []byte(a.Username)) == 1
+	passOK := bcrypt.CompareHashAndPassword(a.PasswordHash, []byte(pass)) == nil
+	if !userOK || !passOK {
+		return nil, errNotAuthenticated
+	}
+	return &User{Username: user}, nil
+}
+
+// LoginHandler просит браузер спросить учетные данные и после входа
+// перенаправляет на "/". Формы входа в этом режиме нет.
+func (a *BasicAuthenticator) LoginHandler() http.Handler {
+	return authMiddleware(a)(http.RedirectHandler("/", http.StatusFound))
+}
+
+// LogoutHandler отвечает 401: выйти из Basic Auth на сервере нельзя,
+// но после такого ответа большинство браузеров забывает учетные данные.
+func (a *BasicAuthenticator) LogoutHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !allowMethod(w, r, http.MethodPost) {
+			return
+		}
+		http.Error(w, "Logged out", http.StatusUnauthorized)
+	})
+}
+
+// Challenge отвечает 401 с заголовком WWW-Authenticate, на который
+// браузер показывает окно ввода имени и пароля.
+func (a *BasicAuthenticator) Challenge(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("WWW-Authenticate", `Basic realm="wiki"`)
+	http.Error(w, "Unauthorized", http.StatusUnauthorized)
+}
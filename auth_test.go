@@ -0,0 +1,254 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestSessionsVerify(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	s := &Sessions{Key: []byte("old key"), TTL: time.Hour}
+	valid := s.Sign("alice", now.Add(time.Hour))
+	tests := []struct {
+		name    string
+		s       *Sessions
+		value   string
+		now     time.Time
+		wantID  string
+		wantErr bool
+	}{
+		{"valid", s, valid, now, "alice", false},
+		{"expired token replayed", s, valid, now.Add(time.Hour), "", true},
+		{"rotated key", &Sessions{Key: []byte("new key")}, valid, now, "", true},
+		{"tampered user", s, strings.Replace(valid, valid[:4], "Ym9i", 1), now, "", true},
+		{"no signature", s, "YWxpY2V8MTcwNDExMDQwMA", now, "", true},
+		{"garbage", s, "!!!.???", now, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, err := tt.s.Verify(tt.value, tt.now)
+			if (err != nil) != tt.wantErr || id != tt.wantID {
+				t.Errorf("Verify = %q, %v; want %q, error %v", id, err, tt.wantID, tt.wantErr)
+			}
+		})
+	}
+}
+
+// newTestUsers создает users.json с пользователем alice и паролем secret.
+func newTestUsers(t *testing.T) *UserStore {
+	t.Helper()
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	users := &UserStore{Path: filepath.Join(t.TempDir(), "users.json")}
+	if err := users.Add(User{Username: "alice", PasswordHash: string(hash)}); err != nil {
+		t.Fatal(err)
+	}
+	return users
+}
+
+func TestLoginLogout(t *testing.T) {
+	s := &Sessions{Key: []byte("key"), TTL: time.Hour}
+	a := &JSONFileAuthenticator{Sessions: s, Users: newTestUsers(t)}
+	login := a.LoginHandler()
+
+	tests := []struct {
+		name       string
+		password   string
+		wantStatus int
+		wantCookie bool
+	}{
+		{"good password", "secret", http.StatusFound, true},
+		{"bad password", "wrong", http.StatusUnauthorized, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{"username": {"alice"}, "password": {tt.password}}
+			r := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(form.Encode()))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			w := httptest.NewRecorder()
+			login.ServeHTTP(w, r)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			cookies := w.Result().Cookies()
+			if got := len(cookies) == 1 && cookies[0].Name == sessionCookie; got != tt.wantCookie {
+				t.Fatalf("session cookie set = %v, want %v", got, tt.wantCookie)
+			}
+			if !tt.wantCookie {
+				return
+			}
+			r = httptest.NewRequest(http.MethodGet, "/", nil)
+			r.AddCookie(cookies[0])
+			if u, err := a.Authenticate(r); err != nil || u.Username != "alice" {
+				t.Errorf("Authenticate = %v, %v; want alice", u, err)
+			}
+		})
+	}
+
+	w := httptest.NewRecorder()
+	a.LogoutHandler().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/logout", nil))
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Value != "" || cookies[0].MaxAge >= 0 {
+		t.Errorf("logout cookies = %v, want a cleared session cookie", cookies)
+	}
+}
+
+// Для неизвестного имени Authenticate возвращает ту же ошибку, что
+// и для неверного пароля, и сверяет пароль с хешем той же стоимости,
+// что у зарегистрированных пользователей.
+func TestAuthenticateUnknownUser(t *testing.T) {
+	users := newTestUsers(t)
+	for _, name := range []string{"alice", "mallory"} {
+		if u, err := users.Authenticate(name, "wrong"); err != errUnknownUser {
+			t.Errorf("Authenticate(%q, wrong) = %v, %v; want errUnknownUser", name, u, err)
+		}
+	}
+	if cost, err := bcrypt.Cost(dummyPasswordHash()); err != nil || cost != registerBcryptCost {
+		t.Errorf("dummy hash cost = %d, %v; want %d", cost, err, registerBcryptCost)
+	}
+}
+
+// Форма входа несет CSRF-токен, и без него вход не принимается.
+func TestLoginRequiresCSRFToken(t *testing.T) {
+	s := &Sessions{Key: []byte("key"), TTL: time.Hour}
+	a := &JSONFileAuthenticator{Sessions: s, Users: newTestUsers(t)}
+	h := csrfMiddleware([]byte("secret"))(a.LoginHandler())
+	nonce, page := csrfForm(t, h, nil)
+	m := regexp.MustCompile(`name="` + csrfField + `" value="([0-9a-f]+)"`).FindStringSubmatch(page)
+	if m == nil {
+		t.Fatalf("login form has no %s field:\n%s", csrfField, page)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		want  int
+	}{
+		{"valid token", m[1], http.StatusFound},
+		{"no token", "", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{"username": {"alice"}, "password": {"secret"}}
+			if tt.token != "" {
+				form.Set(csrfField, tt.token)
+			}
+			r := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(form.Encode()))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			r.AddCookie(nonce)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d", w.Code, tt.want)
+			}
+			for _, c := range w.Result().Cookies() {
+				if c.Name == sessionCookie && tt.want != http.StatusFound {
+					t.Errorf("rejected login set the session cookie")
+				}
+			}
+		})
+	}
+}
+
+func TestAuthMiddlewareRedirectsToLogin(t *testing.T) {
+	s := &Sessions{Key: []byte("key"), TTL: time.Hour}
+	a := &JSONFileAuthenticator{Sessions: s, Users: newTestUsers(t)}
+	h := authMiddleware(a)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(userFromContext(r.Context()).Username))
+	}))
+	tests := []struct {
+		name       string
+		cookie     string
+		wantStatus int
+	}{
+		{"no cookie", "", http.StatusFound},
+		{"valid session", s.Sign("alice", time.Now().Add(time.Hour)), http.StatusOK},
+		{"expired session", s.Sign("alice", time.Now().Add(-time.Second)), http.StatusFound},
+		{"unknown user", s.Sign("bob", time.Now().Add(time.Hour)), http.StatusFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/edit/Foo", nil)
+			if tt.cookie != "" {
+				r.AddCookie(&http.Cookie{Name: sessionCookie, Value: tt.cookie})
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if w.Code == http.StatusFound && w.Header().Get("Location") != "/login" {
+				t.Errorf("Location = %q, want /login", w.Header().Get("Location"))
+			}
+		})
+	}
+}
+
+// headerAuthenticator - Authenticator для теста: автор запроса -
+// значение заголовка X-Test-User. Так выглядел бы, например, вход
+// через прокси с единым входом.
+type headerAuthenticator struct{}
+
+func (headerAuthenticator) Authenticate(r *http.Request) (*User, error) {
+	if name := r.Header.Get("X-Test-User"); name != "" {
+		return &User{Username: name}, nil
+	}
+	return nil, errNotAuthenticated
+}
+
+func (headerAuthenticator) LoginHandler() http.Handler  { return http.NotFoundHandler() }
+func (headerAuthenticator) LogoutHandler() http.Handler { return http.NotFoundHandler() }
+
+// Поведение authMiddleware меняется заменой Authenticator, без
+// изменений в самом middleware.
+func TestAuthMiddlewareAuthenticators(t *testing.T) {
+	s := &Sessions{Key: []byte("key"), TTL: time.Hour}
+	jsonAuth := &JSONFileAuthenticator{Sessions: s, Users: newTestUsers(t)}
+	basicAuth, err := newBasicAuthenticator("admin", "pass", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	session := &http.Cookie{Name: sessionCookie, Value: s.Sign("alice", time.Now().Add(time.Hour))}
+	tests := []struct {
+		name       string
+		auth       Authenticator
+		prepare    func(r *http.Request)
+		wantStatus int
+		wantUser   string
+	}{
+		{"json: session cookie", jsonAuth, func(r *http.Request) { r.AddCookie(session) }, http.StatusOK, "alice"},
+		{"json: basic credentials", jsonAuth, func(r *http.Request) { r.SetBasicAuth("admin", "pass") }, http.StatusFound, ""},
+		{"basic: credentials", basicAuth, func(r *http.Request) { r.SetBasicAuth("admin", "pass") }, http.StatusOK, "admin"},
+		{"basic: wrong password", basicAuth, func(r *http.Request) { r.SetBasicAuth("admin", "nope") }, http.StatusUnauthorized, ""},
+		{"basic: session cookie", basicAuth, func(r *http.Request) { r.AddCookie(session) }, http.StatusUnauthorized, ""},
+		{"header: header", headerAuthenticator{}, func(r *http.Request) { r.Header.Set("X-Test-User", "carol") }, http.StatusOK, "carol"},
+		{"header: session cookie", headerAuthenticator{}, func(r *http.Request) { r.AddCookie(session) }, http.StatusUnauthorized, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := authMiddleware(tt.auth)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(userFromContext(r.Context()).Username))
+			}))
+			r := httptest.NewRequest(http.MethodGet, "/edit/Foo", nil)
+			tt.prepare(r)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if tt.wantUser != "" && w.Body.String() != tt.wantUser {
+				t.Errorf("user = %q, want %q", w.Body.String(), tt.wantUser)
+			}
+		})
+	}
+}
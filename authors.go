@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// editorName возвращает имя вошедшего автора запроса r для
+// Page.LastEditor или "", если запрос анонимный.
+func editorName(r *http.Request) string {
+	if u := userFromContext(r.Context()); u != nil {
+		return u.Username
+	}
+	return ""
+}
+
+// pagesByAuthor просматривает файлы *.meta.json в каталоге dataDir
+// и возвращает метаданные страниц, которые первым сохранил username,
+// от новых к старым по CreatedAt. Title в результате заполнен.
+func pagesByAuthor(dataDir, username string) ([]PageMeta, error) {
+	files, err := filepath.Glob(filepath.Join(dataDir, "*"+metaSuffix))
+	if err != nil {
+		return nil, err
+	}
+	var list []PageMeta
+	for _, f := range files {
+		title := normalizeTitle(strings.TrimSuffix(filepath.Base(f), metaSuffix))
+		if !validTitle.MatchString(title) {
+			continue
+		}
+		data, err := ioutil.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		m := PageMeta{Public: true}
+		if err := json.Unmarshal(data, &m); err != nil {
+			return nil, err
+		}
+		if m.OriginalAuthor == username {
+			m.Title = title
+			list = append(list, m)
+		}
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		if !list[i].CreatedAt.Equal(list[j].CreatedAt) {
+			return list[i].CreatedAt.After(list[j].CreatedAt)
+		}
+		return list[i].Title < list[j].Title
+	})
+	return list, nil
+}
+
+// authorPage - строка списка /users/{username}/pages.
+type authorPage struct {
+	Title     string    `json:"title"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+var authorPagesPath = regexp.MustCompile(`^/users/([^/]+)/pages$`)
+
+// authorPagesHandler показывает на /users/{username}/pages страницы,
+// которые создал username, - в HTML или, если клиент просит, в JSON.
+// Как и в указателе тегов, в список попадают только существующие
+// (не удаленные в корзину) страницы, видимые автору запроса.
+func authorPagesHandler(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet, http.MethodHead) {
+		return
+	}
+	m := authorPagesPath.FindStringSubmatch(r.URL.Path)
+	if m == nil {
+		notFoundHandler(w, r)
+		return
+	}
+	username := m[1]
+	metaList, err := pagesByAuthor(metas.Dir, username)
+	if err != nil {
+		errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	titles, err := store.List()
+	if err == nil {
+		titles, err = visibleTitles(r, titles)
+	}
+	if err != nil {
+		errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	visible := make(map[string]bool, len(titles))
+	for _, t := range titles {
+		visible[t] = true
+	}
+	list := []authorPage{}
+	for _, pm := range metaList {
+		if visible[pm.Title] {
+			list = append(list, authorPage{Title: pm.Title, CreatedAt: pm.CreatedAt.UTC().Truncate(time.Second)})
+		}
+	}
+	w.Header().Add("Vary", "Accept")
+	if wantsJSON(r) {
+		writeJSON(w, http.StatusOK, list)
+		return
+	}
+	renderTemplate(w, "author", struct {
+		Username string
+		Pages    []authorPage
+	}{username, list})
+}
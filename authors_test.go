@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// saveAs сохраняет страницу через форму /save/ от имени username.
+func saveAs(t *testing.T, username, title, body string) {
+	t.Helper()
+	r := httptest.NewRequest(http.MethodPost, "/save/"+title, strings.NewReader(url.Values{"body": {body}}.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r = r.WithContext(context.WithValue(r.Context(), userContextKey, &User{Username: username}))
+	w := httptest.NewRecorder()
+	makeHandler(saveHandler)(w, r)
+	if w.Code != http.StatusFound {
+		t.Fatalf("save of %s by %s: status = %d", title, username, w.Code)
+	}
+}
+
+func TestAuthorship(t *testing.T) {
+	testDataDir(t)
+	store = timestampStorage{store}
+	saveAs(t, "alice", "Foo", "v1")
+	saveAs(t, "bob", "Foo", "v2")
+	saveAs(t, "bob", "Bar", "bar")
+	saveAs(t, "alice", "Baz", "baz")
+	saveAs(t, "carol", "Foo", "v3")
+	saveAs(t, "alice", "Secret", "hidden")
+	for title, created := range map[string]time.Time{
+		"Foo":    time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		"Baz":    time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC),
+		"Secret": time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC),
+	} {
+		if err := metas.Update(title, func(m *PageMeta) { m.CreatedAt = created; m.Public = title != "Secret" }); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// original_author не меняется при следующих правках.
+	w := serve(apiGetPage, http.MethodGet, "/api/v1/pages/Foo", "")
+	var p struct {
+		OriginalAuthor string `json:"original_author"`
+		LastEditor     string `json:"last_editor"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&p); err != nil {
+		t.Fatal(err)
+	}
+	if p.OriginalAuthor != "alice" || p.LastEditor != "carol" {
+		t.Errorf("Foo authors = %+v, want original alice and last carol", p)
+	}
+	w = serve(makeHandler(pageResourceHandler), http.MethodGet, "/view/Foo", "")
+	for _, want := range []string{"alice", "carol"} {
+		if !strings.Contains(w.Body.String(), want) {
+			t.Errorf("view of Foo does not show %s:\n%s", want, w.Body)
+		}
+	}
+
+	metaList, err := pagesByAuthor(metas.Dir, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var titles []string
+	for _, m := range metaList {
+		titles = append(titles, m.Title)
+	}
+	if got := strings.Join(titles, ","); got != "Baz,Secret,Foo" {
+		t.Errorf("pagesByAuthor(alice) = %s, want Baz,Secret,Foo", got)
+	}
+
+	tests := []struct {
+		user, want string
+	}{
+		{"alice", "Baz,Foo"},
+		{"bob", "Bar"},
+		{"carol", ""},
+		{"nobody", ""},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/users/"+tt.user+"/pages", nil)
+		r.Header.Set("Accept", "application/json")
+		w := httptest.NewRecorder()
+		authorPagesHandler(w, r)
+		var list []authorPage
+		if err := json.NewDecoder(w.Body).Decode(&list); err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, p := range list {
+			got = append(got, p.Title)
+		}
+		if strings.Join(got, ",") != tt.want {
+			t.Errorf("/users/%s/pages = %v, want %s", tt.user, got, tt.want)
+		}
+	}
+}
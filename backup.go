@@ -0,0 +1,36 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+)
+
+// backupStorage дублирует каждую удачно сохраненную страницу в каталог
+// Dir файлом {title}.txt. Ошибка записи копии только пишется в лог:
+// страница уже сохранена в основном хранилище, и запрос не должен из-за
+// копии завершаться ошибкой.
+type backupStorage struct {
+	Storage
+	Dir string
+}
+
+// NewBackupStorage оборачивает s копированием в каталог dir, создавая
+// его при необходимости.
+func NewBackupStorage(s Storage, dir string) (backupStorage, error) {
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return backupStorage{}, err
+	}
+	return backupStorage{Storage: s, Dir: dir}, nil
+}
+
+func (s backupStorage) Save(p *Page) error {
+	if err := s.Storage.Save(p); err != nil {
+		return err
+	}
+	filename := filepath.Join(s.Dir, normalizeTitle(p.Title)+".txt")
+	if err := writeFileAtomic(filename, p.Body, pageFileMode); err != nil {
+		slog.Error("ошибка резервной копии", "title", p.Title, "dir", s.Dir, "err", err)
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBackupStorage(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		breakDir   bool // на месте каталога копий файл, писать туда нельзя
+		wantErr    bool
+		wantBackup bool
+	}{
+		{"both copies written", "hello", false, false, true},
+		{"backup failure does not fail the save", "hello", true, false, false},
+		{"failed save is not backed up", strings.Repeat("x", int(maxPageSize)+1), false, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := testDataDir(t)
+			backupDir := filepath.Join(t.TempDir(), "backup", "pages")
+			s, err := NewBackupStorage(store, backupDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info, err := os.Stat(backupDir); err != nil || !info.IsDir() {
+				t.Fatalf("backup directory was not created: %v", err)
+			}
+			if tt.breakDir {
+				if err := os.RemoveAll(backupDir); err != nil {
+					t.Fatal(err)
+				}
+				if err := ioutil.WriteFile(backupDir, nil, 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			err = s.Save(&Page{Title: "Foo", Body: []byte(tt.body)})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Save error = %v, want error %v", err, tt.wantErr)
+			}
+			if data, err := ioutil.ReadFile(filepath.Join(dir, "Foo.txt")); !tt.wantErr && (err != nil || string(data) != tt.body) {
+				t.Errorf("primary file = %q, %v; want %q", data, err, tt.body)
+			}
+			data, err := ioutil.ReadFile(filepath.Join(backupDir, "Foo.txt"))
+			if tt.wantBackup && (err != nil || string(data) != tt.body) {
+				t.Errorf("backup file = %q, %v; want %q", data, err, tt.body)
+			}
+			if !tt.wantBackup && err == nil {
+				t.Error("backup file exists, want none")
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"container/list"
+	"net/http"
+	"sync"
+)
+
+// CachedStorage - LRU-кэш страниц поверх любого Storage. Load сначала
+// ищет страницу в кэше, Save, Delete и Rename удаляют ее из кэша, так что
+// следующее чтение снова идет в хранилище.
+type CachedStorage struct {
+	Storage
+
+	mu     sync.Mutex
+	size   int
+	order  *list.List               // элементы *Page, самые свежие в начале
+	items  map[string]*list.Element // заголовок -> элемент order
+	hits   uint64
+	misses uint64
+	// evictions растет при каждом удалении из кэша. Load не кладет
+	// в кэш страницу, прочитанную, пока ее могли изменить.
+	evictions uint64
+}
+
+// CacheStats - счетчики кэша для /api/v1/cache/stats.
+type CacheStats struct {
+	Hits   uint64 `json:"hits"`
+	Misses uint64 `json:"misses"`
+	Size   int    `json:"size"`
+}
+
+// NewCachedStorage оборачивает s кэшем на size страниц.
+func NewCachedStorage(s Storage, size int) *CachedStorage {
+	return &CachedStorage{
+		Storage: s,
+		size:    size,
+		order:   list.New(),
+		items:   make(map[string]*list.Element),
+	}
+}
+
+func (c *CachedStorage) Load(title string) (*Page, error) {
+	c.mu.Lock()
+	if e, ok := c.items[title]; ok {
+		c.order.MoveToFront(e)
+		c.hits++
+		p := *e.Value.(*Page)
+		c.mu.Unlock()
+		return &p, nil
+	}
+	c.misses++
+	gen := c.evictions
+	c.mu.Unlock()
+
+	p, err := c.Storage.Load(title)
+	if err != nil {
+		return nil, err
+	}
+	c.add(p, gen)
+	return p, nil
+}
+
+// add кладет копию страницы в кэш и при переполнении вытесняет
+// страницу, которую дольше всех не читали. Если с момента gen
+// из кэша что-то удалялось, страница могла измениться, пока ее
+// читали из хранилища, и в кэш она не попадает.
+func (c *CachedStorage) add(p *Page, gen uint64) {
+	cp := *p
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.evictions != gen {
+		return
+	}
+	if e, ok := c.items[p.Title]; ok {
+		e.Value = &cp
+		c.order.MoveToFront(e)
+		return
+	}
+	c.items[p.Title] = c.order.PushFront(&cp)
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*Page).Title)
+	}
+}
+
+func (c *CachedStorage) evict(title string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.evictions++
+	if e, ok := c.items[title]; ok {
+		c.order.Remove(e)
+		delete(c.items, title)
+	}
+}
+
+func (c *CachedStorage) Save(p *Page) error {
+	err := c.Storage.Save(p)
+	c.evict(p.Title)
+	return err
+}
+
+func (c *CachedStorage) Delete(title string) error {
+	err := c.Storage.Delete(title)
+	c.evict(title)
+	return err
+}
+
+func (c *CachedStorage) Rename(oldTitle, newTitle string) error {
+	err := c.Storage.Rename(oldTitle, newTitle)
+	c.evict(oldTitle)
+	c.evict(newTitle)
+	return err
+}
+
+// Stats возвращает текущие счетчики кэша.
+func (c *CachedStorage) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return CacheStats{Hits: c.hits, Misses: c.misses, Size: c.order.Len()}
+}
+
+// Функция cacheStatsHandler отдает статистику кэша в JSON.
+func cacheStatsHandler(c *CachedStorage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, c.Stats())
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"testing"
+)
+
+// memStorage - хранилище страниц в памяти для тестов. loads считает
+// обращения к Load.
+type memStorage struct {
+	pages map[string][]byte
+	loads int
+}
+
+func newMemStorage(titles ...string) *memStorage {
+	s := &memStorage{pages: make(map[string][]byte)}
+	for _, t := range titles {
+		s.pages[t] = []byte("text of " + t)
+	}
+	return s
+}
+
+func (s *memStorage) Load(title string) (*Page, error) {
+	s.loads++
+	body, ok := s.pages[title]
+	if !ok {
+		return nil, fmt.Errorf("page %q: %w", title, os.ErrNotExist)
+	}
+	return &Page{Title: title, Body: body}, nil
+}
+
+func (s *memStorage) Save(p *Page) error {
+	if _, ok := s.pages[p.Title]; ok && p.Create {
+		return errPageExists
+	}
+	s.pages[p.Title] = p.Body
+	return nil
+}
+
+func (s *memStorage) List() ([]string, error) {
+	var titles []string
+	for t := range s.pages {
+		titles = append(titles, t)
+	}
+	return titles, nil
+}
+
+func (s *memStorage) Delete(title string) error {
+	delete(s.pages, title)
+	return nil
+}
+
+func (s *memStorage) Rename(oldTitle, newTitle string) error {
+	s.pages[newTitle] = s.pages[oldTitle]
+	delete(s.pages, oldTitle)
+	return nil
+}
+
+func (s *memStorage) Health() error { return nil }
+
+func TestCachedStorage(t *testing.T) {
+	tests := []struct {
+		name      string
+		size      int
+		ops       func(c *CachedStorage)
+		load      string // что прочитать последним
+		wantLoads int    // обращений к хранилищу за весь тест
+		wantStats CacheStats
+	}{
+		{
+			name:      "second load hits",
+			size:      2,
+			ops:       func(c *CachedStorage) { c.Load("A") },
+			load:      "A",
+			wantLoads: 1,
+			wantStats: CacheStats{Hits: 1, Misses: 1, Size: 1},
+		},
+		{
+			name: "save evicts",
+			size: 2,
+			ops: func(c *CachedStorage) {
+				c.Load("A")
+				c.Save(&Page{Title: "A", Body: []byte("new")})
+			},
+			load:      "A",
+			wantLoads: 2,
+			wantStats: CacheStats{Hits: 0, Misses: 2, Size: 1},
+		},
+		{
+			name: "least recently used is evicted",
+			size: 2,
+			ops: func(c *CachedStorage) {
+				c.Load("A")
+				c.Load("B")
+				c.Load("A") // B теперь читали давнее всех
+				c.Load("C")
+			},
+			load:      "B",
+			wantLoads: 4,
+			wantStats: CacheStats{Hits: 1, Misses: 4, Size: 2},
+		},
+		{
+			name: "recently used survives",
+			size: 2,
+			ops: func(c *CachedStorage) {
+				c.Load("A")
+				c.Load("B")
+				c.Load("A")
+				c.Load("C")
+			},
+			load:      "A",
+			wantLoads: 3,
+			wantStats: CacheStats{Hits: 2, Misses: 3, Size: 2},
+		},
+		{
+			name: "delete and rename evict",
+			size: 3,
+			ops: func(c *CachedStorage) {
+				c.Load("A")
+				c.Load("B")
+				c.Delete("A")
+				c.Rename("B", "A")
+			},
+			load:      "A",
+			wantLoads: 3,
+			wantStats: CacheStats{Hits: 0, Misses: 3, Size: 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newMemStorage("A", "B", "C")
+			c := NewCachedStorage(s, tt.size)
+			tt.ops(c)
+			if _, err := c.Load(tt.load); err != nil {
+				t.Fatal(err)
+			}
+			if s.loads != tt.wantLoads {
+				t.Errorf("storage loads = %d, want %d", s.loads, tt.wantLoads)
+			}
+			if got := c.Stats(); got != tt.wantStats {
+				t.Errorf("Stats = %+v, want %+v", got, tt.wantStats)
+			}
+		})
+	}
+}
+
+// Кэш отдает копию страницы: изменение прочитанной страницы
+// не меняет страницу в кэше.
+func TestCachedStorageReturnsCopies(t *testing.T) {
+	c := NewCachedStorage(newMemStorage("A"), 1)
+	p, _ := c.Load("A")
+	p.Title = "changed"
+	p2, err := c.Load("A")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p2.Title != "A" {
+		t.Errorf("cached page title = %q, want A", p2.Title)
+	}
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Comment - комментарий пользователя к странице. Body хранится как
+// есть и экранируется при выводе: html/template в view.html,
+// encoding/json в API.
+type Comment struct {
+	ID        string    `json:"id"`
+	Author    string    `json:"author"`
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// maxCommentLen - наибольшая длина комментария в символах.
+const maxCommentLen = 1000
+
+var errNotCommentOwner = errors.New("only the author or an admin can delete this comment")
+
+// CommentStore хранит комментарии каждой страницы в файле
+// Dir/<title>.json - JSON-массиве от старых к новым. Файл читается
+// и переписывается под блокировкой страницы, так что одновременные
+// комментарии не теряются.
+type CommentStore struct {
+	Dir string
+}
+
+var comments = &CommentStore{Dir: "comments"}
+
+// newCommentID возвращает случайный идентификатор комментария:
+// 16 шестнадцатеричных цифр.
+func newCommentID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func (s *CommentStore) path(title string) string {
+	return filepath.Join(s.Dir, title+".json")
+}
+
+// lockKey отделяет блокировку комментариев от блокировки самой
+// страницы: сохранение страницы не должно ждать комментариев.
+func (s *CommentStore) lockKey(title string) string {
+	return "comments/" + title
+}
+
+func (s *CommentStore) load(title string) ([]Comment, error) {
+	data, err := ioutil.ReadFile(s.path(title))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var list []Comment
+	return list, json.Unmarshal(data, &list)
+}
+
+func (s *CommentStore) store(title string, list []Comment) error {
+	data, err := json.Marshal(list)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(s.Dir, 0700); err != nil {
+		return err
+	}
+	return writeFileAtomic(s.path(title), data, 0600)
+}
+
+// List возвращает комментарии страницы title от старых к новым.
+func (s *CommentStore) List(title string) ([]Comment, error) {
+	var list []Comment
+	err := withPageRLock(s.lockKey(title), func() error {
+		var err error
+		list, err = s.load(title)
+		return err
+	})
+	return list, err
+}
+
+// Add добавляет к странице title комментарий author и возвращает его.
+func (s *CommentStore) Add(title, author, body string) (*Comment, error) {
+	id, err := newCommentID()
+	if err != nil {
+		return nil, err
+	}
+	c := &Comment{ID: id, Author: author, Body: body, CreatedAt: time.Now()}
+	err = withPageLock(s.lockKey(title), func() error {
+		list, err := s.load(title)
+		if err != nil {
+			return err
+		}
+		return s.store(title, append(list, *c))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Rename переносит комментарии страницы oldTitle к newTitle.
+// Комментарии, оставшиеся от удаленной страницы newTitle, удаляются:
+// иначе переименованная страница получила бы чужие.
+func (s *CommentStore) Rename(oldTitle, newTitle string) error {
+	return withPageLocks(s.lockKey(oldTitle), s.lockKey(newTitle), func() error {
+		if err := os.Remove(s.path(newTitle)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		err := os.Rename(s.path(oldTitle), s.path(newTitle))
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	})
+}
+
+// Delete удаляет комментарий id страницы title. Удалить комментарий
+// может только его автор user или администратор; иначе возвращается
+// errNotCommentOwner. Для неизвестного id - os.ErrNotExist.
+func (s *CommentStore) Delete(title, id string, user *User) error {
+	return withPageLock(s.lockKey(title), func() error {
+		list, err := s.load(title)
+		if err != nil {
+			return err
+		}
+		for i := range list {
+			if list[i].ID != id {
+				continue
+			}
+			if list[i].Author != user.Username && !isAdmin(user) {
+				return errNotCommentOwner
+			}
+			return s.store(title, append(list[:i], list[i+1:]...))
+		}
+		return os.ErrNotExist
+	})
+}
+
+var apiCommentsPath = regexp.MustCompile(`^/api/v1/pages/(` + titleChars + `)/comments$`)
+var apiCommentPath = regexp.MustCompile(`^/api/v1/pages/(` + titleChars + `)/comments/([0-9a-f]+)$`)
+
+// apiCommentsHandler обслуживает комментарии страницы:
+// GET /api/v1/pages/{title}/comments отдает их списком, POST туда же
+// с телом {"body":"..."} добавляет новый от имени текущего пользователя,
+// DELETE /api/v1/pages/{title}/comments/{id} удаляет один.
+// POST и DELETE пропускаются через protect.
+func apiCommentsHandler(protect func(http.Handler) http.Handler) http.Handler {
+	post := protect(http.HandlerFunc(apiPostComment))
+	del := protect(http.HandlerFunc(apiDeleteComment))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if apiCommentPath.MatchString(r.URL.Path) {
+			if r.Method != http.MethodDelete {
+				w.Header().Set("Allow", "DELETE")
+				writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+				return
+			}
+			del.ServeHTTP(w, r)
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			apiListComments(w, r)
+		case http.MethodPost:
+			post.ServeHTTP(w, r)
+		default:
+			w.Header().Set("Allow", "GET, POST")
+			writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		}
+	})
+}
+
+func apiListComments(w http.ResponseWriter, r *http.Request) {
+	m := apiCommentsPath.FindStringSubmatch(r.URL.Path)
+	if ok, err := canRead(r, m[1]); err != nil || !ok {
+		if err != nil {
+			serverError(w, err)
+		} else {
+			writeJSONError(w, http.StatusUnauthorized, "authentication required")
+		}
+		return
+	}
+	list, err := comments.List(m[1])
+	if err != nil {
+		serverError(w, err)
+		return
+	}
+	if list == nil {
+		list = []Comment{}
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+func apiPostComment(w http.ResponseWriter, r *http.Request) {
+	m := apiCommentsPath.FindStringSubmatch(r.URL.Path)
+	var req struct {
+		Body string `json:"body"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "malformed JSON: "+err.Error())
+		return
+	}
+	req.Body = strings.TrimSpace(req.Body)
+	if req.Body == "" {
+		writeJSONError(w, http.StatusBadRequest, "empty comment")
+		return
+	}
+	if utf8.RuneCountInString(req.Body) > maxCommentLen {
+		writeJSONError(w, http.StatusBadRequest, "comment is too long")
+		return
+	}
+	if _, err := store.Load(m[1]); errors.Is(err, os.ErrNotExist) {
+		writeJSONError(w, http.StatusNotFound, "page not found")
+		return
+	}
+	c, err := comments.Add(m[1], userFromContext(r.Context()).Username, req.Body)
+	if err != nil {
+		serverError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, c)
+}
+
+func apiDeleteComment(w http.ResponseWriter, r *http.Request) {
+	m := apiCommentPath.FindStringSubmatch(r.URL.Path)
+	err := comments.Delete(m[1], m[2], userFromContext(r.Context()))
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		writeJSONError(w, http.StatusNotFound, "comment not found")
+	case err == errNotCommentOwner:
+		writeJSONError(w, http.StatusForbidden, err.Error())
+	case err != nil:
+		serverError(w, err)
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// serveAs выполняет запрос к h от имени пользователя username.
+func serveAs(h http.Handler, username, method, target, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	r = r.WithContext(context.WithValue(r.Context(), userContextKey, &User{Username: username}))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+var noProtect = func(h http.Handler) http.Handler { return h }
+
+// Одновременные комментарии к одной странице не теряются и не
+// портят файл comments/{title}.json.
+func TestConcurrentComments(t *testing.T) {
+	dir := testDataDir(t)
+	savePage(t, "Foo", "foo")
+	h := apiCommentsHandler(noProtect)
+	const n = 50
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			body := fmt.Sprintf(`{"body":"comment %d"}`, i)
+			if w := serveAs(h, "alice", http.MethodPost, "/api/v1/pages/Foo/comments", body); w.Code != http.StatusCreated {
+				t.Errorf("POST status = %d: %s", w.Code, w.Body)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "comments", "Foo.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var list []Comment
+	if err := json.Unmarshal(data, &list); err != nil {
+		t.Fatalf("comments file is corrupt: %v", err)
+	}
+	ids, bodies := map[string]bool{}, map[string]bool{}
+	for _, c := range list {
+		ids[c.ID], bodies[c.Body] = true, true
+	}
+	if len(list) != n || len(ids) != n || len(bodies) != n {
+		t.Errorf("%d comments with %d distinct ids and %d distinct bodies, want %d", len(list), len(ids), len(bodies), n)
+	}
+}
+
+func TestCommentsAPI(t *testing.T) {
+	testDataDir(t)
+	oldAdmins := adminUsers
+	adminUsers = []string{"boss"}
+	t.Cleanup(func() { adminUsers = oldAdmins })
+	savePage(t, "Foo", "foo")
+	h := apiCommentsHandler(noProtect)
+
+	tests := []struct {
+		name, user, body string
+		want             int
+	}{
+		{"created", "alice", `{"body":"<b>hi</b>"}`, http.StatusCreated},
+		{"empty", "alice", `{"body":"  "}`, http.StatusBadRequest},
+		{"at limit", "alice", `{"body":"` + strings.Repeat("я", maxCommentLen) + `"}`, http.StatusCreated},
+		{"too long", "alice", `{"body":"` + strings.Repeat("я", maxCommentLen+1) + `"}`, http.StatusBadRequest},
+		{"malformed", "alice", `{`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := serveAs(h, tt.user, http.MethodPost, "/api/v1/pages/Foo/comments", tt.body); w.Code != tt.want {
+				t.Errorf("POST status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+		})
+	}
+	if w := serveAs(h, "alice", http.MethodPost, "/api/v1/pages/Missing/comments", `{"body":"x"}`); w.Code != http.StatusNotFound {
+		t.Errorf("comment on a missing page: status = %d, want 404", w.Code)
+	}
+
+	var list []Comment
+	if err := json.NewDecoder(serveAs(h, "", http.MethodGet, "/api/v1/pages/Foo/comments", "").Body).Decode(&list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 || list[0].Author != "alice" || list[0].Body != "<b>hi</b>" {
+		t.Fatalf("comments = %+v, want two by alice", list)
+	}
+
+	del := func(user, id string) int {
+		return serveAs(h, user, http.MethodDelete, "/api/v1/pages/Foo/comments/"+id, "").Code
+	}
+	if code := del("eve", list[0].ID); code != http.StatusForbidden {
+		t.Errorf("DELETE by another user: status = %d, want 403", code)
+	}
+	if code := del("alice", list[0].ID); code != http.StatusNoContent {
+		t.Errorf("DELETE by the author: status = %d, want 204", code)
+	}
+	if code := del("alice", list[0].ID); code != http.StatusNotFound {
+		t.Errorf("second DELETE: status = %d, want 404", code)
+	}
+	if code := del("boss", list[1].ID); code != http.StatusNoContent {
+		t.Errorf("DELETE by an admin: status = %d, want 204", code)
+	}
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+// Config - настройки сервера. Значения по умолчанию берутся из
+// переменных окружения (см. defaultConfig), поверх них - из файла
+// -config, а флаги командной строки важнее и того и другого.
+type Config struct {
+	Addr         string   `json:"addr"`
+	DataDir      string   `json:"data_dir"`
+	BackupDir    string   `json:"backup_dir"`
+	StaticDir    string   `json:"static_dir"`
+	BaseURL      string   `json:"base_url"`
+	CertFile     string   `json:"cert"`
+	KeyFile      string   `json:"key"`
+	AuthBackend  string   `json:"auth"`
+	AuthUser     string   `json:"user"`
+	AuthPass     string   `json:"pass"`
+	AuthPassHash string   `json:"pass_hash"`
+	Dev          bool     `json:"dev"`
+	ReadOnly     bool     `json:"read_only"`
+	Perm         string   `json:"perm"`
+	LogFormat    string   `json:"log_format"`
+	AccessLog    string   `json:"access_log"`
+	Theme        string   `json:"theme"`
+	CacheSize    int      `json:"cache_size"`
+	RateLimit    int      `json:"rate_limit"`
+	Burst        int      `json:"burst"`
+	TrustProxy   bool     `json:"trust_proxy"`
+	Timeout      duration `json:"timeout"`
+	ReadTimeout  duration `json:"read_timeout"`
+	WriteTimeout duration `json:"write_timeout"`
+	IdleTimeout  duration `json:"idle_timeout"`
+	Backend      string   `json:"backend"`
+	TrashMaxAge  duration `json:"trash_max_age"`
+	MaxSize      int64    `json:"max_size"`
+	Register     bool     `json:"register"`
+}
+
+// duration - time.Duration, которая в JSON записывается строкой
+// вида "30s" или "1m30s".
+type duration time.Duration
+
+func (d *duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string like \"30s\": %v", err)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = duration(v)
+	return nil
+}
+
+func (d duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *duration) String() string { return time.Duration(*d).String() }
+
+func (d *duration) Set(s string) error {
+	v, err := time.ParseDuration(s)
+	*d = duration(v)
+	return err
+}
+
+// defaultConfig возвращает настройки, с которыми сервер работает
+// без файла конфигурации и флагов.
+func defaultConfig() *Config {
+	return &Config{
+		Addr:         envString("WEB_ADDR", ":8080"),
+		DataDir:      envString("WEB_DATA_DIR", "."),
+		BackupDir:    os.Getenv("WEB_BACKUP_DIR"),
+		StaticDir:    os.Getenv("WEB_STATIC_DIR"),
+		BaseURL:      os.Getenv("WEB_BASE_URL"),
+		CertFile:     os.Getenv("WEB_TLS_CERT"),
+		KeyFile:      os.Getenv("WEB_TLS_KEY"),
+		AuthBackend:  os.Getenv("WEB_AUTH_BACKEND"),
+		AuthUser:     os.Getenv("WEB_AUTH_USER"),
+		AuthPassHash: os.Getenv("WEB_AUTH_PASSWORD_HASH"),
+		Dev:          os.Getenv("WEB_ENV") == "development",
+		Perm:         "0600",
+		LogFormat:    envString("WEB_LOG_FORMAT", "text"),
+		AccessLog:    os.Getenv("WEB_ACCESS_LOG"),
+		Theme:        os.Getenv("WEB_THEME"),
+		CacheSize:    envInt("WEB_CACHE_SIZE", 128),
+		RateLimit:    envInt("WEB_RATE_RPS", 10),
+		Burst:        envInt("WEB_RATE_BURST", 20),
+		Timeout:      duration(30 * time.Second),
+		ReadTimeout:  duration(15 * time.Second),
+		WriteTimeout: duration(60 * time.Second),
+		IdleTimeout:  duration(120 * time.Second),
+		Backend:      os.Getenv("WEB_STORAGE_BACKEND"),
+		MaxSize:      int64(envInt("WEB_MAX_PAGE_SIZE", 512<<10)),
+	}
+}
+
+// loadConfig читает настройки из JSON-файла path поверх значений по
+// умолчанию. Поля, которых нет в файле, остаются по умолчанию, а если
+// нет самого файла, возвращаются настройки по умолчанию.
+func loadConfig(path string) (*Config, error) {
+	c := defaultConfig()
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, c); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return c, nil
+}
+
+// bindFlags связывает флаги fs с полями c: значения по умолчанию
+// флагов - текущие значения полей.
+func (c *Config) bindFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.Addr, "addr", c.Addr, "адрес HTTP-сервера (без TLS)")
+	fs.StringVar(&c.DataDir, "data", c.DataDir, "каталог страниц и остальных данных сервера")
+	fs.StringVar(&c.BackupDir, "backupdir", c.BackupDir, "каталог, куда дублируется каждая сохраненная страница")
+	fs.StringVar(&c.StaticDir, "static", c.StaticDir, "каталог со статическими файлами (CSS, JS, изображения) вместо встроенных")
+	fs.StringVar(&c.BaseURL, "baseurl", c.BaseURL, "внешний адрес сайта для /sitemap.xml, /robots.txt, лент и ссылок /share (по умолчанию из запроса) и для ссылок в письмах (обязателен с -register)")
+	fs.StringVar(&c.CertFile, "cert", c.CertFile, "PEM-файл сертификата TLS")
+	fs.StringVar(&c.KeyFile, "key", c.KeyFile, "PEM-файл закрытого ключа TLS")
+	fs.StringVar(&c.AuthBackend, "auth", c.AuthBackend, "способ входа: json (форма /login и users.json) или basic (Basic Auth, -user и -pass)")
+	fs.StringVar(&c.AuthUser, "user", c.AuthUser, "имя для Basic Auth (-auth basic, выбирается и без -auth, если задано имя)")
+	fs.StringVar(&c.AuthPass, "pass", c.AuthPass, "пароль для Basic Auth (или bcrypt-хеш в WEB_AUTH_PASSWORD_HASH)")
+	fs.BoolVar(&c.Dev, "dev", c.Dev, "режим разработки: перечитывать шаблоны при изменении файлов (по умолчанию при WEB_ENV=development)")
+	fs.BoolVar(&c.ReadOnly, "readonly", c.ReadOnly, "только чтение: без страниц редактирования, для несуществующих страниц - 404")
+	fs.StringVar(&c.Perm, "perm", c.Perm, "права файлов страниц (восьмеричное число)")
+	fs.StringVar(&c.LogFormat, "logformat", c.LogFormat, "формат лога: text или json")
+	fs.StringVar(&c.AccessLog, "accesslog", c.AccessLog, "файл журнала доступа в Common Log Format (- для stdout)")
+	fs.StringVar(&c.Theme, "theme", c.Theme, "тема оформления: подкаталог html/ с заменой шаблонов")
+	fs.IntVar(&c.CacheSize, "cachesize", c.CacheSize, "сколько страниц держать в LRU-кэше")
+	fs.IntVar(&c.RateLimit, "ratelimit", c.RateLimit, "запросов в секунду с одного IP-адреса")
+	fs.IntVar(&c.Burst, "burst", c.Burst, "сколько запросов с одного IP-адреса можно сделать подряд")
+	fs.BoolVar(&c.TrustProxy, "trustproxy", c.TrustProxy, "брать IP клиента из X-Forwarded-For (только за обратным прокси)")
+	fs.Var(&c.Timeout, "timeout", "наибольшее время обработки одного запроса")
+	fs.Var(&c.ReadTimeout, "readtimeout", "наибольшее время чтения запроса")
+	fs.Var(&c.WriteTimeout, "writetimeout", "наибольшее время записи ответа")
+	fs.Var(&c.IdleTimeout, "idletimeout", "сколько держать простаивающее keep-alive соединение")
+	fs.Var(&c.TrashMaxAge, "trashmaxage", "через сколько удалять страницы из корзины окончательно (0 - никогда; только для -backend file)")
+	fs.StringVar(&c.Backend, "backend", c.Backend, "хранилище страниц: file или sqlite")
+	fs.Int64Var(&c.MaxSize, "maxsize", c.MaxSize, "наибольший размер сохраняемой страницы в байтах")
+	fs.BoolVar(&c.Register, "register", c.Register, "открыть регистрацию читателей через /register (нужны -auth json, WEB_SMTP_HOST и -baseurl)")
+}
+
+// parseConfig разбирает флаги args и файл конфигурации из флага
+// -config (по умолчанию WEB_CONFIG или config.json). Флаги, заданные
+// явно, перекрывают значения из файла.
+func parseConfig(fs *flag.FlagSet, args []string) (*Config, error) {
+	path := fs.String("config", envString("WEB_CONFIG", "config.json"), "JSON-файл с настройками сервера")
+	c := defaultConfig()
+	c.bindFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	explicit := make(map[string]string)
+	fs.Visit(func(f *flag.Flag) { explicit[f.Name] = f.Value.String() })
+	fileConfig, err := loadConfig(*path)
+	if err != nil {
+		return nil, err
+	}
+	*c = *fileConfig
+	for name, value := range explicit {
+		if err := fs.Set(name, value); err != nil {
+			return nil, err
+		}
+	}
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// validate проверяет числовые настройки, которые пришли из файла или
+// флагов в обход envInt: отрицательный размер кэша или нулевой лимит
+// запросов сломали бы сервер не при старте, а на первых запросах.
+func (c *Config) validate() error {
+	switch {
+	case c.CacheSize < 0:
+		return fmt.Errorf("cache size must not be negative: %d", c.CacheSize)
+	case c.RateLimit < 1:
+		return fmt.Errorf("rate limit must be positive: %d", c.RateLimit)
+	case c.Burst < 1:
+		return fmt.Errorf("burst must be positive: %d", c.Burst)
+	case c.MaxSize < 1:
+		return fmt.Errorf("max page size must be positive: %d", c.MaxSize)
+	case c.Timeout <= 0:
+		return fmt.Errorf("timeout must be positive: %s", &c.Timeout)
+	case c.ReadTimeout < 0, c.WriteTimeout < 0, c.IdleTimeout < 0:
+		return errors.New("server timeouts must not be negative")
+	case c.TrashMaxAge < 0:
+		return fmt.Errorf("trash max age must not be negative: %s", &c.TrashMaxAge)
+	case c.TrashMaxAge > 0 && !c.softDelete():
+		return fmt.Errorf("trash max age needs the file backend: %s deletes pages without a trash", c.Backend)
+	}
+	return nil
+}
+
+// softDelete сообщает, попадают ли удаленные страницы в корзину:
+// так удаляет только файловое хранилище, SQLite стирает их сразу.
+func (c *Config) softDelete() bool {
+	return c.Backend == "" || c.Backend == "file"
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseConfigValidatesLimits(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string // содержимое -config, "" - файла нет
+		args    []string
+		wantErr bool
+	}{
+		{name: "defaults"},
+		{name: "zero cache size", args: []string{"-cachesize=0"}},
+		{name: "negative cache size", args: []string{"-cachesize=-1"}, wantErr: true},
+		{name: "negative cache size in file", file: `{"cache_size":-5}`, wantErr: true},
+		{name: "flag fixes the file", file: `{"cache_size":-5}`, args: []string{"-cachesize=10"}},
+		{name: "zero rate limit", args: []string{"-ratelimit=0"}, wantErr: true},
+		{name: "zero burst", args: []string{"-burst=0"}, wantErr: true},
+		{name: "zero max size", args: []string{"-maxsize=0"}, wantErr: true},
+		{name: "zero timeout", args: []string{"-timeout=0s"}, wantErr: true},
+		{name: "negative read timeout", args: []string{"-readtimeout=-1s"}, wantErr: true},
+		{name: "no idle timeout", args: []string{"-idletimeout=0s"}},
+		{name: "negative trash max age", file: `{"trash_max_age":"-1h"}`, wantErr: true},
+		{name: "trash max age with files", args: []string{"-backend=file", "-trashmaxage=720h"}},
+		{name: "trash max age with sqlite", args: []string{"-backend=sqlite", "-trashmaxage=720h"}, wantErr: true},
+		{name: "sqlite keeps pages forever", args: []string{"-backend=sqlite"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.json")
+			if tt.file != "" {
+				if err := ioutil.WriteFile(path, []byte(tt.file), 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			fs := flag.NewFlagSet("web_server", flag.ContinueOnError)
+			_, err := parseConfig(fs, append([]string{"-config", path}, tt.args...))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseConfig(%v) error = %v, want error %v", tt.args, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// Переменные окружения задают значения по умолчанию, файл -config их
+// перекрывает, а флаги командной строки перекрывают и то и другое.
+func TestParseConfigPrecedence(t *testing.T) {
+	t.Setenv("WEB_ADDR", ":1001")
+	t.Setenv("WEB_DATA_DIR", "/env")
+	t.Setenv("WEB_THEME", "env")
+	t.Setenv("WEB_CACHE_SIZE", "1")
+	tests := []struct {
+		name      string
+		file      string
+		args      []string
+		wantAddr  string
+		wantData  string
+		wantTheme string
+		wantCache int
+	}{
+		{"environment only", "", nil, ":1001", "/env", "env", 1},
+		{"file over environment", `{"addr":":2002","theme":"file","cache_size":2}`, nil, ":2002", "/env", "file", 2},
+		{"flag over file", `{"addr":":2002","theme":"file","cache_size":2}`, []string{"-addr=:3003", "-cachesize=3"}, ":3003", "/env", "file", 3},
+		{"flag over environment", "", []string{"-data=/flag", "-theme=flag"}, ":1001", "/flag", "flag", 1},
+		{"flag equal to the default still wins", `{"cache_size":2}`, []string{"-cachesize=1"}, ":1001", "/env", "env", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.json")
+			if tt.file != "" {
+				if err := ioutil.WriteFile(path, []byte(tt.file), 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			fs := flag.NewFlagSet("web_server", flag.ContinueOnError)
+			c, err := parseConfig(fs, append([]string{"-config", path}, tt.args...))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.Addr != tt.wantAddr || c.DataDir != tt.wantData || c.Theme != tt.wantTheme || c.CacheSize != tt.wantCache {
+				t.Errorf("config = addr %q, data %q, theme %q, cache %d; want %q, %q, %q, %d",
+					c.Addr, c.DataDir, c.Theme, c.CacheSize, tt.wantAddr, tt.wantData, tt.wantTheme, tt.wantCache)
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestCORSMiddleware(t *testing.T) {
+	tests := []struct {
+		name, method, origin string
+		wantOrigin           string
+		wantStatus           int
+		wantCalled           bool
+	}{
+		{"allowed origin", http.MethodGet, "https://app.example.com", "https://app.example.com", http.StatusOK, true},
+		{"other allowed origin", http.MethodPut, "http://localhost:3000", "http://localhost:3000", http.StatusOK, true},
+		{"origin not in the list", http.MethodGet, "https://evil.example.com", "", http.StatusOK, true},
+		{"origin differs only in scheme", http.MethodGet, "http://app.example.com", "", http.StatusOK, true},
+		{"no origin", http.MethodGet, "", "", http.StatusOK, true},
+		{"preflight", http.MethodOptions, "https://app.example.com", "https://app.example.com", http.StatusNoContent, false},
+		{"preflight from another origin", http.MethodOptions, "https://evil.example.com", "", http.StatusNoContent, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			called := false
+			h := corsMiddleware(splitList(" https://app.example.com, http://localhost:3000 ,"))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				called = true
+			}))
+			r := httptest.NewRequest(tt.method, "/api/v1/pages/Foo", nil)
+			if tt.origin != "" {
+				r.Header.Set("Origin", tt.origin)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if w.Code != tt.wantStatus || called != tt.wantCalled {
+				t.Errorf("status = %d, handler called %v; want %d, %v", w.Code, called, tt.wantStatus, tt.wantCalled)
+			}
+			if got := w.Header().Get("Access-Control-Allow-Origin"); got != tt.wantOrigin {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.wantOrigin)
+			}
+			hasMethods := w.Header().Get("Access-Control-Allow-Methods") != ""
+			if hasMethods != (tt.wantOrigin != "") {
+				t.Errorf("Access-Control-Allow-Methods present = %v, want %v", hasMethods, tt.wantOrigin != "")
+			}
+			if tt.method == http.MethodOptions && w.Body.Len() != 0 {
+				t.Errorf("preflight has a body: %q", w.Body)
+			}
+			if v := w.Header().Values("Vary"); !reflect.DeepEqual(v, []string{"Origin"}) {
+				t.Errorf("Vary = %v, want [Origin]", v)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+)
+
+const (
+	csrfCookie = "csrf"
+	csrfField  = "csrf_token"
+	csrfHeader = "X-CSRF-Token"
+)
+
+// csrfToken возвращает CSRF-токен, который csrfMiddleware положил
+// в контекст запроса, для скрытого поля формы.
+func csrfToken(r *http.Request) string {
+	t, _ := r.Context().Value(csrfContextKey).(string)
+	return t
+}
+
+// csrfExpected вычисляет токен для сессии и nonce: HMAC-SHA256
+// на ключе secret. Токен из другой сессии или с другим nonce не подходит.
+func csrfExpected(secret []byte, r *http.Request, nonce string) string {
+	var session string
+	if c, err := r.Cookie(sessionCookie); err == nil {
+		session = c.Value
+	}
+	m := hmac.New(sha256.New, secret)
+	m.Write([]byte(session + "|" + nonce))
+	return hex.EncodeToString(m.Sum(nil))
+}
+
+// csrfMiddleware защищает формы от отправки с чужих сайтов. На
+// безопасные запросы (GET, HEAD) оно выдает nonce в cookie и кладет
+// в контекст токен для формы. Запросы POST, PUT и DELETE должны
+// прислать этот токен в поле csrf_token или заголовке X-CSRF-Token,
+// иначе получают 403 Forbidden.
+func csrfMiddleware(secret []byte) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var nonce string
+			if c, err := r.Cookie(csrfCookie); err == nil && len(c.Value) == 32 {
+				nonce = c.Value
+			}
+			switch r.Method {
+			case http.MethodPost, http.MethodPut, http.MethodDelete:
+				sent := r.Header.Get(csrfHeader)
+				if sent == "" {
+					sent = r.PostFormValue(csrfField)
+				}
+				if nonce == "" || !hmac.Equal([]byte(sent), []byte(csrfExpected(secret, r, nonce))) {
+					http.Error(w, "Forbidden: invalid CSRF token", http.StatusForbidden)
+					return
+				}
+			default:
+				if nonce == "" {
+					b := make([]byte, 16)
+					if _, err := rand.Read(b); err != nil {
+						serverError(w, err)
+						return
+					}
+					nonce = hex.EncodeToString(b)
+					http.SetCookie(w, &http.Cookie{
+						Name:     csrfCookie,
+						Value:    nonce,
+						Path:     "/",
+						HttpOnly: true,
+						SameSite: http.SameSiteLaxMode,
+					})
+				}
+			}
+			ctx := context.WithValue(r.Context(), csrfContextKey, csrfExpected(secret, r, nonce))
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// csrfForm выполняет GET через csrfMiddleware и возвращает cookie
+// с nonce и токен, который попал бы в форму.
+func csrfForm(t *testing.T, h http.Handler, session *http.Cookie) (*http.Cookie, string) {
+	t.Helper()
+	r := httptest.NewRequest(http.MethodGet, "/edit/Foo", nil)
+	if session != nil {
+		r.AddCookie(session)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	for _, c := range w.Result().Cookies() {
+		if c.Name == csrfCookie {
+			return c, w.Body.String()
+		}
+	}
+	t.Fatal("GET did not set the CSRF cookie")
+	return nil, ""
+}
+
+func TestCSRFMiddleware(t *testing.T) {
+	h := csrfMiddleware([]byte("secret"))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(csrfToken(r)))
+	}))
+	sessionA := &http.Cookie{Name: sessionCookie, Value: "session-a"}
+	sessionB := &http.Cookie{Name: sessionCookie, Value: "session-b"}
+	nonce, token := csrfForm(t, h, sessionA)
+	otherNonce, otherToken := csrfForm(t, h, sessionA)
+
+	tests := []struct {
+		name    string
+		cookies []*http.Cookie
+		token   string
+		header  bool // токен в заголовке, а не в поле формы
+		want    int
+	}{
+		{"fresh token", []*http.Cookie{sessionA, nonce}, token, false, http.StatusOK},
+		{"fresh token in header", []*http.Cookie{sessionA, nonce}, token, true, http.StatusOK},
+		{"no token", []*http.Cookie{sessionA, nonce}, "", false, http.StatusForbidden},
+		{"no nonce cookie", []*http.Cookie{sessionA}, token, false, http.StatusForbidden},
+		{"token replayed in another session", []*http.Cookie{sessionB, nonce}, token, false, http.StatusForbidden},
+		{"token replayed with a newer nonce", []*http.Cookie{sessionA, otherNonce}, token, false, http.StatusForbidden},
+		{"token of the newer nonce", []*http.Cookie{sessionA, otherNonce}, otherToken, false, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			if !tt.header && tt.token != "" {
+				form.Set(csrfField, tt.token)
+			}
+			r := httptest.NewRequest(http.MethodPost, "/save/Foo", strings.NewReader(form.Encode()))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			if tt.header {
+				r.Header.Set(csrfHeader, tt.token)
+			}
+			for _, c := range tt.cookies {
+				r.AddCookie(c)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
+
+// Токен CSRF попадает в форму редактирования.
+func TestEditFormHasCSRFToken(t *testing.T) {
+	testDataDir(t)
+	h := csrfMiddleware([]byte("secret"))(makeHandler(editHandler))
+	_, body := csrfForm(t, h, nil)
+	if !strings.Contains(body, `name="`+csrfField+`"`) {
+		t.Fatalf("edit form has no %s field:\n%s", csrfField, body)
+	}
+}
+
+// /save/ без верного токена отклоняется и страницу не меняет.
+func TestSaveRequiresCSRFToken(t *testing.T) {
+	tests := []struct {
+		name     string
+		token    func(string) string // токен формы по выданному
+		want     int
+		wantBody string
+	}{
+		{"valid token", func(tok string) string { return tok }, http.StatusFound, "new"},
+		{"no token", func(string) string { return "" }, http.StatusForbidden, "old"},
+		{"wrong token", func(tok string) string { return strings.Repeat("0", len(tok)) }, http.StatusForbidden, "old"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testDataDir(t)
+			savePage(t, "Foo", "old")
+			h := csrfMiddleware([]byte("secret"))(makeHandler(saveHandler))
+			tokenHandler := csrfMiddleware([]byte("secret"))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(csrfToken(r)))
+			}))
+			nonce, token := csrfForm(t, tokenHandler, nil)
+
+			form := url.Values{"body": {"new"}}
+			if tok := tt.token(token); tok != "" {
+				form.Set(csrfField, tok)
+			}
+			r := httptest.NewRequest(http.MethodPost, "/save/Foo", strings.NewReader(form.Encode()))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			r.AddCookie(nonce)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d", w.Code, tt.want)
+			}
+			if p, err := store.Load("Foo"); err != nil || string(p.Body) != tt.wantBody {
+				t.Errorf("page = %v, %v; want body %q", p, err, tt.wantBody)
+			}
+		})
+	}
+}
+
+// Слишком большой текст отклоняется с 413, даже если форму уже
+// прочитал csrfMiddleware, до того как saveHandler ограничил тело.
+func TestOversizedSaveBehindCSRF(t *testing.T) {
+	dir := testDataDir(t)
+	oldMax := maxPageSize
+	maxPageSize = 1 << 10
+	t.Cleanup(func() { maxPageSize = oldMax })
+	h := csrfMiddleware([]byte("secret"))(makeHandler(saveHandler))
+	tokenHandler := csrfMiddleware([]byte("secret"))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(csrfToken(r)))
+	}))
+	nonce, token := csrfForm(t, tokenHandler, nil)
+
+	form := url.Values{"body": {strings.Repeat("a", 1<<10+1)}, csrfField: {token}}
+	r := httptest.NewRequest(http.MethodPost, "/save/Foo", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.AddCookie(nonce)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("status = %d, want 413", w.Code)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "Foo.txt")); !os.IsNotExist(err) {
+		t.Errorf("oversized page was written: %v", err)
+	}
+}
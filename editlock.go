@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// editLockTTL - сколько действует блокировка, которую получает
+// открывший форму редактирования.
+const editLockTTL = 10 * time.Minute
+
+// editLock - блокировка страницы на время редактирования: токен
+// из скрытого поля lock_token формы, кто и когда ее получил.
+type editLock struct {
+	Token      string
+	User       string
+	AcquiredAt time.Time
+}
+
+func (l *editLock) expired(now time.Time) bool {
+	return now.Sub(l.AcquiredAt) >= editLockTTL
+}
+
+// Error описывает блокировку как причину отказа в изменении страницы;
+// так ее можно вернуть как ошибку, например из резолвера GraphQL.
+func (l *editLock) Error() string {
+	return fmt.Sprintf("page is locked for editing by %s since %s", l.User, l.AcquiredAt.UTC().Format(time.RFC3339))
+}
+
+// lockTokenHeader - заголовок, в котором клиенты API и GraphQL
+// передают токен блокировки (поле lock_token формы редактирования).
+// Без него изменить страницу, которую держит открытая форма, нельзя.
+const lockTokenHeader = "X-Lock-Token"
+
+// editLocks - заголовок страницы -> *editLock. Блокировки живут
+// только в памяти: после перезапуска сервера формы сохраняются
+// без проверки токена.
+var editLocks sync.Map
+
+// acquireEditLock выдает user блокировку страницы title. Если
+// действующая блокировка принадлежит другому пользователю, она
+// возвращается с false. Свою блокировку пользователь получает заново,
+// так что сохранить можно только из последней открытой формы.
+func acquireEditLock(title, user string, now time.Time) (*editLock, bool) {
+	l := &editLock{Token: newUUID(), User: user, AcquiredAt: now}
+	for {
+		v, loaded := editLocks.LoadOrStore(title, l)
+		if !loaded {
+			return l, true
+		}
+		old := v.(*editLock)
+		if old.User != user && !old.expired(now) {
+			return old, false
+		}
+		if editLocks.CompareAndSwap(title, old, l) {
+			return l, true
+		}
+	}
+}
+
+// checkEditLock проверяет перед сохранением страницы title токен
+// token из формы. Ошибкой считается только действующая блокировка
+// с другим токеном: она и возвращается. Без блокировки (например,
+// после ее истечения) сохранение разрешено.
+func checkEditLock(title, token string, now time.Time) *editLock {
+	v, ok := editLocks.Load(title)
+	if !ok {
+		return nil
+	}
+	l := v.(*editLock)
+	if l.Token == token || l.expired(now) {
+		return nil
+	}
+	return l
+}
+
+// releaseEditLock снимает блокировку страницы title, если ее токен -
+// token. Так сохранение не снимет блокировку, выданную после него.
+func releaseEditLock(title, token string) {
+	if v, ok := editLocks.Load(title); ok && v.(*editLock).Token == token {
+		editLocks.CompareAndDelete(title, v)
+	}
+}
+
+// cleanEditLocks раз в interval удаляет истекшие блокировки.
+// Его запускает main в отдельной горутине.
+func cleanEditLocks(interval time.Duration) {
+	for now := range time.Tick(interval) {
+		editLocks.Range(func(key, value interface{}) bool {
+			if value.(*editLock).expired(now) {
+				editLocks.CompareAndDelete(key, value)
+			}
+			return true
+		})
+	}
+}
+
+// lockConflict отвечает клиенту API на изменение страницы,
+// заблокированной формой редактирования, кодом 409 с тем, кто
+// и с какого времени ее держит.
+func lockConflict(w http.ResponseWriter, l *editLock) {
+	writeJSON(w, http.StatusConflict, map[string]string{
+		"error":     "page is locked for editing",
+		"locked_by": l.User,
+		"since":     l.AcquiredAt.UTC().Format(time.RFC3339),
+	})
+}
+
+var apiLockPath = regexp.MustCompile(`^/api/v1/locks/(` + titleChars + `)$`)
+
+// apiLockHandler обслуживает DELETE /api/v1/locks/{title}: снимает
+// блокировку редактирования страницы (только для администраторов,
+// см. requireAdmin). Отвечает 204, а если блокировки нет - 404.
+func apiLockHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		w.Header().Set("Allow", "DELETE")
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	m := apiLockPath.FindStringSubmatch(r.URL.Path)
+	if m == nil {
+		writeJSONError(w, http.StatusNotFound, "not found")
+		return
+	}
+	if _, ok := editLocks.LoadAndDelete(normalizeTitle(m[1])); !ok {
+		writeJSONError(w, http.StatusNotFound, "page is not locked")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
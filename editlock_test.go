@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	graphql "github.com/graph-gophers/graphql-go"
+)
+
+// lockPage выдает пользователю user блокировку страницы title, как
+// при открытии формы редактирования. Снимает ее testDataDir.
+func lockPage(t *testing.T, title, user string) *editLock {
+	t.Helper()
+	l, ok := acquireEditLock(title, user, time.Now())
+	if !ok {
+		t.Fatalf("page %s is already locked by %s", title, l.User)
+	}
+	return l
+}
+
+// Две формы редактирования одной страницы: сохранение из той, что
+// открыта первой, отклоняется.
+func TestConcurrentEditsSecondSaveRejected(t *testing.T) {
+	testDataDir(t)
+	savePage(t, "Foo", "original")
+	first := lockPage(t, "Foo", "alice")
+	second, ok := acquireEditLock("Foo", "bob", time.Now())
+	if ok {
+		t.Fatal("bob got the lock held by alice")
+	}
+	if second != first {
+		t.Errorf("conflicting lock = %+v, want alice's lock", second)
+	}
+	save := func(token, body, accept string) *httptest.ResponseRecorder {
+		form := url.Values{"body": {body}, "lock_token": {token}}
+		r := httptest.NewRequest(http.MethodPost, "/save/Foo", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.Header.Set("Accept", accept)
+		w := httptest.NewRecorder()
+		makeHandler(saveHandler)(w, r)
+		return w
+	}
+	tests := []struct {
+		name, token, accept string
+		wantStatus          int
+		wantType            string
+		wantBody            string // подстрока ответа
+	}{
+		{"browser without token", "", "text/html", http.StatusConflict, "text/html", "locked by alice"},
+		{"form keeps the submitted text", "", "text/html", http.StatusConflict, "text/html", "form keeps the submitted text"},
+		{"API client without token", "", "application/json", http.StatusConflict, "application/json", `"locked_by":"alice"`},
+		{"alice's token", first.Token, "text/html", http.StatusFound, "", ""},
+	}
+	for _, tt := range tests {
+		w := save(tt.token, tt.name, tt.accept)
+		if w.Code != tt.wantStatus {
+			t.Fatalf("%s: status = %d, want %d", tt.name, w.Code, tt.wantStatus)
+		}
+		if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, tt.wantType) {
+			t.Errorf("%s: Content-Type = %q, want %s", tt.name, ct, tt.wantType)
+		}
+		if !strings.Contains(w.Body.String(), tt.wantBody) {
+			t.Errorf("%s: response does not contain %q:\n%s", tt.name, tt.wantBody, w.Body)
+		}
+	}
+	p, err := store.Load("Foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(p.Body) != "alice's token" {
+		t.Errorf("body = %q, want the text saved with alice's token", p.Body)
+	}
+}
+
+// Блокировку формы соблюдают все способы изменить страницу, а не
+// только форма сохранения.
+func TestEditLockWritePaths(t *testing.T) {
+	tests := []struct {
+		name   string
+		locked string // заголовок заблокированной страницы
+		do     func(token string) int
+	}{
+		{"PUT", "Foo", func(token string) int {
+			return serveLocked(apiPutPage, http.MethodPut, "/api/v1/pages/Foo", `{"body":"new"}`, token).Code
+		}},
+		{"DELETE", "Foo", func(token string) int {
+			return serveLocked(apiDeletePage, http.MethodDelete, "/api/v1/pages/Foo", "", token).Code
+		}},
+		{"rename", "Foo", func(token string) int {
+			return serveLocked(apiRenamePage, http.MethodPost, "/api/v1/pages/Foo/rename", `{"new_title":"Bar"}`, token).Code
+		}},
+		{"rename onto a locked title", "Bar", func(token string) int {
+			return serveLocked(apiRenamePage, http.MethodPost, "/api/v1/pages/Foo/rename", `{"new_title":"Bar"}`, token).Code
+		}},
+		{"clone onto a locked title", "Bar", func(token string) int {
+			return serveLocked(apiClonePage, http.MethodPost, "/api/v1/pages/Foo/clone", `{"new_title":"Bar"}`, token).Code
+		}},
+		{"GraphQL savePage", "Foo", func(token string) int {
+			return graphqlLocked(`mutation { savePage(title: "Foo", body: "new") { title } }`, token)
+		}},
+		{"GraphQL deletePage", "Foo", func(token string) int {
+			return graphqlLocked(`mutation { deletePage(title: "Foo") }`, token)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testDataDir(t)
+			savePage(t, "Foo", "text")
+			l := lockPage(t, tt.locked, "alice")
+			if code := tt.do(""); code != http.StatusConflict {
+				t.Errorf("without token: status = %d, want %d", code, http.StatusConflict)
+			}
+			if code := tt.do(l.Token); code >= 300 {
+				t.Errorf("with the lock token: status = %d, want success", code)
+			}
+		})
+	}
+}
+
+// serveLocked выполняет запрос к API от имени вошедшего пользователя
+// с токеном блокировки token в заголовке X-Lock-Token.
+func serveLocked(h http.HandlerFunc, method, target, body, token string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		r.Header.Set(lockTokenHeader, token)
+	}
+	r = r.WithContext(context.WithValue(r.Context(), userContextKey, &User{Username: "bob"}))
+	w := httptest.NewRecorder()
+	h(w, r)
+	return w
+}
+
+// graphqlLocked выполняет мутацию query от имени вошедшего
+// пользователя и отвечает 409, если ее отклонила блокировка.
+func graphqlLocked(query, token string) int {
+	r := httptest.NewRequest(http.MethodPost, "/graphql", nil)
+	if token != "" {
+		r.Header.Set(lockTokenHeader, token)
+	}
+	r = r.WithContext(context.WithValue(r.Context(), userContextKey, &User{Username: "bob"}))
+	ctx := context.WithValue(r.Context(), graphqlRequestContextKey, r)
+	res := graphql.MustParseSchema(graphqlSchema, &graphqlResolver{}).Exec(ctx, query, "", nil)
+	for _, err := range res.Errors {
+		if _, ok := err.ResolverError.(*editLock); ok {
+			return http.StatusConflict
+		}
+	}
+	return http.StatusOK
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"strings"
+)
+
+// errorPage - данные для шаблонов html/404.html и html/500.html.
+type errorPage struct {
+	Status  int
+	Message string
+	Path    string
+}
+
+// Функция errorHandler отвечает страницей ошибки с кодом status.
+// Для 404 используется шаблон 404.html, для остальных кодов - 500.html.
+// Подробности серверных ошибок (5xx) вместе со стеком вызовов пишутся
+// только в лог, а клиент видит общее сообщение.
+func errorHandler(w http.ResponseWriter, r *http.Request, status int, msg string) {
+	if status >= 500 {
+		loggerFromContext(r.Context()).Error(msg,
+			"method", r.Method, "path", r.URL.Path, "status", status,
+			"stack", string(debug.Stack()))
+		msg = http.StatusText(status)
+	}
+	renderErrorPage(w, r, status, msg)
+}
+
+// renderErrorPage показывает шаблон страницы ошибки, ничего не логируя.
+func renderErrorPage(w http.ResponseWriter, r *http.Request, status int, msg string) {
+	tmpl := "500.html"
+	if status == http.StatusNotFound {
+		tmpl = "404.html"
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	err := templates.Templates().ExecuteTemplate(w, tmpl, errorPage{Status: status, Message: msg, Path: r.URL.Path})
+	if err != nil {
+		loggerFromContext(r.Context()).Error("не удалось показать страницу ошибки",
+			"template", tmpl, "error", err)
+	}
+}
+
+// Функция serverError пишет err в лог, а клиенту отвечает только
+// общим "Internal Server Error": текст ошибки может содержать пути
+// к файлам и другие внутренние подробности.
+func serverError(w http.ResponseWriter, err error) {
+	slog.Error("внутренняя ошибка", "error", err)
+	http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+}
+
+// Функция notFoundHandler - обработчик для всех путей, которые
+// не зарегистрированы в mux.
+func notFoundHandler(w http.ResponseWriter, r *http.Request) {
+	errorHandler(w, r, http.StatusNotFound, "Page not found")
+}
+
+// recoveryMiddleware перехватывает панику в обработчике, пишет в logger
+// ее значение и стек вызовов и отвечает клиенту 500: JSON для API,
+// HTML-страницей ошибки для остального. Без него net/http просто
+// закрыл бы соединение. Панику http.ErrAbortHandler, которой
+// обработчик намеренно прерывает ответ, middleware пропускает дальше.
+func recoveryMiddleware(logger *slog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer func() {
+				v := recover()
+				if v == nil {
+					return
+				}
+				if v == http.ErrAbortHandler {
+					panic(v)
+				}
+				l := logger
+				if cl, ok := r.Context().Value(loggerContextKey).(*slog.Logger); ok {
+					l = cl // с request_id, если выше стоит loggingMiddleware
+				}
+				l.Error("паника в обработчике",
+					"method", r.Method, "path", r.URL.Path,
+					"panic", fmt.Sprint(v), "stack", string(debug.Stack()))
+				if strings.HasPrefix(r.URL.Path, "/api/") {
+					writeJSONError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+					return
+				}
+				renderErrorPage(w, r, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+			}()
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestErrorHandler(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		msg      string
+		wantIn   []string
+		wantOut  string
+		wantLogs bool
+	}{
+		{"not found", http.StatusNotFound, "Page not found", []string{"<h1>404 Not Found</h1>", "Page not found: <code>/view/&lt;b&gt;</code>"}, "", false},
+		{"bad request", http.StatusBadRequest, "Invalid page title", []string{"<h1>400 Error</h1>", "<p>Invalid page title</p>"}, "", false},
+		// Текст внутренней ошибки может раскрыть пути и детали хранилища.
+		{"server error", http.StatusInternalServerError, "open /srv/wiki/Foo.txt: permission denied", []string{"<h1>500 Error</h1>", "<p>Internal Server Error</p>"}, "/srv/wiki", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			logger, _ := newLogger(&buf, "text", "")
+			r := httptest.NewRequest(http.MethodGet, "/view/<b>", nil)
+			r = r.WithContext(context.WithValue(r.Context(), loggerContextKey, logger))
+			w := httptest.NewRecorder()
+			errorHandler(w, r, tt.status, tt.msg)
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d", w.Code, tt.status)
+			}
+			if ct := w.Header().Get("Content-Type"); ct != "text/html; charset=utf-8" {
+				t.Errorf("Content-Type = %q, want text/html; charset=utf-8", ct)
+			}
+			for _, s := range tt.wantIn {
+				if !strings.Contains(w.Body.String(), s) {
+					t.Errorf("page has no %q:\n%s", s, w.Body)
+				}
+			}
+			if tt.wantOut != "" && strings.Contains(w.Body.String(), tt.wantOut) {
+				t.Errorf("page shows %q to the client:\n%s", tt.wantOut, w.Body)
+			}
+			logged := strings.Contains(buf.String(), "goroutine")
+			if logged != tt.wantLogs || (tt.wantLogs && !strings.Contains(buf.String(), tt.msg)) {
+				t.Errorf("stack logged = %v, want %v; log:\n%s", logged, tt.wantLogs, buf.String())
+			}
+		})
+	}
+}
+
+// Корневой обработчик показывает список страниц только на "/",
+// а на любом незарегистрированном пути - страницу 404.
+func TestUnknownRoute(t *testing.T) {
+	testDataDir(t)
+	savePage(t, "Foo", "foo")
+	tests := []struct {
+		target string
+		want   int
+		wantIn string
+	}{
+		{"/", http.StatusOK, `href="/view/Foo"`},
+		{"/nonexistent", http.StatusNotFound, "Page not found: <code>/nonexistent</code>"},
+		{"/view", http.StatusNotFound, "<h1>404 Not Found</h1>"},
+		{"/Foo", http.StatusNotFound, "<h1>404 Not Found</h1>"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			w := serve(handler, http.MethodGet, tt.target, "")
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d", w.Code, tt.want)
+			}
+			if !strings.Contains(w.Body.String(), tt.wantIn) {
+				t.Errorf("page has no %q:\n%s", tt.wantIn, w.Body)
+			}
+		})
+	}
+}
+
+func TestRecoveryMiddleware(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := newLogger(&buf, "json", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/panic", func(w http.ResponseWriter, r *http.Request) { panic("boom") })
+	mux.HandleFunc("/api/v1/panic", func(w http.ResponseWriter, r *http.Request) { panic("boom") })
+	mux.HandleFunc("/ok", func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("ok")) })
+	srv := httptest.NewServer(recoveryMiddleware(logger)(mux))
+	defer srv.Close()
+
+	tests := []struct {
+		path       string
+		want       int
+		wantType   string
+		wantInBody string
+	}{
+		{"/panic", http.StatusInternalServerError, "text/html", "500"},
+		{"/api/v1/panic", http.StatusInternalServerError, "application/json", `"error"`},
+		// Соединение и сервер живы после паники.
+		{"/ok", http.StatusOK, "text/plain", "ok"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			resp, err := srv.Client().Get(srv.URL + tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if resp.StatusCode != tt.want {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, tt.want)
+			}
+			if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, tt.wantType) {
+				t.Errorf("Content-Type = %q, want %s", ct, tt.wantType)
+			}
+			if !strings.Contains(string(body), tt.wantInBody) {
+				t.Errorf("body = %q, want it to contain %q", body, tt.wantInBody)
+			}
+		})
+	}
+
+	var entry struct {
+		Panic, Stack, Path string
+	}
+	line, _, _ := strings.Cut(buf.String(), "\n")
+	if err := json.Unmarshal([]byte(line), &entry); err != nil {
+		t.Fatalf("panic log line %q: %v", line, err)
+	}
+	if entry.Panic != "boom" || entry.Path != "/panic" || !strings.Contains(entry.Stack, "goroutine") {
+		t.Errorf("panic log = %+v, want the panic value, path and stack trace", entry)
+	}
+}
+
+// http.ErrAbortHandler прерывает ответ, как и без middleware.
+func TestRecoveryMiddlewareAbort(t *testing.T) {
+	logger, _ := newLogger(io.Discard, "text", "")
+	h := recoveryMiddleware(logger)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+	defer func() {
+		if v := recover(); v != http.ErrAbortHandler {
+			t.Errorf("recovered %v, want http.ErrAbortHandler", v)
+		}
+	}()
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	t.Error("ErrAbortHandler was swallowed")
+}
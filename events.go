@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// eventBuffer - сколько событий может ждать отправки одному клиенту.
+// Событие для клиента, который не успевает их читать, пропускается.
+const eventBuffer = 16
+
+// eventHeartbeat - как часто /events шлет комментарий, чтобы прокси
+// не закрыли бездействующее соединение.
+const eventHeartbeat = 30 * time.Second
+
+// Broker рассылает события всем подписчикам /events.
+type Broker struct {
+	mu      sync.Mutex
+	clients map[chan []byte]bool
+}
+
+var broker = &Broker{clients: make(map[chan []byte]bool)}
+
+// Subscribe возвращает канал, в который приходят события.
+func (b *Broker) Subscribe() chan []byte {
+	ch := make(chan []byte, eventBuffer)
+	b.mu.Lock()
+	b.clients[ch] = true
+	b.mu.Unlock()
+	return ch
+}
+
+// Unsubscribe отменяет подписку ch.
+func (b *Broker) Unsubscribe(ch chan []byte) {
+	b.mu.Lock()
+	delete(b.clients, ch)
+	b.mu.Unlock()
+}
+
+// Publish отправляет event всем подписчикам, не дожидаясь медленных.
+func (b *Broker) Publish(event []byte) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.clients {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// pageEvent - событие /events об изменении страницы.
+type pageEvent struct {
+	Event string `json:"event"`
+	Title string `json:"title"`
+}
+
+// publishPageEvent рассылает событие об изменении страницы title.
+// Изменение страницы заодно сбрасывает указатель тегов (см.
+// TagIndexCache): теги могли быть в ее тексте.
+func publishPageEvent(event, title string) {
+	tagIndexCache.Invalidate()
+	data, err := json.Marshal(pageEvent{Event: event, Title: title})
+	if err != nil {
+		slog.Error("ошибка события", "event", event, "title", title, "err", err)
+		return
+	}
+	broker.Publish(data)
+}
+
+// eventStorage сообщает подписчикам /events о каждом удачном
+// сохранении и удалении страницы, откуда бы оно ни пришло: из формы,
+// API, GraphQL или импорта. Переименование - удаление старой
+// страницы и сохранение новой.
+type eventStorage struct {
+	Storage
+}
+
+func (s eventStorage) Save(p *Page) error {
+	if err := s.Storage.Save(p); err != nil {
+		return err
+	}
+	publishPageEvent("saved", p.Title)
+	return nil
+}
+
+func (s eventStorage) Delete(title string) error {
+	if err := s.Storage.Delete(title); err != nil {
+		return err
+	}
+	publishPageEvent("deleted", title)
+	return nil
+}
+
+func (s eventStorage) Rename(oldTitle, newTitle string) error {
+	if err := s.Storage.Rename(oldTitle, newTitle); err != nil {
+		return err
+	}
+	publishPageEvent("deleted", oldTitle)
+	publishPageEvent("saved", newTitle)
+	return nil
+}
+
+// eventsHandler - поток событий об изменении страниц: GET /events
+// (text/event-stream), каждое событие - строка
+// data: {"event":"saved","title":"..."}. Событие "deleted" приходит
+// при удалении страницы. Анонимные клиенты не получают событий
+// о закрытых страницах.
+func eventsHandler(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	rc := http.NewResponseController(w)
+	// Поток открыт дольше -writetimeout; если снять срок записи
+	// нельзя, соединение просто закроется по нему.
+	rc.SetWriteDeadline(time.Time{})
+	ch := broker.Subscribe()
+	defer broker.Unsubscribe(ch)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		return
+	}
+	heartbeat := time.NewTicker(eventHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case event := <-ch:
+			if !canSeeEvent(r, event) {
+				continue
+			}
+			fmt.Fprintf(w, "data: %s\n\n", event)
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": ping\n\n")
+		case <-r.Context().Done():
+			return
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// canSeeEvent сообщает, может ли автор запроса r читать страницу,
+// о которой событие event.
+func canSeeEvent(r *http.Request, event []byte) bool {
+	if isEditor(userFromContext(r.Context())) {
+		return true
+	}
+	var e pageEvent
+	if err := json.Unmarshal(event, &e); err != nil {
+		return false
+	}
+	ok, err := canRead(r, e.Title)
+	return err == nil && ok
+}
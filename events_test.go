@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Оба подключенных к /events клиента получают событие о сохранении
+// страницы не позже чем через 500 мс.
+func TestEventsBroadcast(t *testing.T) {
+	testDataDir(t)
+	store = eventStorage{store}
+	srv := httptest.NewServer(http.HandlerFunc(eventsHandler))
+	defer srv.Close()
+
+	const clients = 2
+	lines := make(chan string, clients)
+	for i := 0; i < clients; i++ {
+		resp, err := http.Get(srv.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+			t.Fatalf("Content-Type = %q, want text/event-stream", ct)
+		}
+		// Заголовки приходят после подписки, так что событие
+		// ниже клиент уже не пропустит.
+		go func() {
+			sc := bufio.NewScanner(resp.Body)
+			for sc.Scan() {
+				if strings.HasPrefix(sc.Text(), "data: ") {
+					lines <- sc.Text()
+					return
+				}
+			}
+		}()
+	}
+
+	savePage(t, "Foo", "text")
+	want := `data: {"event":"saved","title":"Foo"}`
+	timeout := time.After(500 * time.Millisecond)
+	for i := 0; i < clients; i++ {
+		select {
+		case line := <-lines:
+			if line != want {
+				t.Errorf("client got %q, want %q", line, want)
+			}
+		case <-timeout:
+			t.Fatalf("%d of %d clients got no event within 500ms", clients-i, clients)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"archive/zip"
+	"log/slog"
+	"net/http"
+)
+
+// exportHandler отдает все страницы одним архивом wiki-export.zip,
+// по файлу <title>.txt на страницу. Архив пишется прямо в ответ
+// по мере чтения страниц и целиком в памяти не собирается.
+func exportHandler(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	titles, err := store.List()
+	if err != nil {
+		errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", "attachment; filename=wiki-export.zip")
+	zw := zip.NewWriter(w)
+	for _, t := range titles {
+		p, err := store.Load(t)
+		if err != nil {
+			// Заголовки уже отправлены, сменить код ответа нельзя:
+			// клиент получит оборванный архив, а ошибка - в лог.
+			slog.Error("ошибка экспорта", "title", t, "err", err)
+			return
+		}
+		f, err := zw.CreateHeader(&zip.FileHeader{Name: p.Title + ".txt", Method: zip.Deflate, Modified: p.Modified})
+		if err == nil {
+			_, err = f.Write(p.Body)
+		}
+		if err != nil {
+			slog.Error("ошибка экспорта", "title", t, "err", err)
+			return
+		}
+	}
+	if err := zw.Close(); err != nil {
+		slog.Error("ошибка экспорта", "err", err)
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"testing"
+)
+
+// unzipResponse читает архив из тела ответа и возвращает записи
+// name -> содержимое.
+func unzipResponse(t *testing.T, body []byte) map[string]string {
+	t.Helper()
+	zr, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		t.Fatalf("response is not a zip archive: %v", err)
+	}
+	files := make(map[string]string)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[f.Name] = string(data)
+	}
+	return files
+}
+
+func TestExportHandler(t *testing.T) {
+	testDataDir(t)
+	pages := map[string]string{"Foo": "foo", "Bar": "#go\nbar", "Главная": "привет", "Empty": ""}
+	for title, body := range pages {
+		savePage(t, title, body)
+	}
+
+	w := serve(exportHandler, http.MethodGet, "/export", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	if got, want := w.Header().Get("Content-Disposition"), "attachment; filename=wiki-export.zip"; got != want {
+		t.Errorf("Content-Disposition = %q, want %q", got, want)
+	}
+	files := unzipResponse(t, w.Body.Bytes())
+	if len(files) != len(pages) {
+		t.Errorf("archive has %d entries, want %d: %v", len(files), len(pages), files)
+	}
+	for title, body := range pages {
+		if got, ok := files[title+".txt"]; !ok || got != body {
+			t.Errorf("%s.txt = %q (present %v), want %q", title, got, ok, body)
+		}
+	}
+
+	if w := serve(exportHandler, http.MethodPost, "/export", ""); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST /export: status = %d, want 405", w.Code)
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// feedSize - сколько последних измененных страниц попадает в ленту.
+const feedSize = 20
+
+// feedSummaryLen - длина краткого содержания записи в символах.
+const feedSummaryLen = 200
+
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title       string    `xml:"title"`
+	Link        string    `xml:"link"`
+	Description string    `xml:"description"`
+	Items       []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string `xml:"title"`
+	Link        string `xml:"link"`
+	GUID        string `xml:"guid"`
+	PubDate     string `xml:"pubDate"`
+	Description string `xml:"description"`
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Link    atomLink    `xml:"link"`
+	Updated string      `xml:"updated"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+}
+
+type atomEntry struct {
+	Title   string   `xml:"title"`
+	ID      string   `xml:"id"`
+	Link    atomLink `xml:"link"`
+	Updated string   `xml:"updated"`
+	Summary string   `xml:"summary"`
+}
+
+// recentPages возвращает до n доступных запросу r страниц, начиная
+// с последней измененной.
+func recentPages(r *http.Request, n int) ([]*Page, error) {
+	titles, err := store.List()
+	if err != nil {
+		return nil, err
+	}
+	if titles, err = visibleTitles(r, titles); err != nil {
+		return nil, err
+	}
+	pages := make([]*Page, 0, len(titles))
+	for _, t := range titles {
+		p, err := store.Load(t)
+		if err != nil {
+			return nil, err
+		}
+		pages = append(pages, p)
+	}
+	sort.SliceStable(pages, func(i, j int) bool { return pages[i].Modified.After(pages[j].Modified) })
+	if len(pages) > n {
+		pages = pages[:n]
+	}
+	return pages, nil
+}
+
+// pageSummary возвращает начало текста страницы длиной не больше
+// n символов, без строк с тегами.
+func pageSummary(p *Page, n int) string {
+	_, body := contentTags(p.Body)
+	s := strings.TrimSpace(string(body))
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n]) + "…"
+}
+
+// baseURL - адрес сервера, по которому пришел запрос r.
+func baseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+// viewURL - внешний адрес страницы title для лент и ссылок /share.
+// Он строится от siteURL, а не от заголовка Host: иначе запрос
+// с поддельным Host вписал бы в ответ ссылки на чужой сайт.
+func viewURL(r *http.Request, title string) string {
+	return siteURL(r) + "/view/" + url.PathEscape(title)
+}
+
+// feedHandler отдает ленту последних измененных страниц:
+// /feed.rss в формате RSS 2.0 и /feed.atom в формате Atom.
+// Закрытые страницы в ленту не попадают.
+func feedHandler(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet, http.MethodHead) {
+		return
+	}
+	pages, err := recentPages(r, feedSize)
+	if err != nil {
+		errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	var feed interface{}
+	contentType := "application/rss+xml; charset=utf-8"
+	if r.URL.Path == "/feed.atom" {
+		contentType = "application/atom+xml; charset=utf-8"
+		// Без страниц лента обновлена в момент запроса: нулевое
+		// время в <updated> читатели лент считают ошибкой.
+		updated := time.Now()
+		if len(pages) > 0 {
+			updated = pages[0].Modified
+		}
+		f := atomFeed{
+			Title:   "Wiki",
+			ID:      siteURL(r) + "/",
+			Link:    atomLink{Href: siteURL(r) + "/"},
+			Updated: updated.UTC().Format(time.RFC3339),
+		}
+		for _, p := range pages {
+			f.Entries = append(f.Entries, atomEntry{
+				Title:   p.Title,
+				ID:      viewURL(r, p.Title),
+				Link:    atomLink{Href: viewURL(r, p.Title)},
+				Updated: p.Modified.UTC().Format(time.RFC3339),
+				Summary: pageSummary(p, feedSummaryLen),
+			})
+		}
+		feed = f
+	} else {
+		f := rssFeed{Version: "2.0", Channel: rssChannel{
+			Title:       "Wiki",
+			Link:        siteURL(r) + "/",
+			Description: "Recently modified pages",
+		}}
+		for _, p := range pages {
+			f.Channel.Items = append(f.Channel.Items, rssItem{
+				Title:       p.Title,
+				Link:        viewURL(r, p.Title),
+				GUID:        viewURL(r, p.Title),
+				PubDate:     p.Modified.UTC().Format(time.RFC1123Z),
+				Description: pageSummary(p, feedSummaryLen),
+			})
+		}
+		feed = f
+	}
+	out, err := xml.MarshalIndent(feed, "", "  ")
+	if err != nil {
+		errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Write([]byte(xml.Header))
+	w.Write(out)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// getFeed запрашивает ленту path с поддельным заголовком Host.
+func getFeed(t *testing.T, path string) *httptest.ResponseRecorder {
+	t.Helper()
+	r := httptest.NewRequest(http.MethodGet, path, nil)
+	r.Host = "evil.example.net"
+	w := httptest.NewRecorder()
+	feedHandler(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET %s status = %d", path, w.Code)
+	}
+	return w
+}
+
+func TestFeeds(t *testing.T) {
+	dir := testDataDir(t)
+	old := siteBaseURL
+	siteBaseURL = "https://wiki.example.com/"
+	t.Cleanup(func() { siteBaseURL = old })
+	// 22 страницы: Page00 изменена раньше всех, Page21 - позже.
+	start := time.Now().Add(-time.Hour)
+	for i := 0; i < feedSize+2; i++ {
+		title := fmt.Sprintf("Page%02d", i)
+		savePage(t, title, "<script>alert(1)</script> & text of "+title)
+		mtime := start.Add(time.Duration(i) * time.Minute)
+		if err := os.Chtimes(filepath.Join(dir, title+".txt"), mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	savePage(t, "Secret", "hidden")
+	if err := metas.Update("Secret", func(m *PageMeta) { m.Public = false }); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("rss", func(t *testing.T) {
+		w := getFeed(t, "/feed.rss")
+		if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/rss+xml") {
+			t.Errorf("Content-Type = %q", ct)
+		}
+		if strings.Contains(w.Body.String(), "<script>") {
+			t.Error("page text is not XML-escaped")
+		}
+		var f rssFeed
+		if err := xml.Unmarshal(w.Body.Bytes(), &f); err != nil {
+			t.Fatal(err)
+		}
+		items := f.Channel.Items
+		if len(items) != feedSize {
+			t.Fatalf("%d items, want %d", len(items), feedSize)
+		}
+		if items[0].Title != "Page21" || items[feedSize-1].Title != "Page02" {
+			t.Errorf("items from %s to %s, want from Page21 to Page02", items[0].Title, items[feedSize-1].Title)
+		}
+		if items[0].Link != "https://wiki.example.com/view/Page21" || f.Channel.Link != "https://wiki.example.com/" {
+			t.Errorf("links %q and %q do not use the configured base URL", f.Channel.Link, items[0].Link)
+		}
+		if !strings.HasPrefix(items[0].Description, "<script>") {
+			t.Errorf("summary = %q, want the page text", items[0].Description)
+		}
+	})
+	t.Run("atom", func(t *testing.T) {
+		w := getFeed(t, "/feed.atom")
+		if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/atom+xml") {
+			t.Errorf("Content-Type = %q", ct)
+		}
+		var f atomFeed
+		if err := xml.Unmarshal(w.Body.Bytes(), &f); err != nil {
+			t.Fatal(err)
+		}
+		if len(f.Entries) != feedSize || f.Entries[0].Title != "Page21" {
+			t.Fatalf("%d entries starting with %q, want %d starting with Page21", len(f.Entries), f.Entries[0].Title, feedSize)
+		}
+		if f.Entries[0].Link.Href != "https://wiki.example.com/view/Page21" {
+			t.Errorf("entry link = %q, want the configured base URL", f.Entries[0].Link.Href)
+		}
+		if f.Updated != f.Entries[0].Updated {
+			t.Errorf("feed updated = %s, want the newest entry %s", f.Updated, f.Entries[0].Updated)
+		}
+	})
+}
+
+func TestAtomFeedWithoutPages(t *testing.T) {
+	testDataDir(t)
+	var f atomFeed
+	if err := xml.Unmarshal(getFeed(t, "/feed.atom").Body.Bytes(), &f); err != nil {
+		t.Fatal(err)
+	}
+	updated, err := time.Parse(time.RFC3339, f.Updated)
+	if err != nil || time.Since(updated) > time.Minute {
+		t.Errorf("updated = %q, want the current time", f.Updated)
+	}
+}
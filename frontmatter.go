@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+)
+
+// frontmatterDelim - строка, которая открывает и закрывает блок
+// метаданных в начале текста страницы:
+//
+//	---
+//	title: Главная страница
+//	author: ivan
+//	---
+//
+// Внутри блока строки "ключ: значение" (YAML) или "ключ = значение"
+// (TOML). Вложенные структуры и списки не поддерживаются.
+const frontmatterDelim = "---"
+
+// parseFrontmatter разбирает блок метаданных в начале body и возвращает
+// метаданные и текст без блока. Если блока нет или он записан с ошибкой,
+// возвращаются nil и body целиком: такой текст показывается как есть.
+func parseFrontmatter(body []byte) (map[string]string, []byte) {
+	line, rest := cutLine(body)
+	if strings.TrimSpace(line) != frontmatterDelim {
+		return nil, body
+	}
+	meta := make(map[string]string)
+	for len(rest) > 0 {
+		line, rest = cutLine(rest)
+		s := strings.TrimSpace(line)
+		if s == frontmatterDelim {
+			return meta, bytes.TrimLeft(rest, "\r\n")
+		}
+		if s == "" || strings.HasPrefix(s, "#") {
+			continue
+		}
+		i := strings.IndexAny(s, ":=")
+		if i <= 0 {
+			return nil, body
+		}
+		key := strings.TrimSpace(s[:i])
+		meta[key] = unquote(strings.TrimSpace(s[i+1:]))
+	}
+	return nil, body
+}
+
+// cutLine отрезает от b первую строку (без "\n") и возвращает ее
+// и остаток.
+func cutLine(b []byte) (string, []byte) {
+	if i := bytes.IndexByte(b, '\n'); i >= 0 {
+		return string(b[:i]), b[i+1:]
+	}
+	return string(b), nil
+}
+
+// unquote снимает с v парные кавычки, если они есть.
+func unquote(v string) string {
+	if len(v) >= 2 && (v[0] == '"' || v[0] == '\'') && v[len(v)-1] == v[0] {
+		return v[1 : len(v)-1]
+	}
+	return v
+}
+
+// formatFrontmatter записывает meta блоком метаданных с ключами
+// в алфавитном порядке. Ключи, которые нельзя прочитать обратно
+// (пустые или с ":", "=", переводом строки), пропускаются, а пробелы
+// и переводы строк в значениях сжимаются в один пробел.
+func formatFrontmatter(meta map[string]string) []byte {
+	keys := make([]string, 0, len(meta))
+	for k := range meta {
+		if k == strings.TrimSpace(k) && k != "" && !strings.HasPrefix(k, "#") && !strings.ContainsAny(k, ":=\r\n") {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	var b bytes.Buffer
+	b.WriteString(frontmatterDelim + "\n")
+	for _, k := range keys {
+		v := strings.Join(strings.Fields(meta[k]), " ")
+		if strings.ContainsAny(v, "\"'#") {
+			v = `'` + v + `'`
+		}
+		b.WriteString(k + ": " + v + "\n")
+	}
+	b.WriteString(frontmatterDelim + "\n")
+	return b.Bytes()
+}
+
+// setFrontmatter готовит страницу p к записи в хранилище. Если в ее
+// тексте уже есть блок метаданных, он сохраняется как есть, иначе
+// из p.Meta (например, из поля meta в PUT /api/v1/pages/{title})
+// в начало текста записывается новый блок. После этого p.Meta
+// соответствует тексту.
+func setFrontmatter(p *Page) {
+	meta, _ := parseFrontmatter(p.Body)
+	if meta == nil && len(p.Meta) > 0 {
+		p.Body = append(formatFrontmatter(p.Meta), p.Body...)
+		meta, _ = parseFrontmatter(p.Body)
+	}
+	p.Meta = meta
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseFrontmatter(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		wantMeta map[string]string
+		wantText string
+	}{
+		{"yaml", "---\ntitle: Home page\nauthor: ivan\n---\ntext", map[string]string{"title": "Home page", "author": "ivan"}, "text"},
+		{"toml", "---\ntitle = \"Home\"\n---\n\ntext", map[string]string{"title": "Home"}, "text"},
+		{"comments and blank lines", "---\n# note\n\nauthor: 'ivan'\n---\ntext", map[string]string{"author": "ivan"}, "text"},
+		{"value with colon", "---\nlink: https://example.com\n---\n", map[string]string{"link": "https://example.com"}, ""},
+		{"crlf", "---\r\nauthor: ivan\r\n---\r\ntext", map[string]string{"author": "ivan"}, "text"},
+		{"no block", "text\n---\n", nil, "text\n---\n"},
+		{"unterminated block", "---\nauthor: ivan\ntext", nil, "---\nauthor: ivan\ntext"},
+		{"malformed line", "---\njust text\n---\ntext", nil, "---\njust text\n---\ntext"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meta, text := parseFrontmatter([]byte(tt.body))
+			if !reflect.DeepEqual(meta, tt.wantMeta) || string(text) != tt.wantText {
+				t.Errorf("parseFrontmatter = %v, %q; want %v, %q", meta, text, tt.wantMeta, tt.wantText)
+			}
+		})
+	}
+}
+
+func TestFrontmatterRoundTrip(t *testing.T) {
+	meta := map[string]string{
+		"title":       "Главная: страница",
+		"author":      "ivan",
+		"description": `it's a "test" # not a comment`,
+		"empty":       "",
+	}
+	got, text := parseFrontmatter(append(formatFrontmatter(meta), "body"...))
+	if !reflect.DeepEqual(got, meta) || string(text) != "body" {
+		t.Errorf("round trip = %v, %q; want %v, body", got, text, meta)
+	}
+	// Ключи, которые нельзя прочитать обратно, не записываются.
+	got, _ = parseFrontmatter(formatFrontmatter(map[string]string{"a:b": "x", "": "y", "ok": "z"}))
+	if !reflect.DeepEqual(got, map[string]string{"ok": "z"}) {
+		t.Errorf("unreadable keys: parsed %v, want only ok", got)
+	}
+}
+
+// Метаданные переживают сохранение и чтение в обоих хранилищах,
+// а /view/ показывает их вместо блока в тексте.
+func TestFrontmatterSaveAndView(t *testing.T) {
+	for _, b := range storageBackends {
+		t.Run(b.name, func(t *testing.T) {
+			store = b.open(t)
+			if err := store.Save(&Page{Title: "New", Body: []byte("text"), Meta: map[string]string{"author": "ivan"}}); err != nil {
+				t.Fatal(err)
+			}
+			written := "---\ntitle: Kept\n---\nold text"
+			if err := store.Save(&Page{Title: "Old", Body: []byte(written), Meta: map[string]string{"title": "Ignored"}}); err != nil {
+				t.Fatal(err)
+			}
+			for title, want := range map[string]struct {
+				meta map[string]string
+				body string
+			}{
+				"New": {map[string]string{"author": "ivan"}, "---\nauthor: ivan\n---\ntext"},
+				"Old": {map[string]string{"title": "Kept"}, written},
+			} {
+				p, err := store.Load(title)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !reflect.DeepEqual(p.Meta, want.meta) || string(p.Body) != want.body {
+					t.Errorf("%s = %v, %q; want %v, %q", title, p.Meta, p.Body, want.meta, want.body)
+				}
+			}
+
+			w := serve(makeHandler(pageResourceHandler), http.MethodGet, "/view/New", "")
+			if !strings.Contains(w.Body.String(), "Author: ivan") || strings.Contains(w.Body.String(), "---") {
+				t.Errorf("view shows the raw block or no author:\n%s", w.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"mime"
+	"net/http"
+	"os"
+	"time"
+
+	graphql "github.com/graph-gophers/graphql-go"
+	"github.com/graph-gophers/graphql-go/relay"
+)
+
+// graphqlSchema - схема POST /graphql. Запросы читают страницы
+// с теми же правами, что и /view/, а изменения требуют входа.
+const graphqlSchema = `
+schema {
+	query: Query
+	mutation: Mutation
+}
+
+scalar Time
+
+type Query {
+	page(title: String!): Page
+	pages(tag: String, limit: Int): [Page!]!
+}
+
+type Mutation {
+	savePage(title: String!, body: String!): Page!
+	deletePage(title: String!): Boolean!
+}
+
+type Page {
+	title: String!
+	slug: String!
+	body: String!
+	tags: [String!]!
+	public: Boolean!
+	createdAt: Time
+	updatedAt: Time
+}
+`
+
+var (
+	errAuthRequired   = errors.New("authentication required")
+	errEditorRequired = errors.New("your account may not edit pages")
+)
+
+// graphqlRequest возвращает HTTP-запрос, который выполняет GraphQL:
+// от него зависят права на чтение и запись в журнал аудита.
+func graphqlRequest(ctx context.Context) *http.Request {
+	return ctx.Value(graphqlRequestContextKey).(*http.Request)
+}
+
+type graphqlResolver struct{}
+
+type pageResolver struct {
+	p    *Page
+	meta *PageMeta
+}
+
+func (r *pageResolver) Title() string            { return r.p.Title }
+func (r *pageResolver) Slug() string             { return r.p.Slug }
+func (r *pageResolver) Body() string             { return string(r.p.Body) }
+func (r *pageResolver) Tags() []string           { return r.p.Tags }
+func (r *pageResolver) Public() bool             { return r.meta.Public }
+func (r *pageResolver) CreatedAt() *graphql.Time { return graphqlTime(r.p.CreatedAt) }
+func (r *pageResolver) UpdatedAt() *graphql.Time { return graphqlTime(r.p.UpdatedAt) }
+
+func graphqlTime(t time.Time) *graphql.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &graphql.Time{Time: t}
+}
+
+// resolvePage загружает страницу title вместе с метаданными и slug.
+func resolvePage(title string) (*pageResolver, error) {
+	p, err := store.Load(title)
+	if err != nil {
+		return nil, err
+	}
+	meta, err := metas.Load(title)
+	if err != nil {
+		return nil, err
+	}
+	if p.Slug, err = slugs.Get(title); err != nil {
+		return nil, err
+	}
+	p.Tags = pageTagsFor(p, meta)
+	return &pageResolver{p: p, meta: meta}, nil
+}
+
+// Page возвращает страницу или null, если ее нет или она закрыта
+// для автора запроса.
+func (*graphqlResolver) Page(ctx context.Context, args struct{ Title string }) (*pageResolver, error) {
+	title := normalizeTitle(args.Title)
+	if err := validateTitle(title); err != nil {
+		return nil, err
+	}
+	ok, err := canRead(graphqlRequest(ctx), title)
+	if err != nil || !ok {
+		return nil, err
+	}
+	p, err := resolvePage(title)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	return p, err
+}
+
+// Pages возвращает доступные страницы по алфавиту: все или только
+// с тегом tag, не больше limit.
+func (*graphqlResolver) Pages(ctx context.Context, args struct {
+	Tag   *string
+	Limit *int32
+}) ([]*pageResolver, error) {
+	titles, err := store.List()
+	if err != nil {
+		return nil, err
+	}
+	if titles, err = visibleTitles(graphqlRequest(ctx), titles); err != nil {
+		return nil, err
+	}
+	tag := ""
+	if args.Tag != nil {
+		if t := normalizeTags([]string{*args.Tag}); len(t) > 0 {
+			tag = t[0]
+		}
+	}
+	pages := []*pageResolver{}
+	for _, t := range titles {
+		if args.Limit != nil && len(pages) >= int(*args.Limit) {
+			break
+		}
+		p, err := resolvePage(t)
+		if err != nil {
+			return nil, err
+		}
+		if tag == "" || hasTag(p.p.Tags, tag) {
+			pages = append(pages, p)
+		}
+	}
+	return pages, nil
+}
+
+func hasTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// SavePage создает или перезаписывает страницу, как PUT
+// /api/v1/pages/{title}: страницу, которую держит открытая форма
+// редактирования, можно сохранить только с ее токеном в заголовке
+// X-Lock-Token.
+func (*graphqlResolver) SavePage(ctx context.Context, args struct{ Title, Body string }) (*pageResolver, error) {
+	r := graphqlRequest(ctx)
+	if userFromContext(ctx) == nil {
+		return nil, errAuthRequired
+	}
+	if !isEditor(userFromContext(ctx)) {
+		return nil, errEditorRequired
+	}
+	if readOnly {
+		return nil, errReadOnly
+	}
+	title := normalizeTitle(args.Title)
+	if err := validateTitle(title); err != nil {
+		return nil, err
+	}
+	lockToken := r.Header.Get(lockTokenHeader)
+	if l := checkEditLock(title, lockToken, time.Now()); l != nil {
+		return nil, l
+	}
+	action := auditEdit
+	if _, err := store.Load(title); errors.Is(err, os.ErrNotExist) {
+		action = auditCreate
+	}
+	if err := store.Save(&Page{Title: title, Body: []byte(args.Body), LastEditor: editorName(r)}); err != nil {
+		return nil, err
+	}
+	if _, err := slugs.Assign(title); err != nil {
+		return nil, err
+	}
+	releaseEditLock(title, lockToken)
+	audit(r, action, title)
+	return resolvePage(title)
+}
+
+// DeletePage перемещает страницу в корзину. Если страницы нет,
+// возвращает false.
+func (*graphqlResolver) DeletePage(ctx context.Context, args struct{ Title string }) (bool, error) {
+	if userFromContext(ctx) == nil {
+		return false, errAuthRequired
+	}
+	if !isEditor(userFromContext(ctx)) {
+		return false, errEditorRequired
+	}
+	if readOnly {
+		return false, errReadOnly
+	}
+	title := normalizeTitle(args.Title)
+	if l := checkEditLock(title, graphqlRequest(ctx).Header.Get(lockTokenHeader), time.Now()); l != nil {
+		return false, l
+	}
+	err := store.Delete(title)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	audit(graphqlRequest(ctx), auditDelete, title)
+	return true, nil
+}
+
+// graphqlHandler обслуживает POST /graphql. Тело принимается только
+// как application/json: такой запрос браузер не отправит с чужого
+// сайта без CORS, так что от подделки запросов мутации защищены
+// без CSRF-токена.
+func graphqlHandler() http.Handler {
+	h := &relay.Handler{Schema: graphql.MustParseSchema(graphqlSchema, &graphqlResolver{})}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !allowMethod(w, r, http.MethodPost) {
+			return
+		}
+		if mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mt != "application/json" {
+			writeJSONError(w, http.StatusUnsupportedMediaType, "Content-Type must be application/json")
+			return
+		}
+		// Текст страницы в JSON может занять больше байт, чем на диске.
+		r.Body = http.MaxBytesReader(w, r.Body, 2*maxPageSize)
+		h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), graphqlRequestContextKey, r)))
+	})
+}
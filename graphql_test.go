@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	graphql "github.com/graph-gophers/graphql-go"
+	gqlerrors "github.com/graph-gophers/graphql-go/errors"
+	"github.com/graph-gophers/graphql-go/gqltesting"
+)
+
+// graphqlContext - контекст резолверов для запроса от имени user
+// (nil - без входа), как его собирает graphqlHandler.
+func graphqlContext(user *User) context.Context {
+	r := httptest.NewRequest(http.MethodPost, "/graphql", nil)
+	if user != nil {
+		r = r.WithContext(context.WithValue(r.Context(), userContextKey, user))
+	}
+	return context.WithValue(r.Context(), graphqlRequestContextKey, r)
+}
+
+func TestGraphQL(t *testing.T) {
+	testDataDir(t)
+	savePage(t, "Go", "#go\nabout Go")
+	savePage(t, "Web", "#web\nabout the web")
+	savePage(t, "Secret", "#go\nhidden")
+	if err := metas.Update("Secret", func(m *PageMeta) { m.Public = false }); err != nil {
+		t.Fatal(err)
+	}
+	schema := graphql.MustParseSchema(graphqlSchema, &graphqlResolver{})
+	anonymous := graphqlContext(nil)
+	bob := graphqlContext(&User{Username: "bob"})
+
+	gqltesting.RunTests(t, []*gqltesting.Test{
+		{
+			Context:        anonymous,
+			Schema:         schema,
+			Query:          `{ page(title: "Go") { title body tags public } }`,
+			ExpectedResult: `{"page":{"title":"Go","body":"#go\nabout Go","tags":["go"],"public":true}}`,
+		},
+		{
+			Context:        anonymous,
+			Schema:         schema,
+			Query:          `{ missing: page(title: "Missing") { title } hidden: page(title: "Secret") { title } }`,
+			ExpectedResult: `{"missing":null,"hidden":null}`,
+		},
+		{
+			Context:        anonymous,
+			Schema:         schema,
+			Query:          `{ pages(tag: "go") { title } }`,
+			ExpectedResult: `{"pages":[{"title":"Go"}]}`,
+		},
+		{
+			Context:        bob,
+			Schema:         schema,
+			Query:          `{ pages(tag: "go") { title } }`,
+			ExpectedResult: `{"pages":[{"title":"Go"},{"title":"Secret"}]}`,
+		},
+		{
+			Context:        bob,
+			Schema:         schema,
+			Query:          `{ pages(limit: 1) { title } }`,
+			ExpectedResult: `{"pages":[{"title":"Go"}]}`,
+		},
+		{
+			Context:        bob,
+			Schema:         schema,
+			Query:          `mutation { savePage(title: "New", body: "#news\ntext") { title slug body tags } }`,
+			ExpectedResult: `{"savePage":{"title":"New","slug":"new","body":"#news\ntext","tags":["news"]}}`,
+		},
+		{
+			Context:        anonymous,
+			Schema:         schema,
+			Query:          `mutation { savePage(title: "Other", body: "text") { title } }`,
+			ExpectedResult: `null`,
+			ExpectedErrors: []*gqlerrors.QueryError{{
+				Message:       errAuthRequired.Error(),
+				Path:          []interface{}{"savePage"},
+				ResolverError: errAuthRequired,
+			}},
+		},
+		{
+			Context:        bob,
+			Schema:         schema,
+			Query:          `mutation { deleted: deletePage(title: "Web") again: deletePage(title: "Missing") }`,
+			ExpectedResult: `{"deleted":true,"again":false}`,
+		},
+		{
+			Context:        bob,
+			Schema:         schema,
+			Query:          `{ __type(name: "Page") { name } }`,
+			ExpectedResult: `{"__type":{"name":"Page"}}`,
+		},
+	})
+}
+
+func TestGraphQLHandler(t *testing.T) {
+	testDataDir(t)
+	savePage(t, "Go", "about Go")
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		wantStatus  int
+		wantBody    string
+	}{
+		{
+			name:        "query",
+			contentType: "application/json",
+			body:        `{"query":"{ page(title: \"Go\") { title body } }"}`,
+			wantStatus:  http.StatusOK,
+			wantBody:    `{"data":{"page":{"title":"Go","body":"about Go"}}}`,
+		},
+		{
+			name:        "form body",
+			contentType: "application/x-www-form-urlencoded",
+			body:        `query={}`,
+			wantStatus:  http.StatusUnsupportedMediaType,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", tt.contentType)
+			w := httptest.NewRecorder()
+			graphqlHandler().ServeHTTP(w, r)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if tt.wantBody != "" && strings.TrimSpace(w.Body.String()) != tt.wantBody {
+				t.Errorf("body = %s, want %s", w.Body, tt.wantBody)
+			}
+		})
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"compress/gzip"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// compressedTypes - префиксы типов содержимого, которые уже сжаты
+// и повторно не сжимаются.
+var compressedTypes = []string{
+	"image/", "video/", "audio/",
+	"application/zip", "application/gzip", "application/x-gzip",
+	"application/octet-stream", "font/woff",
+}
+
+func isCompressedType(contentType string) bool {
+	for _, t := range compressedTypes {
+		if strings.HasPrefix(contentType, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// gzipResponseWriter решает, сжимать ли ответ, когда о нем известно
+// достаточно. Тип содержимого и код ответа проверяются при отправке
+// заголовков, а размер - по мере записи тела. Первые minSize байт
+// копятся в буфере: если ответ закончился раньше, он уходит несжатым,
+// потому что gzip для коротких ответов только добавляет накладные
+// расходы.
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	minSize int
+
+	status  int    // код из WriteHeader, 0 - заголовки еще не отправлены
+	pending bool   // решение о сжатии еще не принято
+	buf     []byte // начало тела, пока pending
+	gz      *gzip.Writer
+}
+
+func (w *gzipResponseWriter) WriteHeader(status int) {
+	if w.status != 0 {
+		return
+	}
+	w.status = status
+	h := w.Header()
+	if status < 200 || status == http.StatusNoContent || status == http.StatusNotModified ||
+		h.Get("Content-Encoding") != "" || isCompressedType(h.Get("Content-Type")) {
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+	if n, err := strconv.Atoi(h.Get("Content-Length")); err == nil && n < w.minSize {
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+	w.pending = true
+}
+
+// decide отправляет отложенные заголовки и накопленное начало тела,
+// сжимая ответ, если compress.
+func (w *gzipResponseWriter) decide(compress bool) error {
+	w.pending = false
+	if compress {
+		h := w.Header()
+		h.Set("Content-Encoding", "gzip")
+		// Длина несжатого тела к сжатому ответу не относится.
+		h.Del("Content-Length")
+		w.gz = gzip.NewWriter(w.ResponseWriter)
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+	buf := w.buf
+	w.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	_, err := w.write(buf)
+	return err
+}
+
+func (w *gzipResponseWriter) write(b []byte) (int, error) {
+	if w.gz == nil {
+		return w.ResponseWriter.Write(b)
+	}
+	return w.gz.Write(b)
+}
+
+func (w *gzipResponseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		// Как и net/http, определяем тип по началу тела, если
+		// обработчик его не задал.
+		if w.Header().Get("Content-Type") == "" {
+			w.Header().Set("Content-Type", http.DetectContentType(b))
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+	if !w.pending {
+		return w.write(b)
+	}
+	w.buf = append(w.buf, b...)
+	if len(w.buf) >= w.minSize {
+		if err := w.decide(true); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+// Flush отправляет клиенту все, что уже записано, чтобы потоковые
+// ответы не застревали в буфере. Ответ, который к этому моменту
+// еще короче minSize, дальше идет без сжатия.
+func (w *gzipResponseWriter) Flush() {
+	if w.pending {
+		w.decide(false)
+	}
+	if w.gz != nil {
+		w.gz.Flush()
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *gzipResponseWriter) Unwrap() http.ResponseWriter { return w.ResponseWriter }
+
+// Close отправляет короткий ответ, если он еще в буфере,
+// или дописывает конец gzip-потока.
+func (w *gzipResponseWriter) Close() error {
+	if w.pending {
+		return w.decide(false)
+	}
+	if w.gz == nil {
+		return nil
+	}
+	return w.gz.Close()
+}
+
+// defaultCompressMinSize - ответы короче этого размера не сжимаются:
+// примерно столько помещается в один TCP-пакет.
+const defaultCompressMinSize = 1400
+
+// compressionMiddleware сжимает ответы gzip для клиентов, которые
+// прислали Accept-Encoding: gzip. Ответы короче minSize байт
+// и уже сжатые типы содержимого отправляются как есть.
+func compressionMiddleware(minSize int) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("Vary", "Accept-Encoding")
+			// Соединение WebSocket после Upgrade - уже не HTTP-ответ.
+			if !acceptsGzip(r) || r.Method == http.MethodHead || r.Header.Get("Upgrade") != "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			gw := &gzipResponseWriter{ResponseWriter: w, minSize: minSize}
+			defer gw.Close()
+			next.ServeHTTP(gw, r)
+		})
+	}
+}
+
+func acceptsGzip(r *http.Request) bool {
+	for _, enc := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		enc = strings.TrimSpace(enc)
+		if enc == "gzip" || strings.HasPrefix(enc, "gzip;") && !strings.HasSuffix(enc, "q=0") {
+			return true
+		}
+	}
+	return false
+}
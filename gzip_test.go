@@ -0,0 +1,112 @@
+package main
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// gzipBody возвращает тело ответа, распаковывая его, если оно сжато.
+func gzipBody(t *testing.T, w *httptest.ResponseRecorder) string {
+	t.Helper()
+	if w.Header().Get("Content-Encoding") != "gzip" {
+		return w.Body.String()
+	}
+	zr, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatalf("response is not a gzip stream: %v", err)
+	}
+	data, err := ioutil.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("broken gzip stream: %v", err)
+	}
+	return string(data)
+}
+
+// Ответ, записанный по частям и со сбросом буфера посередине,
+// распаковывается в исходный текст.
+func TestGzipStream(t *testing.T) {
+	page := strings.Repeat("wiki page text ", 1000)
+	h := compressionMiddleware(defaultCompressMinSize)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		half := len(page) / 2
+		w.Write([]byte(page[:half]))
+		w.(http.Flusher).Flush()
+		w.Write([]byte(page[half:]))
+	}))
+	r := httptest.NewRequest(http.MethodGet, "/view/Foo", nil)
+	r.Header.Set("Accept-Encoding", "gzip, deflate")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if got := w.Header().Get("Content-Encoding"); got != "gzip" {
+		t.Fatalf("Content-Encoding = %q, want gzip", got)
+	}
+	if w.Body.Len() >= len(page) {
+		t.Errorf("compressed body is %d bytes, original %d", w.Body.Len(), len(page))
+	}
+	if got := gzipBody(t, w); got != page {
+		t.Errorf("decompressed body differs from the original (%d vs %d bytes)", len(got), len(page))
+	}
+}
+
+func TestCompressionMiddleware(t *testing.T) {
+	large := strings.Repeat("a", defaultCompressMinSize)
+	small := strings.Repeat("a", defaultCompressMinSize-1)
+	tests := []struct {
+		name, method, acceptEncoding string
+		upgrade                      bool
+		contentType, body            string
+		status                       int
+		wantGzip                     bool
+	}{
+		{"at the minimum size", http.MethodGet, "gzip", false, "text/html", large, http.StatusOK, true},
+		{"below the minimum size", http.MethodGet, "gzip", false, "text/html", small, http.StatusOK, false},
+		{"detected content type", http.MethodGet, "gzip", false, "", large, http.StatusOK, true},
+		{"error page", http.MethodGet, "gzip", false, "text/html", large, http.StatusNotFound, true},
+		{"client without gzip", http.MethodGet, "", false, "text/html", large, http.StatusOK, false},
+		{"gzip refused with q=0", http.MethodGet, "gzip;q=0, identity", false, "text/html", large, http.StatusOK, false},
+		{"gzip with a weight", http.MethodGet, "br, gzip;q=0.8", false, "text/html", large, http.StatusOK, true},
+		{"image", http.MethodGet, "gzip", false, "image/png", large, http.StatusOK, false},
+		{"zip archive", http.MethodGet, "gzip", false, "application/zip", large, http.StatusOK, false},
+		{"binary", http.MethodGet, "gzip", false, "application/octet-stream", large, http.StatusOK, false},
+		{"HEAD", http.MethodHead, "gzip", false, "text/html", large, http.StatusOK, false},
+		{"Upgrade", http.MethodGet, "gzip", true, "text/html", large, http.StatusOK, false},
+		{"not modified", http.MethodGet, "gzip", false, "text/html", "", http.StatusNotModified, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := compressionMiddleware(defaultCompressMinSize)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.contentType != "" {
+					w.Header().Set("Content-Type", tt.contentType)
+				}
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			r := httptest.NewRequest(tt.method, "/", nil)
+			if tt.acceptEncoding != "" {
+				r.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			}
+			if tt.upgrade {
+				r.Header.Set("Connection", "Upgrade")
+				r.Header.Set("Upgrade", "websocket")
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d", w.Code, tt.status)
+			}
+			if gz := w.Header().Get("Content-Encoding") == "gzip"; gz != tt.wantGzip {
+				t.Fatalf("compressed = %v, want %v", gz, tt.wantGzip)
+			}
+			if v := w.Header().Get("Vary"); v != "Accept-Encoding" {
+				t.Errorf("Vary = %q, want Accept-Encoding", v)
+			}
+			if got := gzipBody(t, w); got != tt.body {
+				t.Errorf("body differs from the original (%d vs %d bytes)", len(got), len(tt.body))
+			}
+		})
+	}
+}
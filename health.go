@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// startTime - время запуска сервера для uptime_seconds.
+var startTime = time.Now()
+
+// healthTimeout - сколько ждать проверки хранилища, прежде чем
+// считать его недоступным.
+var healthTimeout = 2 * time.Second
+
+// checkWithTimeout выполняет check, но ждет не дольше healthTimeout.
+func checkWithTimeout(check func() error) error {
+	done := make(chan error, 1)
+	go func() { done <- check() }()
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(healthTimeout):
+		return errors.New("health check timed out")
+	}
+}
+
+// checkTemplates проверяет, что все шаблоны из templateNames разобраны.
+func checkTemplates() error {
+	t := templates.Templates()
+	for _, name := range templateNames {
+		if t.Lookup(name+".html") == nil {
+			return fmt.Errorf("template %s.html is not loaded", name)
+		}
+	}
+	return nil
+}
+
+// Функция healthHandler - проверка живости для балансировщика:
+// отвечает "ok", не обращаясь ни к хранилищу, ни к диску.
+func healthHandler(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet, http.MethodHead) {
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	w.Write([]byte("ok"))
+}
+
+// Функция readyHandler проверяет, что сервер готов принимать запросы:
+// хранилище исправно и все шаблоны разобраны. Отвечает 200 и
+// {"status":"ok",...} или 503 с описанием ошибки.
+func readyHandler(w http.ResponseWriter, r *http.Request) {
+	if err := checkWithTimeout(store.Health); err != nil {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]interface{}{
+			"status":  "degraded",
+			"storage": err.Error(),
+		})
+		return
+	}
+	if err := checkTemplates(); err != nil {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]interface{}{
+			"status":    "degraded",
+			"storage":   "ok",
+			"templates": err.Error(),
+		})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"status":         "ok",
+		"storage":        "ok",
+		"templates":      "ok",
+		"uptime_seconds": int64(time.Since(startTime).Seconds()),
+	})
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"html/template"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// healthStorage - хранилище, проверка которого возвращает err
+// через delay.
+type healthStorage struct {
+	Storage
+	err   error
+	delay time.Duration
+}
+
+func (s healthStorage) Health() error {
+	time.Sleep(s.delay)
+	return s.err
+}
+
+func TestHealthz(t *testing.T) {
+	for _, method := range []string{http.MethodGet, http.MethodHead} {
+		w := serve(healthHandler, method, "/healthz", "")
+		if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "text/plain" {
+			t.Errorf("%s /healthz: status = %d, Content-Type = %q; want 200 text/plain", method, w.Code, w.Header().Get("Content-Type"))
+		}
+		if method == http.MethodGet && w.Body.String() != "ok" {
+			t.Errorf("GET /healthz body = %q, want ok", w.Body)
+		}
+	}
+	if w := serve(healthHandler, http.MethodPost, "/healthz", ""); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST /healthz: status = %d, want 405", w.Code)
+	}
+}
+
+func TestReadyz(t *testing.T) {
+	oldTimeout := healthTimeout
+	healthTimeout = 50 * time.Millisecond
+	t.Cleanup(func() { healthTimeout = oldTimeout })
+	broken := &TemplateManager{t: template.Must(template.New("view.html").Parse("view"))}
+
+	tests := []struct {
+		name          string
+		err           error
+		delay         time.Duration
+		templates     *TemplateManager
+		want          int
+		wantStatus    string
+		wantStorage   string
+		wantTemplates string
+	}{
+		{"healthy", nil, 0, templates, http.StatusOK, "ok", "ok", "ok"},
+		{"storage failure", errors.New("disk is read-only"), 0, templates, http.StatusServiceUnavailable, "degraded", "disk is read-only", ""},
+		{"storage timeout", nil, time.Second, templates, http.StatusServiceUnavailable, "degraded", "health check timed out", ""},
+		{"templates missing", nil, 0, broken, http.StatusServiceUnavailable, "degraded", "ok", "template index.html is not loaded"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testDataDir(t)
+			store = healthStorage{store, tt.err, tt.delay}
+			oldTemplates := templates
+			templates = tt.templates
+			defer func() { templates = oldTemplates }()
+
+			start := time.Now()
+			w := serve(readyHandler, http.MethodGet, "/readyz", "")
+			if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+				t.Errorf("/readyz answered after %v, want it to give up after healthTimeout", elapsed)
+			}
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d", w.Code, tt.want)
+			}
+			var resp struct {
+				Status, Storage, Templates string
+				Uptime                     *int64 `json:"uptime_seconds"`
+			}
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.Status != tt.wantStatus || resp.Storage != tt.wantStorage || resp.Templates != tt.wantTemplates {
+				t.Errorf("response = %+v, want status %q, storage %q, templates %q", resp, tt.wantStatus, tt.wantStorage, tt.wantTemplates)
+			}
+			if (resp.Uptime != nil) != (tt.want == http.StatusOK) {
+				t.Errorf("uptime_seconds present = %v, want it only when healthy", resp.Uptime != nil)
+			}
+		})
+	}
+}
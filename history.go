@@ -0,0 +1,449 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Version - одна сохраненная версия страницы: порядковый номер,
+// время, когда она была заменена новой, и ее содержимое.
+type Version struct {
+	Number int       `json:"version"`
+	Time   time.Time `json:"time"`
+	Body   []byte    `json:"body"`
+}
+
+// VersionStore хранит историю страниц в каталоге Dir. Для каждой
+// страницы заводится файл Dir/<title>.history, в который по одной
+// JSON-строке дописываются старые версии. Если Keep больше нуля,
+// хранятся только Keep последних версий.
+type VersionStore struct {
+	Dir  string
+	Keep int
+}
+
+var errVersionNotFound = errors.New("version not found")
+
+// versions - хранилище истории, которое использует Page.save().
+var versions = &VersionStore{Dir: "history"}
+
+func (s *VersionStore) path(title string) string {
+	return filepath.Join(s.Dir, title+".history")
+}
+
+// Save дописывает body в историю страницы title как новую версию
+// и возвращает ее. Каталог истории создается при первом вызове.
+// Номера версий не переиспользуются, даже когда старые удалены.
+func (s *VersionStore) Save(title string, body []byte) (*Version, error) {
+	list, err := s.List(title)
+	if err != nil {
+		return nil, err
+	}
+	v := &Version{Number: 1, Time: time.Now(), Body: body}
+	if len(list) > 0 {
+		v.Number = list[len(list)-1].Number + 1
+	}
+	line, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(s.Dir, 0700); err != nil {
+		return nil, err
+	}
+	if s.Keep > 0 && len(list) >= s.Keep {
+		// Лимит достигнут: файл переписывается целиком без
+		// самых старых версий.
+		var buf bytes.Buffer
+		for _, old := range list[len(list)-s.Keep+1:] {
+			b, err := json.Marshal(old)
+			if err != nil {
+				return nil, err
+			}
+			buf.Write(append(b, '\n'))
+		}
+		buf.Write(append(line, '\n'))
+		return v, writeFileAtomic(s.path(title), buf.Bytes(), 0600)
+	}
+	f, err := os.OpenFile(s.path(title), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return v, f.Close()
+}
+
+// List возвращает все версии страницы от самой старой к самой новой.
+// Если истории еще нет, возвращается пустой срез без ошибки.
+func (s *VersionStore) List(title string) ([]Version, error) {
+	f, err := os.Open(s.path(title))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var list []Version
+	sc := bufio.NewScanner(f)
+	// Строка истории содержит все тело страницы, поэтому
+	// стандартного буфера в 64 КБ может не хватить.
+	sc.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for sc.Scan() {
+		var v Version
+		if err := json.Unmarshal(sc.Bytes(), &v); err != nil {
+			return nil, err
+		}
+		list = append(list, v)
+	}
+	return list, sc.Err()
+}
+
+// Get возвращает версию с номером n или errVersionNotFound.
+func (s *VersionStore) Get(title string, n int) (*Version, error) {
+	list, err := s.List(title)
+	if err != nil {
+		return nil, err
+	}
+	for i := range list {
+		if list[i].Number == n {
+			return &list[i], nil
+		}
+	}
+	return nil, errVersionNotFound
+}
+
+var historyPath = regexp.MustCompile(`^/history/(` + titleChars + `)(?:/([0-9]+))?$`)
+var diffPath = regexp.MustCompile(`^/diff/(` + titleChars + `)/([0-9]+)/([0-9]+)$`)
+var diffViewPath = regexp.MustCompile(`^/diff/(` + titleChars + `)$`)
+
+// Функция historyHandler обрабатывает два вида запросов:
+// /history/{title} показывает список версий (время и размер),
+// а /history/{title}/{version} - содержимое одной версии.
+func historyHandler(w http.ResponseWriter, r *http.Request) {
+	m := historyPath.FindStringSubmatch(r.URL.Path)
+	if m == nil {
+		notFoundHandler(w, r)
+		return
+	}
+	title := m[1]
+	if ok, err := canRead(r, title); err != nil || !ok {
+		if err != nil {
+			errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		} else {
+			requireLogin(w, r)
+		}
+		return
+	}
+	if m[2] == "" {
+		list, err := versions.List(title)
+		if err != nil {
+			errorHandler(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+		renderTemplate(w, "history", struct {
+			Title    string
+			Versions []Version
+		}{title, list})
+		return
+	}
+	n, _ := strconv.Atoi(m[2])
+	v, err := versions.Get(title, n)
+	if err == errVersionNotFound {
+		notFoundHandler(w, r)
+		return
+	}
+	if err != nil {
+		errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	renderTemplate(w, "version", struct {
+		Title string
+		*Version
+	}{title, v})
+}
+
+// Функция diffHandler отдает unified diff между двумя версиями
+// страницы в виде обычного текста: /diff/{title}/{v1}/{v2}.
+// Запрос /diff/{title}?from={v1}&to={v2} показывает то же сравнение
+// HTML-страницей с подсветкой строк (см. diffViewHandler).
+func diffHandler(w http.ResponseWriter, r *http.Request) {
+	if diffViewPath.MatchString(r.URL.Path) {
+		diffViewHandler(w, r)
+		return
+	}
+	m := diffPath.FindStringSubmatch(r.URL.Path)
+	if m == nil {
+		notFoundHandler(w, r)
+		return
+	}
+	title := m[1]
+	if ok, err := canRead(r, title); err != nil || !ok {
+		if err != nil {
+			errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		} else {
+			requireLogin(w, r)
+		}
+		return
+	}
+	n1, _ := strconv.Atoi(m[2])
+	n2, _ := strconv.Atoi(m[3])
+	v1, err := versions.Get(title, n1)
+	if err == nil {
+		var v2 *Version
+		if v2, err = versions.Get(title, n2); err == nil {
+			var diff string
+			diff, err = unifiedDiff(
+				fmt.Sprintf("%s@%d", title, n1), fmt.Sprintf("%s@%d", title, n2),
+				v1.Body, v2.Body, 3)
+			if err == nil {
+				w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+				fmt.Fprint(w, diff)
+				return
+			}
+		}
+	}
+	switch err {
+	case errVersionNotFound:
+		notFoundHandler(w, r)
+	case errDiffTooLarge:
+		errorHandler(w, r, http.StatusUnprocessableEntity, diffTooLargeMessage)
+	default:
+		errorHandler(w, r, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// diffTooLargeMessage - ответ на сравнение, от которого diffLines
+// отказывается (см. errDiffTooLarge).
+const diffTooLargeMessage = "These versions are too large or too different to compare. Open them separately from the history page."
+
+// Функция diffViewHandler показывает построчное сравнение двух
+// версий страницы: добавленные строки выделены зеленым,
+// удаленные - красным. Если одной из версий нет, отвечает 404.
+func diffViewHandler(w http.ResponseWriter, r *http.Request) {
+	title := diffViewPath.FindStringSubmatch(r.URL.Path)[1]
+	if ok, err := canRead(r, title); err != nil || !ok {
+		if err != nil {
+			errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		} else {
+			requireLogin(w, r)
+		}
+		return
+	}
+	from, err1 := strconv.Atoi(r.URL.Query().Get("from"))
+	to, err2 := strconv.Atoi(r.URL.Query().Get("to"))
+	if err1 != nil || err2 != nil {
+		errorHandler(w, r, http.StatusBadRequest, "Both from and to must be version numbers")
+		return
+	}
+	v1, err := versions.Get(title, from)
+	var v2 *Version
+	if err == nil {
+		v2, err = versions.Get(title, to)
+	}
+	if err == errVersionNotFound {
+		notFoundHandler(w, r)
+		return
+	}
+	if err != nil {
+		errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	lines, err := diffLines(splitLines(v1.Body), splitLines(v2.Body))
+	if err == errDiffTooLarge {
+		errorHandler(w, r, http.StatusUnprocessableEntity, diffTooLargeMessage)
+		return
+	}
+	renderTemplate(w, "diff", struct {
+		Title    string
+		From, To int
+		Lines    []diffOp
+	}{title, from, to, lines})
+}
+
+// diffOp - одна строка результата сравнения: ' ' - строка есть
+// в обеих версиях, '-' - только в старой, '+' - только в новой.
+type diffOp struct {
+	Kind byte
+	Text string
+}
+
+func splitLines(b []byte) []string {
+	s := strings.ReplaceAll(string(b), "\r\n", "\n")
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// maxDiffLines - наибольшее число строк в каждой из сравниваемых
+// версий, maxDiffEdits - наибольшее число различающихся строк между
+// ними. Сравнение больших или слишком разных текстов заняло бы много
+// времени и памяти, поэтому на такие diffLines отвечает
+// errDiffTooLarge.
+const (
+	maxDiffLines = 20000
+	maxDiffEdits = 1000
+)
+
+var errDiffTooLarge = errors.New("versions are too large or too different to compare")
+
+// diffLines сравнивает два набора строк алгоритмом Майерса: время
+// O((N+M)·D), где D - число различающихся строк. На каждом шаге d
+// запоминается только 2d+1 чисел, так что памяти нужно O(D²),
+// а D ограничено maxDiffEdits.
+func diffLines(a, b []string) ([]diffOp, error) {
+	if len(a) > maxDiffLines || len(b) > maxDiffLines {
+		return nil, errDiffTooLarge
+	}
+	n, m := len(a), len(b)
+	max := n + m
+	if max > maxDiffEdits {
+		max = maxDiffEdits
+	}
+	// v[off+k] - самая дальняя x на диагонали k = x - y;
+	// trace[d] - копия v[-d..d] после шага d.
+	off := max + 1
+	v := make([]int, 2*max+3)
+	var trace [][]int
+	for d := 0; d <= max; d++ {
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[off+k-1] < v[off+k+1]) {
+				x = v[off+k+1]
+			} else {
+				x = v[off+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[off+k] = x
+			if x >= n && y >= m {
+				return diffBacktrack(a, b, trace), nil
+			}
+		}
+		trace = append(trace, append([]int(nil), v[off-d:off+d+1]...))
+	}
+	return nil, errDiffTooLarge
+}
+
+// diffBacktrack восстанавливает по trace путь от концов a и b
+// к их началам и возвращает операции в прямом порядке.
+func diffBacktrack(a, b []string, trace [][]int) []diffOp {
+	var ops []diffOp
+	x, y := len(a), len(b)
+	for d := len(trace); d > 0; d-- {
+		v := trace[d-1]
+		at := func(k int) int { return v[k+d-1] }
+		k := x - y
+		prevK := k - 1
+		if k == -d || (k != d && at(k-1) < at(k+1)) {
+			prevK = k + 1
+		}
+		prevX := at(prevK)
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			x--
+			y--
+			ops = append(ops, diffOp{' ', a[x]})
+		}
+		if x == prevX {
+			y--
+			ops = append(ops, diffOp{'+', b[y]})
+		} else {
+			x--
+			ops = append(ops, diffOp{'-', a[x]})
+		}
+	}
+	for x > 0 && y > 0 {
+		x--
+		y--
+		ops = append(ops, diffOp{' ', a[x]})
+	}
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+	return ops
+}
+
+// unifiedDiff формирует diff в формате `diff -u` с context строками
+// контекста вокруг каждого изменения. Для одинаковых текстов
+// возвращается пустая строка.
+func unifiedDiff(fromName, toName string, a, b []byte, context int) (string, error) {
+	ops, err := diffLines(splitLines(a), splitLines(b))
+	if err != nil {
+		return "", err
+	}
+	// aPos[k] и bPos[k] - номера строк в старом и новом тексте
+	// перед операцией k.
+	aPos := make([]int, len(ops)+1)
+	bPos := make([]int, len(ops)+1)
+	var changes []int
+	for k, op := range ops {
+		aPos[k+1], bPos[k+1] = aPos[k], bPos[k]
+		if op.Kind != '+' {
+			aPos[k+1]++
+		}
+		if op.Kind != '-' {
+			bPos[k+1]++
+		}
+		if op.Kind != ' ' {
+			changes = append(changes, k)
+		}
+	}
+	if len(changes) == 0 {
+		return "", nil
+	}
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "--- %s\n+++ %s\n", fromName, toName)
+	for c := 0; c < len(changes); {
+		// Изменения, между которыми не больше 2*context общих
+		// строк, попадают в один блок (hunk).
+		last := c
+		for last+1 < len(changes) && changes[last+1]-changes[last] <= 2*context {
+			last++
+		}
+		start := changes[c] - context
+		if start < 0 {
+			start = 0
+		}
+		end := changes[last] + context + 1
+		if end > len(ops) {
+			end = len(ops)
+		}
+		fmt.Fprintf(&buf, "@@ -%s +%s @@\n",
+			hunkRange(aPos[start], aPos[end]-aPos[start]),
+			hunkRange(bPos[start], bPos[end]-bPos[start]))
+		for _, op := range ops[start:end] {
+			buf.WriteByte(op.Kind)
+			buf.WriteString(op.Text)
+			buf.WriteByte('\n')
+		}
+		c = last + 1
+	}
+	return buf.String(), nil
+}
+
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if count == 1 {
+		return strconv.Itoa(start + 1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"net/http"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestDiffLines(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want string // операции diffLines, по строке на операцию
+	}{
+		{"both empty", "", "", ""},
+		{"equal", "a\nb", "a\nb", " a\n b"},
+		{"added to empty", "", "a\nb", "+a\n+b"},
+		{"removed all", "a\nb", "", "-a\n-b"},
+		{"insert in middle", "a\nc", "a\nb\nc", " a\n+b\n c"},
+		{"delete in middle", "a\nb\nc", "a\nc", " a\n-b\n c"},
+		{"replace line", "a\nb\nc", "a\nx\nc", " a\n-b\n+x\n c"},
+		{"crlf", "a\r\nb\r\n", "a\nb\n", " a\n b"},
+		{"moved line", "a\nb\nc\nd", "b\nc\nd\na", "-a\n b\n c\n d\n+a"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ops, err := diffLines(splitLines([]byte(tt.a)), splitLines([]byte(tt.b)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, op := range ops {
+				got = append(got, string(op.Kind)+op.Text)
+			}
+			if s := strings.Join(got, "\n"); s != tt.want {
+				t.Errorf("diffLines(%q, %q) =\n%s\nwant\n%s", tt.a, tt.b, s, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiffLinesTooLarge(t *testing.T) {
+	many := func(n int, prefix string) []string {
+		lines := make([]string, n)
+		for i := range lines {
+			lines[i] = prefix + strings.Repeat("x", i%7)
+		}
+		return lines
+	}
+	tests := []struct {
+		name string
+		a, b []string
+	}{
+		{"too many lines", many(maxDiffLines+1, "a"), many(1, "a")},
+		{"too many edits", many(maxDiffEdits, "a"), many(maxDiffEdits, "b")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := diffLines(tt.a, tt.b); err != errDiffTooLarge {
+				t.Errorf("diffLines error = %v, want errDiffTooLarge", err)
+			}
+		})
+	}
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	a := []byte("1\n2\n3\n4\n5\n6\n7\n8\n9\n")
+	b := []byte("1\n2\n3\n4\nfive\n6\n7\n8\n9\n")
+	got, err := unifiedDiff("P@1", "P@2", a, b, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "--- P@1\n+++ P@2\n@@ -2,7 +2,7 @@\n 2\n 3\n 4\n-5\n+five\n 6\n 7\n 8\n"
+	if got != want {
+		t.Errorf("unifiedDiff =\n%s\nwant\n%s", got, want)
+	}
+	if got, _ := unifiedDiff("P@1", "P@2", a, a, 3); got != "" {
+		t.Errorf("unifiedDiff of equal texts = %q, want empty", got)
+	}
+}
+
+// Сравнение двух больших версий через /diff/{title}?from=&to= не строит
+// таблицу размером n·m: для 20000 строк она заняла бы гигабайты.
+func TestDiffViewLargeVersions(t *testing.T) {
+	lines := make([]string, maxDiffLines)
+	for i := range lines {
+		lines[i] = "line " + strconv.Itoa(i)
+	}
+	edited := append([]string(nil), lines...)
+	for i := 0; i < len(edited); i += len(edited) / 10 {
+		edited[i] = "changed " + strconv.Itoa(i)
+	}
+	rewritten := make([]string, len(lines))
+	for i := range rewritten {
+		rewritten[i] = "other " + strconv.Itoa(i)
+	}
+	tests := []struct {
+		name string
+		to   []string
+		want int
+	}{
+		{"few edits", edited, http.StatusOK},
+		{"rewritten", rewritten, http.StatusUnprocessableEntity},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testDataDir(t)
+			for _, body := range [][]string{lines, tt.to} {
+				if _, err := versions.Save("Big", []byte(strings.Join(body, "\n"))); err != nil {
+					t.Fatal(err)
+				}
+			}
+			var before, after runtime.MemStats
+			runtime.ReadMemStats(&before)
+			w := serve(diffHandler, http.MethodGet, "/diff/Big?from=1&to=2", "")
+			runtime.ReadMemStats(&after)
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d", w.Code, tt.want)
+			}
+			if alloc := after.TotalAlloc - before.TotalAlloc; alloc > 64<<20 {
+				t.Errorf("diff allocated %d MiB, want at most 64 MiB", alloc>>20)
+			}
+		})
+	}
+}
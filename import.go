@@ -0,0 +1,158 @@
+package main
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// maxImportSize - наибольший размер загружаемого архива в байтах.
+const maxImportSize = 32 << 20
+
+// Хорошо сжатый архив в maxImportSize байт распаковывается в гигабайты,
+// а все страницы читаются в память до сохранения. Поэтому ограничены
+// и число записей, и их общий размер после распаковки.
+var (
+	maxImportEntries            = 10000
+	maxImportUncompressed int64 = 256 << 20
+)
+
+var errArchiveTooLarge = errors.New("archive has too many entries or is too large when unpacked")
+
+// archiveBudget считает записи и байты, прочитанные из архива,
+// и отклоняет архив, как только они превышают лимиты импорта.
+type archiveBudget struct {
+	entries int
+	bytes   int64
+}
+
+func (b *archiveBudget) add(data []byte) error {
+	b.entries++
+	b.bytes += int64(len(data))
+	if b.entries > maxImportEntries || b.bytes > maxImportUncompressed {
+		return errArchiveTooLarge
+	}
+	return nil
+}
+
+// importPage - страница из архива, прошедшая проверку.
+type importPage struct {
+	title string
+	body  []byte
+}
+
+// readImportArchive проверяет все записи архива и читает страницы.
+// Запись должна называться <title>.txt без каталогов, с допустимым
+// заголовком и не длиннее maxPageSize; иначе весь архив отклоняется,
+// чтобы импорт не остался сделанным наполовину. Архив сверх лимитов
+// maxImportEntries и maxImportUncompressed - errArchiveTooLarge.
+func readImportArchive(zr *zip.Reader) ([]importPage, error) {
+	if len(zr.File) > maxImportEntries {
+		return nil, errArchiveTooLarge
+	}
+	var pages []importPage
+	var budget archiveBudget
+	for _, f := range zr.File {
+		if strings.HasSuffix(f.Name, "/") {
+			continue
+		}
+		name := f.Name
+		if strings.ContainsAny(name, `/\`) || path.Ext(name) != ".txt" {
+			return nil, fmt.Errorf("%q: only Title.txt files are allowed", name)
+		}
+		title := normalizeTitle(strings.TrimSuffix(name, ".txt"))
+		if err := validateTitle(title); err != nil {
+			return nil, fmt.Errorf("%q: %v", name, err)
+		}
+		if f.UncompressedSize64 > uint64(maxPageSize) {
+			return nil, fmt.Errorf("%q: %v", name, errPageTooLarge)
+		}
+		// Размер в заголовке записи может врать, поэтому чтение
+		// тоже ограничено.
+		body, err := readArchiveEntry(f, maxPageSize)
+		if err != nil {
+			return nil, fmt.Errorf("%q: %v", name, err)
+		}
+		if err := budget.add(body); err != nil {
+			return nil, err
+		}
+		pages = append(pages, importPage{title: title, body: body})
+	}
+	return pages, nil
+}
+
+// importHandler показывает форму загрузки архива (GET) и сохраняет
+// страницы из загруженного zip-архива (POST, поле file) так же, как
+// сохранение из формы редактирования: с версией в истории, slug
+// и записью в журнале аудита.
+func importHandler(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet, http.MethodPost) {
+		return
+	}
+	type importView struct {
+		CSRFToken string
+		Imported  int
+		Error     string
+	}
+	v := importView{CSRFToken: csrfToken(r)}
+	if r.Method == http.MethodGet {
+		renderTemplate(w, "import", v)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportSize)
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			errorHandler(w, r, http.StatusRequestEntityTooLarge, "Archive is larger than the allowed size")
+			return
+		}
+		errorHandler(w, r, http.StatusBadRequest, "No archive uploaded")
+		return
+	}
+	defer file.Close()
+	zr, err := zip.NewReader(file, header.Size)
+	if err != nil {
+		errorHandler(w, r, http.StatusBadRequest, "Not a zip archive")
+		return
+	}
+	pages, err := readImportArchive(zr)
+	if err == errArchiveTooLarge {
+		errorHandler(w, r, http.StatusRequestEntityTooLarge, "The archive has too many pages or is too large when unpacked")
+		return
+	}
+	if err != nil {
+		errorHandler(w, r, http.StatusBadRequest, "Rejected archive entry "+err.Error())
+		return
+	}
+	// Архив не загружается частично: если хоть одну страницу держит
+	// форма редактирования, не сохраняется ни одна.
+	for _, ip := range pages {
+		if l := checkEditLock(ip.title, "", time.Now()); l != nil {
+			errorHandler(w, r, http.StatusConflict, "Cannot import "+ip.title+": "+l.Error())
+			return
+		}
+	}
+	for _, ip := range pages {
+		action := auditEdit
+		if _, err := store.Load(ip.title); errors.Is(err, os.ErrNotExist) {
+			action = auditCreate
+		}
+		if err := store.Save(&Page{Title: ip.title, Body: ip.body, LastEditor: editorName(r)}); err != nil {
+			errorHandler(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if _, err := slugs.Assign(ip.title); err != nil {
+			errorHandler(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+		audit(r, action, ip.title)
+	}
+	v.Imported = len(pages)
+	renderTemplate(w, "import", v)
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// zipArchive собирает zip-архив из записей name -> содержимое.
+func zipArchive(t *testing.T, entries map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, body := range entries {
+		f, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write([]byte(body))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// uploadArchive отправляет archive в importHandler полем file.
+func uploadArchive(t *testing.T, archive []byte) *httptest.ResponseRecorder {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	f, err := mw.CreateFormFile("file", "pages.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write(archive)
+	mw.Close()
+	r := httptest.NewRequest(http.MethodPost, "/import", &body)
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+	w := httptest.NewRecorder()
+	importHandler(w, r)
+	return w
+}
+
+func TestImportHandler(t *testing.T) {
+	tests := []struct {
+		name       string
+		entries    map[string]string
+		maxEntries int   // лимит числа записей, 0 - по умолчанию
+		unpacked   int64 // лимит размера после распаковки, 0 - по умолчанию
+		want       int
+		wantPages  []string
+	}{
+		{
+			name:      "valid archive",
+			entries:   map[string]string{"Foo.txt": "foo", "Bar.txt": "bar"},
+			want:      http.StatusOK,
+			wantPages: []string{"Foo", "Bar"},
+		},
+		{
+			name:    "path traversal",
+			entries: map[string]string{"Foo.txt": "foo", "../evil.txt": "evil"},
+			want:    http.StatusBadRequest,
+		},
+		{
+			name:    "not a page",
+			entries: map[string]string{"Foo.txt": "foo", "script.sh": "rm -rf /"},
+			want:    http.StatusBadRequest,
+		},
+		{
+			name:       "too many entries",
+			entries:    map[string]string{"A.txt": "a", "B.txt": "b", "C.txt": "c"},
+			maxEntries: 2,
+			want:       http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:     "too large when unpacked",
+			entries:  map[string]string{"A.txt": strings.Repeat("a", 600), "B.txt": strings.Repeat("b", 600)},
+			unpacked: 1000,
+			want:     http.StatusRequestEntityTooLarge,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testDataDir(t)
+			oldEntries, oldUnpacked := maxImportEntries, maxImportUncompressed
+			t.Cleanup(func() { maxImportEntries, maxImportUncompressed = oldEntries, oldUnpacked })
+			if tt.maxEntries > 0 {
+				maxImportEntries = tt.maxEntries
+			}
+			if tt.unpacked > 0 {
+				maxImportUncompressed = tt.unpacked
+			}
+			w := uploadArchive(t, zipArchive(t, tt.entries))
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d", w.Code, tt.want)
+			}
+			titles, err := store.List()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(titles) != len(tt.wantPages) {
+				t.Errorf("pages after import = %v, want %v", titles, tt.wantPages)
+			}
+			for _, title := range tt.wantPages {
+				p, err := store.Load(title)
+				if err != nil || string(p.Body) != tt.entries[title+".txt"] {
+					t.Errorf("imported page %s = %v, %v", title, p, err)
+				}
+			}
+		})
+	}
+}
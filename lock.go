@@ -0,0 +1,66 @@
+package main
+
+import "sync"
+
+// lockManager раздает блокировки чтения-записи по ключу - заголовку
+// страницы или производному от него (см. MetaStore.lockKey). Чтение
+// Foo не мешает ни чтению, ни сохранению Bar, а несколько чтений Foo
+// идут одновременно. Запись о ключе живет, пока блокировку кто-то
+// держит или ждет, так что карта не растет с числом страниц.
+type lockManager struct {
+	mu    sync.Mutex
+	locks map[string]*keyLock
+}
+
+type keyLock struct {
+	sync.RWMutex
+	refs int
+}
+
+var pageLocks = &lockManager{locks: make(map[string]*keyLock)}
+
+// acquire возвращает блокировку key, отмечая еще одного пользователя.
+func (m *lockManager) acquire(key string) *keyLock {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	l, ok := m.locks[key]
+	if !ok {
+		l = new(keyLock)
+		m.locks[key] = l
+	}
+	l.refs++
+	return l
+}
+
+// release снимает отметку acquire и убирает блокировку, которой
+// больше никто не пользуется.
+func (m *lockManager) release(key string) *keyLock {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	l := m.locks[key]
+	if l.refs--; l.refs == 0 {
+		delete(m.locks, key)
+	}
+	return l
+}
+
+func (m *lockManager) lock(key string)    { m.acquire(key).Lock() }
+func (m *lockManager) unlock(key string)  { m.release(key).Unlock() }
+func (m *lockManager) rLock(key string)   { m.acquire(key).RLock() }
+func (m *lockManager) rUnlock(key string) { m.release(key).RUnlock() }
+
+// withPageLock выполняет fn, удерживая блокировку страницы title
+// на запись, и возвращает ошибку fn.
+func withPageLock(title string, fn func() error) error {
+	pageLocks.lock(title)
+	defer pageLocks.unlock(title)
+	return fn()
+}
+
+// withPageRLock выполняет fn, удерживая блокировку страницы title
+// на чтение: одновременно с ним могут читать другие, но не писать.
+func withPageRLock(title string, fn func() error) error {
+	pageLocks.rLock(title)
+	defer pageLocks.rUnlock(title)
+	return fn()
+}
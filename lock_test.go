@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// lockFuncs возвращает блокировку key в m на запись (write) или
+// на чтение и функцию, которая ее снимает.
+func lockFuncs(m *lockManager, write bool) (lock, unlock func(string)) {
+	if write {
+		return m.lock, m.unlock
+	}
+	return m.rLock, m.rUnlock
+}
+
+func TestLockManager(t *testing.T) {
+	tests := []struct {
+		name                    string
+		first, second           string
+		firstWrite, secondWrite bool
+		blocks                  bool
+	}{
+		{"read and read of one page", "A", "A", false, false, false},
+		{"read and write of one page", "A", "A", false, true, true},
+		{"write and read of one page", "A", "A", true, false, true},
+		{"write and write of one page", "A", "A", true, true, true},
+		{"read of A and write of B", "A", "B", false, true, false},
+		{"write of A and write of B", "A", "B", true, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &lockManager{locks: make(map[string]*keyLock)}
+			lock, unlock := lockFuncs(m, tt.firstWrite)
+			lock2, unlock2 := lockFuncs(m, tt.secondWrite)
+			lock(tt.first)
+			done := make(chan struct{})
+			go func() {
+				lock2(tt.second)
+				unlock2(tt.second)
+				close(done)
+			}()
+			select {
+			case <-done:
+				if tt.blocks {
+					t.Error("second lock was granted while the first was held")
+				}
+			case <-time.After(50 * time.Millisecond):
+				if !tt.blocks {
+					t.Error("second lock waits for a lock it does not conflict with")
+				}
+			}
+			unlock(tt.first)
+			<-done
+			if n := len(m.locks); n != 0 {
+				t.Errorf("%d locks left in the map after release", n)
+			}
+		})
+	}
+}
+
+// lockWork - работа под блокировкой в бенчмарках. Страницы читаются
+// и пишутся на диск, и пока одна горутина ждет ввода-вывода, другие
+// могли бы работать, поэтому работа здесь - ожидание, а не счет.
+func lockWork() {
+	time.Sleep(20 * time.Microsecond)
+}
+
+// BenchmarkPageLocks - одновременные записи разных страниц под
+// блокировками pageLocks: они не ждут друг друга.
+func BenchmarkPageLocks(b *testing.B) {
+	m := &lockManager{locks: make(map[string]*keyLock)}
+	b.SetParallelism(8)
+	var n int64
+	b.RunParallel(func(pb *testing.PB) {
+		title := "Page" + strconv.FormatInt(atomic.AddInt64(&n, 1), 10)
+		for pb.Next() {
+			m.lock(title)
+			lockWork()
+			m.unlock(title)
+		}
+	})
+}
+
+// BenchmarkGlobalMutex для сравнения выполняет ту же работу под одним
+// мьютексом на все страницы.
+func BenchmarkGlobalMutex(b *testing.B) {
+	var global sync.Mutex
+	b.SetParallelism(8)
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			global.Lock()
+			lockWork()
+			global.Unlock()
+		}
+	})
+}
+
+// Одновременные сохранения одной страницы оставляют в файле одну
+// из записей целиком, а чтения в это время видят только целые тексты.
+func TestConcurrentSavesOfOnePage(t *testing.T) {
+	testDataDir(t)
+	const n = 20
+	first := strings.Repeat("0", 64<<10)
+	bodies := map[string]bool{first: true}
+	for i := 0; i < n; i++ {
+		bodies[strings.Repeat(string(rune('a'+i)), 64<<10)] = true
+	}
+	savePage(t, "Foo", first)
+	errs := make(chan error, 2*n)
+	var wg sync.WaitGroup
+	for body := range bodies {
+		if body == first {
+			continue
+		}
+		wg.Add(2)
+		go func(body string) {
+			defer wg.Done()
+			errs <- store.Save(&Page{Title: "Foo", Body: []byte(body)})
+		}(body)
+		go func() {
+			defer wg.Done()
+			p, err := store.Load("Foo")
+			if err == nil && !bodies[string(p.Body)] {
+				err = fmt.Errorf("read a torn page of %d bytes", len(p.Body))
+			}
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+	p, err := store.Load("Foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(p.Body) == first || !bodies[string(p.Body)] {
+		t.Errorf("final page of %d bytes is not one complete write", len(p.Body))
+	}
+}
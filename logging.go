@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// newLogger создает логгер с форматом format ("text" или "json")
+// и минимальным уровнем level ("debug", "info", "warn", "error").
+func newLogger(w io.Writer, format, level string) (*slog.Logger, error) {
+	var lvl slog.Level
+	if level != "" {
+		if err := lvl.UnmarshalText([]byte(level)); err != nil {
+			return nil, fmt.Errorf("unknown log level %q", level)
+		}
+	}
+	opts := &slog.HandlerOptions{Level: lvl}
+	switch strings.ToLower(format) {
+	case "", "text":
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	}
+	return nil, fmt.Errorf("unknown log format %q", format)
+}
+
+// loggerFromContext возвращает логгер, который loggingMiddleware
+// положил в контекст запроса, или логгер по умолчанию.
+func loggerFromContext(ctx context.Context) *slog.Logger {
+	if l, ok := ctx.Value(loggerContextKey).(*slog.Logger); ok {
+		return l
+	}
+	return slog.Default()
+}
+
+// statusRecorder запоминает код ответа, который отправил обработчик,
+// и число записанных байт тела.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (w *statusRecorder) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusRecorder) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += int64(n)
+	return n, err
+}
+
+func (w *statusRecorder) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *statusRecorder) Unwrap() http.ResponseWriter { return w.ResponseWriter }
+
+// Hijack передает соединение обработчику WebSocket; в лог такой
+// запрос попадает с кодом 101.
+func (w *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(w.ResponseWriter).Hijack()
+	if err == nil && w.status == 0 {
+		w.status = http.StatusSwitchingProtocols
+	}
+	return conn, rw, err
+}
+
+// newUUID возвращает случайный UUID версии 4.
+func newUUID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	b[6] = b[6]&0x0f | 0x40 // версия 4
+	b[8] = b[8]&0x3f | 0x80 // вариант RFC 4122
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// validRequestID - допустимый X-Request-ID от клиента. Остальные
+// значения заменяются новыми, чтобы в лог не попал произвольный текст.
+var validRequestID = regexp.MustCompile("^[a-zA-Z0-9-]{1,64}$")
+
+// requestIDFromContext возвращает идентификатор запроса, который
+// requestIDMiddleware положил в контекст, или пустую строку.
+func requestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDContextKey).(string)
+	return id
+}
+
+// requestIDMiddleware берет идентификатор запроса из заголовка
+// X-Request-ID, если он допустим, или создает новый UUID. Идентификатор
+// кладется в контекст запроса и возвращается клиенту в том же
+// заголовке, чтобы запрос можно было проследить через все сервисы.
+func requestIDMiddleware() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := r.Header.Get("X-Request-ID")
+			if !validRequestID.MatchString(id) {
+				id = newUUID()
+			}
+			w.Header().Set("X-Request-ID", id)
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDContextKey, id)))
+		})
+	}
+}
+
+// loggingMiddleware пишет в logger по строке на каждый запрос: метод,
+// путь, код ответа, время обработки, IP клиента и идентификатор запроса.
+// Ответы 4xx пишутся с уровнем Warn, 5xx - с уровнем Error. Логгер
+// с полем request_id передается обработчикам через контекст запроса.
+// Идентификатор берется из контекста (см. requestIDMiddleware).
+// Если accessLog не nil, в него же пишется строка в Common Log Format
+// для внешних анализаторов логов.
+func loggingMiddleware(logger *slog.Logger, accessLog *log.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			id := requestIDFromContext(r.Context())
+			if id == "" {
+				id = newUUID()
+			}
+			ip := clientIP(r)
+			reqLogger := logger.With("request_id", id)
+			rec := &statusRecorder{ResponseWriter: w}
+			next.ServeHTTP(rec, r.WithContext(context.WithValue(r.Context(), loggerContextKey, reqLogger)))
+
+			if rec.status == 0 {
+				rec.status = http.StatusOK
+			}
+			level := slog.LevelInfo
+			switch {
+			case rec.status >= 500:
+				level = slog.LevelError
+			case rec.status >= 400:
+				level = slog.LevelWarn
+			}
+			reqLogger.Log(r.Context(), level, "request",
+				"method", r.Method,
+				"path", r.URL.Path,
+				"status", rec.status,
+				"latency", time.Since(start),
+				"remote_ip", ip,
+				"bytes", rec.bytes,
+			)
+			if accessLog != nil {
+				accessLog.Print(clfLine(r, ip, start, rec.status, rec.bytes))
+			}
+		})
+	}
+}
+
+// clfLine возвращает строку журнала доступа в Common Log Format:
+// host ident authuser [time] "request" status bytes.
+func clfLine(r *http.Request, host string, t time.Time, status int, bytes int64) string {
+	user := "-"
+	if u, _, ok := r.BasicAuth(); ok && u != "" {
+		user = u
+	}
+	size := "-"
+	if bytes > 0 {
+		size = strconv.FormatInt(bytes, 10)
+	}
+	return fmt.Sprintf("%s - %s [%s] \"%s %s %s\" %d %s",
+		host, user, t.Format("02/Jan/2006:15:04:05 -0700"),
+		r.Method, r.URL.RequestURI(), r.Proto, status, size)
+}
+
+// openAccessLog открывает журнал доступа: "-" - стандартный вывод,
+// иначе файл path, который дописывается. Пустой path - журнала нет.
+func openAccessLog(path string) (*log.Logger, error) {
+	switch path {
+	case "":
+		return nil, nil
+	case "-":
+		return log.New(os.Stdout, "", 0), nil
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0640)
+	if err != nil {
+		return nil, err
+	}
+	return log.New(f, "", 0), nil
+}
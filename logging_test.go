@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// logLines разбирает вывод JSON-логгера по строкам.
+func logLines(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	t.Helper()
+	var lines []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var m map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &m); err != nil {
+			t.Fatalf("log line is not valid JSON: %v\n%s", err, line)
+		}
+		lines = append(lines, m)
+	}
+	return lines
+}
+
+func TestLoggingMiddlewareJSON(t *testing.T) {
+	tests := []struct {
+		status    int
+		wantLevel string
+	}{
+		{http.StatusOK, "INFO"},
+		{http.StatusFound, "INFO"},
+		{http.StatusNotFound, "WARN"},
+		{http.StatusForbidden, "WARN"},
+		{http.StatusInternalServerError, "ERROR"},
+		{http.StatusServiceUnavailable, "ERROR"},
+	}
+	for _, tt := range tests {
+		t.Run(http.StatusText(tt.status), func(t *testing.T) {
+			var buf bytes.Buffer
+			logger, err := newLogger(&buf, "json", "debug")
+			if err != nil {
+				t.Fatal(err)
+			}
+			h := loggingMiddleware(logger, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				loggerFromContext(r.Context()).Debug("inside handler")
+				w.WriteHeader(tt.status)
+				w.Write([]byte("body"))
+			}))
+			r := httptest.NewRequest(http.MethodPost, "/save/Foo", nil)
+			r.RemoteAddr = "192.0.2.1:1234"
+			r = r.WithContext(context.WithValue(r.Context(), requestIDContextKey, "req-1"))
+			h.ServeHTTP(httptest.NewRecorder(), r)
+
+			lines := logLines(t, &buf)
+			if len(lines) != 2 {
+				t.Fatalf("%d log lines, want 2:\n%s", len(lines), buf.String())
+			}
+			if lines[0]["msg"] != "inside handler" || lines[0]["request_id"] != "req-1" {
+				t.Errorf("handler log line = %v, want request_id req-1 from the context logger", lines[0])
+			}
+			want := map[string]interface{}{
+				"level":      tt.wantLevel,
+				"msg":        "request",
+				"method":     "POST",
+				"path":       "/save/Foo",
+				"status":     float64(tt.status),
+				"remote_ip":  "192.0.2.1",
+				"request_id": "req-1",
+				"bytes":      float64(4),
+			}
+			for k, v := range want {
+				if lines[1][k] != v {
+					t.Errorf("%s = %v, want %v", k, lines[1][k], v)
+				}
+			}
+			for _, k := range []string{"time", "latency"} {
+				if _, ok := lines[1][k]; !ok {
+					t.Errorf("request log line has no %s: %v", k, lines[1])
+				}
+			}
+		})
+	}
+}
+
+// clfPattern разбирает строку Common Log Format.
+var clfPattern = regexp.MustCompile(`^(\S+) - (\S+) \[([^\]]+)\] "(\S+) (\S+) (\S+)" (\d{3}) (\d+|-)$`)
+
+func TestCLFLine(t *testing.T) {
+	at := time.Date(2024, time.March, 5, 14, 7, 9, 0, time.FixedZone("", 3*3600))
+	tests := []struct {
+		name   string
+		user   string
+		status int
+		bytes  int64
+		want   string
+	}{
+		{"anonymous", "", 200, 1234, `192.0.2.1 - - [05/Mar/2024:14:07:09 +0300] "GET /view/Foo?x=1 HTTP/1.1" 200 1234`},
+		{"basic auth user", "alice", 404, 10, `192.0.2.1 - alice [05/Mar/2024:14:07:09 +0300] "GET /view/Foo?x=1 HTTP/1.1" 404 10`},
+		{"empty body", "", 304, 0, `192.0.2.1 - - [05/Mar/2024:14:07:09 +0300] "GET /view/Foo?x=1 HTTP/1.1" 304 -`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/view/Foo?x=1", nil)
+			if tt.user != "" {
+				r.SetBasicAuth(tt.user, "secret")
+			}
+			if got := clfLine(r, "192.0.2.1", at, tt.status, tt.bytes); got != tt.want {
+				t.Errorf("clfLine =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAccessLog(t *testing.T) {
+	var buf bytes.Buffer
+	logger, _ := newLogger(io.Discard, "text", "")
+	h := loggingMiddleware(logger, log.New(&buf, "", 0))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello, "))
+		w.Write([]byte("world"))
+	}))
+	r := httptest.NewRequest(http.MethodGet, "/view/Foo", nil)
+	r.RemoteAddr = "192.0.2.1:1234"
+	h.ServeHTTP(httptest.NewRecorder(), r)
+
+	m := clfPattern.FindStringSubmatch(strings.TrimSpace(buf.String()))
+	if m == nil {
+		t.Fatalf("access log line is not in Common Log Format: %q", buf.String())
+	}
+	if _, err := time.Parse("02/Jan/2006:15:04:05 -0700", m[3]); err != nil {
+		t.Errorf("timestamp %q: %v", m[3], err)
+	}
+	got := []string{m[1], m[2], m[4], m[5], m[6], m[7], m[8]}
+	want := []string{"192.0.2.1", "-", "GET", "/view/Foo", "HTTP/1.1", "200", "12"}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("access log fields = %v, want %v", got, want)
+	}
+}
+
+func TestNewLogger(t *testing.T) {
+	tests := []struct {
+		format, level string
+		wantJSON      bool
+		wantErr       bool
+	}{
+		{"", "", false, false},
+		{"text", "info", false, false},
+		{"json", "", true, false},
+		{"JSON", "warn", true, false},
+		{"xml", "", false, true},
+		{"json", "loud", false, true},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		logger, err := newLogger(&buf, tt.format, tt.level)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("newLogger(%q, %q) error = %v, want error %v", tt.format, tt.level, err, tt.wantErr)
+		}
+		if err != nil {
+			continue
+		}
+		logger.Error("boom", "path", "/view/Foo")
+		if got := json.Valid(buf.Bytes()); got != tt.wantJSON {
+			t.Errorf("newLogger(%q, %q) wrote %q, want JSON %v", tt.format, tt.level, buf.String(), tt.wantJSON)
+		}
+	}
+
+	// Уровень отсекает более тихие сообщения.
+	var buf bytes.Buffer
+	logger, _ := newLogger(&buf, "text", "warn")
+	logger.Info("hidden")
+	logger.Warn("shown")
+	if strings.Contains(buf.String(), "hidden") || !strings.Contains(buf.String(), "shown") {
+		t.Errorf("warn level logger wrote:\n%s", buf.String())
+	}
+}
+
+// uuidV4 - формат идентификатора, который создает newUUID.
+var uuidV4 = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+func TestRequestIDMiddleware(t *testing.T) {
+	tests := []struct {
+		name     string
+		incoming string
+		wantEcho bool
+	}{
+		{"echoed", "abc-123-DEF", true},
+		{"max length", strings.Repeat("a", 64), true},
+		{"missing", "", false},
+		{"oversized", strings.Repeat("a", 65), false},
+		{"malformed", "abc def\r\nX-Evil: 1", false},
+		{"unicode", "идентификатор", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ctxID string
+			h := requestIDMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				ctxID = requestIDFromContext(r.Context())
+			}))
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.incoming != "" {
+				r.Header.Set("X-Request-ID", tt.incoming)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			got := w.Header().Get("X-Request-ID")
+			if got != ctxID {
+				t.Errorf("header X-Request-ID = %q, context = %q; want them equal", got, ctxID)
+			}
+			if tt.wantEcho {
+				if got != tt.incoming {
+					t.Errorf("X-Request-ID = %q, want the incoming %q", got, tt.incoming)
+				}
+			} else if !uuidV4.MatchString(got) {
+				t.Errorf("X-Request-ID = %q, want a new UUID v4", got)
+			}
+		})
+	}
+}
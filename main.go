@@ -2,7 +2,6 @@
 // https://golang-blog.blogspot.com/2019/02/go-web-app-net-http-package.html
 package main
 import (
-	"fmt"
 	"log"
 	"net/http"
 	"io/ioutil"
@@ -14,11 +13,82 @@ import (
 	"html/template"
 	"regexp"
 	"errors"
+	"os"
+	"path/filepath"
+	"path"
+	"io/fs"
+	"time"
+	"crypto/rand"
+	"crypto/sha256"
+	"unicode"
+	"unicode/utf8"
+	"fmt"
+	"strconv"
+	"flag"
+	"strings"
+	"sort"
+	"log/slog"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"golang.org/x/text/unicode/norm"
 )
 
+// Page кодируется в JSON как {"title":...,"body":...},
+// см. MarshalJSON в api.go.
+// Modified - время последнего изменения страницы; для страницы,
+// которой еще нет в хранилище, оно нулевое.
 type Page struct {
-	Title string
-	Body []byte
+	Title    string    `json:"title"`
+	Body     []byte    `json:"body"`
+	Modified time.Time `json:"-"`
+	Tags     []string  `json:"tags"`
+	Slug     string    `json:"slug"`
+	// CreatedAt и UpdatedAt берутся из метаданных страницы
+	// (см. timestampStorage).
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	// LastEditor - имя пользователя, который сохраняет страницу
+	// (см. editorName); после Load - последний редактор из метаданных.
+	// OriginalAuthor только читается из метаданных.
+	LastEditor     string `json:"last_editor"`
+	OriginalAuthor string `json:"original_author"`
+	// Meta - метаданные из блока "---" в начале Body
+	// (см. parseFrontmatter), например author или title.
+	Meta map[string]string `json:"meta"`
+	// Create просит Save только создать страницу: если она уже есть,
+	// Save возвращает errPageExists. Хранилище проверяет это под той же
+	// блокировкой, что и запись, так что одновременно созданная
+	// страница не затирается.
+	Create bool `json:"-"`
+}
+
+// pageView - данные шаблонов view.html и edit.html: страница,
+// CSRF-токен для ее форм, CSP nonce для встроенных скриптов,
+// комментарии (только для view.html) и ошибка формы (только
+// для edit.html).
+type pageView struct {
+	*Page
+	CSRFToken string
+	CSPNonce  string
+	Comments  []Comment
+	Private   bool
+	Views     uint64
+	// HTML - текст страницы со ссылками [[Title]] для view.html.
+	HTML template.HTML
+	// ReadOnly скрывает ссылки на редактирование (флаг -readonly).
+	ReadOnly bool
+	// LockToken - токен блокировки страницы для формы edit.html
+	// (см. acquireEditLock).
+	LockToken string
+	// Error показывается над формой edit.html. AllowEmpty добавляет
+	// к форме ?allowempty=1, чтобы повторное сохранение пустого
+	// текста прошло.
+	Error      string
+	AllowEmpty bool
+}
+
+func newPageView(r *http.Request, p *Page) pageView {
+	return pageView{Page: p, CSRFToken: csrfToken(r), CSPNonce: cspNonce(r), ReadOnly: readOnly}
 }
 
 // Функция template.Must - это удобная оболочка, 
@@ -26,33 +96,455 @@ type Page struct {
 // а в противном случае возвращает *Template без изменений. 
 // Здесь уместна паника; если шаблоны не могут быть загружены, 
 // единственное разумное, что нужно сделать, это выйти из программы.
-var templates = template.Must(template.ParseFiles("edit.html", "view.html"))
+// Шаблоны лежат в каталоге html/ (встроенном в бинарный файл, см.
+// assets) и разбираются один раз при старте.
+// Обработчики передают в renderTemplate имя из templateNames без
+// расширения ".html".
+var templateNames = []string{"index", "edit", "view", "history", "version", "diff", "login", "tags", "tag", "import", "popular", "recent", "profile", "author", "trash", "404", "500"}
+
+var templates = &TemplateManager{t: template.Must(template.ParseFS(assets, templateFiles(templateNames)...))}
+
+// theme - тема оформления (флаг -theme): подкаталог html/, шаблоны
+// из которого заменяют одноименные шаблоны html/. Шаблоны, которых
+// в теме нет, берутся из html/. Пустая строка - тема по умолчанию.
+var theme string
+
+func templateFiles(names []string) []string {
+	files := make([]string, len(names))
+	for i, name := range names {
+		files[i] = path.Join("html", name+".html")
+		if theme == "" {
+			continue
+		}
+		if f := path.Join("html", theme, name+".html"); assetExists(f) {
+			files[i] = f
+		}
+	}
+	return files
+}
+
+// availableThemes возвращает имена тем - подкаталогов html/.
+func availableThemes() ([]string, error) {
+	entries, err := fs.ReadDir(assets, "html")
+	if err != nil {
+		return nil, err
+	}
+	var themes []string
+	for _, e := range entries {
+		if e.IsDir() {
+			themes = append(themes, e.Name())
+		}
+	}
+	return themes, nil
+}
+
+// useTheme выбирает тему name и заново разбирает шаблоны с ее
+// учетом. Неизвестная тема - ошибка.
+func useTheme(name string) error {
+	if name != "" {
+		themes, err := availableThemes()
+		if err != nil {
+			return err
+		}
+		found := false
+		for _, t := range themes {
+			if t == name {
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Errorf("unknown theme %q (available: %s)", name, strings.Join(themes, ", "))
+		}
+	}
+	theme = name
+	return templates.Reload()
+}
 
 // Функция regexp.MustCompile проанализирует и скомпилирует регулярное 
 // выражение и вернет regexp.Regexp. MustCompile отличается от Compile тем, 
 // что он вызывает panic, если компиляция выражения не удается, а Compile 
 // возвращает error в качестве второго параметра.
-var validPath = regexp.MustCompile("^/(edit|save|view)/([a-zA-Z0-9]+)$")
+var validPath = regexp.MustCompile("^/(edit|save|delete|rename|view|raw)/([^/]*)$")
+
+// slugViewPath - адрес страницы по ее slug (см. slugify): строчные
+// буквы, цифры и одиночные дефисы между ними.
+var slugViewPath = regexp.MustCompile(`^/(view)/([\p{Ll}\p{Lo}\p{Nd}]+(?:-[\p{Ll}\p{Lo}\p{Nd}]+)*)$`)
+
+// contextKey - тип ключей, под которыми middleware кладут значения
+// в контекст запроса. Собственный тип не дает пересечься с ключами
+// других пакетов.
+type contextKey int
+
+const (
+	userContextKey contextKey = iota
+	loggerContextKey
+	csrfContextKey
+	cspNonceContextKey
+	requestIDContextKey
+	graphqlRequestContextKey
+)
+
+// titleChars - заголовок страницы в шаблонах путей URL: буквы и цифры
+// любых алфавитов (unicode.IsLetter и unicode.IsDigit).
+const titleChars = `[\p{L}\p{Nd}]+`
+
+// validTitle проверяет заголовок страницы сам по себе, без пути URL.
+var validTitle = regexp.MustCompile(`^` + titleChars + `$`)
+
+// normalizeTitle приводит заголовок к форме NFC, чтобы одинаковые
+// на вид заголовки, набранные составными и готовыми символами,
+// указывали на одну страницу.
+func normalizeTitle(title string) string {
+	return norm.NFC.String(title)
+}
+
+// normalizePathMiddleware приводит путь запроса к NFC, так что все
+// обработчики получают заголовки страниц уже нормализованными.
+func normalizePathMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !norm.NFC.IsNormalString(r.URL.Path) {
+			r.URL.Path = norm.NFC.String(r.URL.Path)
+			r.URL.RawPath = ""
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// maxTitleLen - наибольшая длина заголовка в символах.
+const maxTitleLen = 200
+
+// titleForbidden - символы, недопустимые в именах файлов
+// хотя бы одной из поддерживаемых ОС.
+const titleForbidden = "/\\:*?\"<>|.\x00"
+
+// validateTitle проверяет заголовок страницы и объясняет, что с ним
+// не так. Ее вызывают все обработчики, принимающие заголовок,
+// и реализации Storage.Save.
+func validateTitle(title string) error {
+	if title == "" {
+		return errors.New("title is empty")
+	}
+	if utf8.RuneCountInString(title) > maxTitleLen {
+		return fmt.Errorf("title is longer than %d characters", maxTitleLen)
+	}
+	if i := strings.IndexAny(title, titleForbidden); i >= 0 {
+		return fmt.Errorf("title contains forbidden character %q", title[i])
+	}
+	if i := strings.IndexFunc(title, unicode.IsControl); i >= 0 {
+		return errors.New("title contains a control character")
+	}
+	if !validTitle.MatchString(title) {
+		return errors.New("title may contain only letters and digits")
+	}
+	return nil
+}
 
 func main()  {
+	// Настройки берутся из переменных окружения, файла -config
+	// и флагов, причем флаги важнее файла (см. config.go).
+	cfg, err := parseConfig(flag.CommandLine, os.Args[1:])
+	if err != nil {
+		log.Fatal(err)
+	}
+	trustForwardedFor = cfg.TrustProxy
+	maxPageSize = cfg.MaxSize
+	readOnly = cfg.ReadOnly
+	if err := validateOpenAPI(); err != nil {
+		log.Fatalf("ошибка в apidocs/openapi.json: %v", err)
+	}
+
+	mode, err := strconv.ParseUint(cfg.Perm, 8, 32)
+	if err != nil || mode > 0777 {
+		log.Fatalf("некорректное значение -perm: %q", cfg.Perm)
+	}
+	pageFileMode = os.FileMode(mode)
+
+	// Формат логов задает флаг -logformat или WEB_LOG_FORMAT (text
+	// или json), минимальный уровень - WEB_LOG_LEVEL. Логгер становится
+	// логгером по умолчанию, так что через него идут и вызовы пакета log.
+	logger, err := newLogger(os.Stderr, cfg.LogFormat, os.Getenv("WEB_LOG_LEVEL"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	slog.SetDefault(logger)
+	accessLog, err := openAccessLog(cfg.AccessLog)
+	if err != nil {
+		log.Fatal(err)
+	}
+	// В режиме разработки шаблоны и статические файлы читаются
+	// с диска, а не из встроенных в бинарный файл.
+	if cfg.Dev {
+		useDiskAssets(".")
+	}
+	// Тема -theme заменяет шаблоны html/ своими из html/<тема>/.
+	if err := useTheme(cfg.Theme); err != nil {
+		log.Fatal(err)
+	}
+	if cfg.Theme != "" {
+		slog.Info("Тема оформления", "theme", cfg.Theme)
+	}
+	if readOnly {
+		slog.Info("Режим только для чтения: страницы редактирования отключены")
+	}
+	// В режиме разработки (-dev или WEB_ENV=development) шаблоны
+	// перечитываются при изменении файлов html/, и правки HTML видны
+	// без перезапуска сервера.
+	if cfg.Dev {
+		if _, err := templates.Watch("html"); err != nil {
+			log.Fatal(err)
+		}
+		slog.Info("Режим разработки: шаблоны перечитываются при изменении файлов html/")
+	} else {
+		slog.Info("Шаблоны разобраны при старте и кэшированы")
+	}
+
+	// Флаг -backend (или WEB_STORAGE_BACKEND) выбирает, где хранятся
+	// страницы: "file" (файлы .txt, по умолчанию) или "sqlite"
+	// (база WEB_SQLITE_PATH). Все данные сервера лежат в каталоге
+	// -data (WEB_DATA_DIR).
+	backend, err := openStorage(cfg.Backend, cfg.DataDir, os.Getenv("WEB_SQLITE_PATH"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	useDataDir(cfg.DataDir)
+	// С -backupdir (WEB_BACKUP_DIR) каждая сохраненная страница
+	// дублируется еще и в этот каталог.
+	if cfg.BackupDir != "" {
+		if backend, err = NewBackupStorage(backend, cfg.BackupDir); err != nil {
+			log.Fatal(err)
+		}
+		slog.Info("Резервные копии страниц", "dir", cfg.BackupDir)
+	}
+	// Поверх хранилища - LRU-кэш на -cachesize (WEB_CACHE_SIZE) страниц,
+	// а поверх него - счетчики для /metrics, которые видят и попадания в кэш.
+	cache := NewCachedStorage(eventStorage{timestampStorage{backend}}, cfg.CacheSize)
+	store = MetricStorage{cache}
+	http.HandleFunc("/api/v1/cache/stats", cacheStatsHandler(cache))
+
 	// Функция main начинается с вызова http.HandleFunc, 
 	// который сообщает пакету http обрабатывать все корневые 
 	// веб запросы ("/") с помощью handler:
 	// Используется функция http.NewServeMux() для инициализации нового рутера, затем
     // функцию "handler" регистрируется как обработчик для URL-шаблона "/".
 	// mux := http.NewServeMux()
-	http.HandleFunc("/", handler)
-	http.HandleFunc("/view/", makeHandler(viewHandler))
-	http.HandleFunc("/edit/", makeHandler(editHandler))
-	http.HandleFunc("/save/", makeHandler(saveHandler))
-	log.Println("Запуск сервера на http://127.0.0.1:8080")
-	// Затем он вызывает http.ListenAndServe, указывая, что он 
-	// должен прослушивать порт 8080 на любом интерфейсе (":8080").
+	// Просмотр открыт всем, а редактирование, сохранение и удаление
+	// доступны только после входа через форму /login или, если заданы
+	// флаги -user и -pass, по HTTP Basic Auth. Cookie сессии
+	// подписываются ключом из WEB_SESSION_KEY.
+	sessions := &Sessions{Key: []byte(os.Getenv("WEB_SESSION_KEY")), TTL: 24 * time.Hour}
+	if len(sessions.Key) == 0 {
+		sessions.Key = make([]byte, 32)
+		if _, err := rand.Read(sessions.Key); err != nil {
+			log.Fatal(err)
+		}
+		slog.Warn("WEB_SESSION_KEY не задан: сессии не переживут перезапуск сервера")
+	}
+	users := &UserStore{Path: filepath.Join(cfg.DataDir, "users.json")}
+	// Ссылки /share подписываются своим ключом: WEB_SHARE_KEY или
+	// ключом из файла share.key в каталоге -data, созданного при первом
+	// запуске, - так они переживают перезапуск сервера.
+	if shares.Key = []byte(os.Getenv("WEB_SHARE_KEY")); len(shares.Key) == 0 {
+		if shares.Key, err = loadShareKey(filepath.Join(cfg.DataDir, "share.key")); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if v := os.Getenv("WEB_ADMIN_USERS"); v != "" {
+		adminUsers = splitList(v)
+	}
+	auth, err := newAuthenticator(cfg, sessions, users)
+	if err != nil {
+		log.Fatal(err)
+	}
+	protect := authMiddleware(auth)
+	// edit пропускает только редакторов: читатели, которые
+	// зарегистрировались сами, страниц не меняют.
+	edit := func(h http.Handler) http.Handler { return protect(requireEditor(h)) }
+	// identify никого не останавливает, но узнает вошедшего
+	// пользователя: ему видны закрытые страницы.
+	identify := identifyMiddleware(auth)
+	// Формы, которые меняют данные, и страницы с такими формами
+	// защищены CSRF-токеном. Форма входа тоже: иначе чужой сайт мог бы
+	// незаметно войти в браузере посетителя под своей учетной записью.
+	csrf := csrfMiddleware(sessions.Key)
+	http.Handle("/", identify(http.HandlerFunc(handler)))
+	http.Handle("/login", csrf(auth.LoginHandler()))
+	// Регистрация открывается только флагом -register. Для нее нужны
+	// вход по users.json, почта для писем с подтверждением и -baseurl
+	// для ссылки в письме; без них сервер не запускается.
+	if cfg.Register {
+		mailer := smtpMailerFromEnv()
+		if _, ok := auth.(*JSONFileAuthenticator); !ok {
+			log.Fatal("-register работает только с -auth json")
+		}
+		if mailer == nil {
+			log.Fatal("-register: не задан WEB_SMTP_HOST для писем с подтверждением")
+		}
+		if cfg.BaseURL == "" {
+			log.Fatal("-register: не задан -baseurl для ссылок в письмах")
+		}
+		http.Handle("/register", registerHandler(users, mailer, cfg.BaseURL))
+		http.Handle("/verify", csrf(verifyHandler(users)))
+		go purgeUnverifiedEvery(users, time.Hour)
+	}
+	http.Handle("/logout", csrf(auth.LogoutHandler()))
+	http.Handle("/profile", protect(csrf(http.HandlerFunc(profileHandler))))
+	http.Handle("/view/", identify(csrf(makeHandler(pageResourceHandler))))
+	http.Handle("/raw/", identify(makeHandler(rawHandler)))
+	// В режиме -readonly страниц редактирования нет совсем.
+	if !readOnly {
+		http.Handle("/edit/", edit(csrf(makeHandler(editHandler))))
+		http.Handle("/save/", edit(csrf(makeHandler(saveHandler))))
+		http.Handle("/delete/", edit(csrf(makeHandler(deleteHandler))))
+		http.Handle("/rename/", edit(csrf(makeHandler(renameHandler))))
+		http.Handle("/preview", timeoutMiddleware(routeTimeout)(edit(csrf(http.HandlerFunc(previewHandler)))))
+		// Живой предпросмотр и присутствие других редакторов по WebSocket.
+		handleUntimed("/ws/preview/", edit(http.HandlerFunc(wsPreviewHandler)))
+	}
+	// Сторонним сайтам доступ к API открывается только для origin
+	// из WEB_CORS_ORIGINS (через запятую).
+	cors := corsMiddleware(splitList(os.Getenv("WEB_CORS_ORIGINS")))
+	// В режиме -readonly API страниц только читает.
+	http.Handle("/api/pages/", cors(readOnlyMiddleware(apiPageHandler(protect, identify))))
+	http.Handle("/api/v1/pages/", cors(readOnlyMiddleware(apiPageHandler(protect, identify))))
+	if !readOnly {
+		http.Handle("/api/v1/locks/", cors(protect(requireAdmin(http.HandlerFunc(apiLockHandler)))))
+		go cleanEditLocks(time.Minute)
+	}
+	// Корзина есть только у файлового хранилища: SQLite удаляет
+	// страницы сразу, и восстанавливать было бы нечего.
+	if cfg.softDelete() {
+		if !readOnly {
+			http.Handle("/trash", edit(csrf(http.HandlerFunc(trashHandler))))
+			http.Handle("/restore/", edit(csrf(http.HandlerFunc(restoreHandler))))
+		}
+		if trashMaxAge = time.Duration(cfg.TrashMaxAge); trashMaxAge > 0 {
+			go purgeTrash(trashMaxAge, time.Hour)
+		}
+		http.Handle("/api/v1/trash", cors(edit(http.HandlerFunc(apiTrashHandler))))
+		if !readOnly {
+			http.Handle("/api/v1/trash/", cors(edit(http.HandlerFunc(apiRestoreHandler))))
+		}
+	}
+	// Описание API в OpenAPI 3.0 и Swagger UI для него.
+	http.Handle("/api/v1/openapi.json", cors(http.HandlerFunc(openapiHandler)))
+	http.Handle("/api/docs/", apiDocsHandler())
+	http.Handle("/api/docs", http.RedirectHandler("/api/docs/", http.StatusMovedPermanently))
+	// GraphQL: чтение - как у /view/, изменения - только после входа
+	// и не в режиме -readonly.
+	http.Handle("/graphql", timeoutMiddleware(routeTimeout)(identify(graphqlHandler())))
+	if cfg.Dev {
+		http.HandleFunc("/graphiql", graphiqlHandler)
+	}
+	// WEB_HISTORY_KEEP ограничивает число хранимых версий каждой
+	// страницы; 0 или пустое значение - хранить все.
+	versions.Keep = envInt("WEB_HISTORY_KEEP", 0)
+	// /metrics раскрывает внутреннее состояние сервера, поэтому по
+	// умолчанию доступен только с localhost; список адресов и подсетей
+	// задает WEB_METRICS_ALLOW.
+	metricsAllow := splitList(envString("WEB_METRICS_ALLOW", "127.0.0.1,::1"))
+	http.Handle("/metrics", ipAllowlistMiddleware(metricsAllow)(promhttp.Handler()))
+	// /healthz только подтверждает, что процесс жив, а /readyz
+	// проверяет хранилище и шаблоны.
+	http.HandleFunc("/healthz", healthHandler)
+	http.HandleFunc("/readyz", readyHandler)
+	// Статические файлы берутся из assets; -static (WEB_STATIC_DIR)
+	// отдает их из другого каталога на диске.
+	staticFiles, err := fs.Sub(assets, "static")
+	if err != nil {
+		log.Fatal(err)
+	}
+	static := http.FS(staticFiles)
+	if cfg.StaticDir != "" {
+		static = http.Dir(cfg.StaticDir)
+	}
+	http.Handle("/static/", staticHandler(static))
+	http.Handle("/history/", identify(http.HandlerFunc(historyHandler)))
+	http.Handle("/diff/", timeoutMiddleware(routeTimeout)(identify(http.HandlerFunc(diffHandler))))
+	http.Handle("/tags", identify(http.HandlerFunc(tagsHandler)))
+	http.Handle("/tags/", identify(http.HandlerFunc(tagsHandler)))
+	http.Handle("/tag/", identify(http.HandlerFunc(tagsHandler)))
+	http.Handle("/popular", identify(http.HandlerFunc(popularHandler)))
+	http.Handle("/recent", identify(http.HandlerFunc(recentHandler)))
+	http.Handle("/users/", identify(http.HandlerFunc(authorPagesHandler)))
+	// В журнале аудита - действия и IP-адреса всех пользователей,
+	// поэтому он открыт только администраторам.
+	http.Handle("/admin/audit", protect(requireAdmin(http.HandlerFunc(auditHandler))))
+	// Архив всех страниц, включая закрытые, - только редакторам.
+	handleUntimed("/export", edit(http.HandlerFunc(exportHandler)))
+	// Полный архив с метаданными выгружают и загружают только
+	// администраторы (WEB_ADMIN_USERS).
+	handleUntimed("/admin/export", protect(requireAdmin(http.HandlerFunc(adminExportHandler))))
+	if !readOnly {
+		http.Handle("/import", edit(csrf(http.HandlerFunc(importHandler))))
+		http.Handle("/admin/import", protect(requireAdmin(csrf(http.HandlerFunc(adminImportHandler)))))
+	}
+	http.HandleFunc("/feed.rss", feedHandler)
+	if cfg.BaseURL != "" && !validBaseURL(cfg.BaseURL) {
+		log.Fatalf("некорректное значение -baseurl: %q", cfg.BaseURL)
+	}
+	siteBaseURL = cfg.BaseURL
+	http.HandleFunc("/sitemap.xml", sitemapHandler)
+	http.HandleFunc("/robots.txt", robotsHandler)
+	http.HandleFunc("/feed.atom", feedHandler)
+	// Поток событий о сохранении и удалении страниц (SSE).
+	handleUntimed("/events", identify(http.HandlerFunc(eventsHandler)))
+	// Ограничение частоты запросов (флаги -ratelimit и -burst)
+	// оборачивает весь mux, чтобы запросы сверх лимита не доходили
+	// ни до одного обработчика. Ответы сжимаются gzip уже внутри него.
+	// Логирование - внешний слой (над ним только выдача X-Request-ID),
+	// чтобы в лог попадали и отклоненные ограничителем запросы.
+	// Сразу под ним - перехват паник, чтобы и упавшие запросы
+	// логировались с кодом 500, а под ним - общий срок обработки
+	// запроса (флаг -timeout). Самый внешний слой - HTTP/2 push, ему
+	// нужен ResponseWriter самого сервера. Слои перечислены снаружи
+	// внутрь.
+	root := new(MiddlewareChain).
+		Use(pushMiddleware(pushAssets)).
+		Use(requestIDMiddleware()).
+		Use(loggingMiddleware(logger, accessLog)).
+		Use(recoveryMiddleware(logger)).
+		Use(timeoutMiddleware(time.Duration(cfg.Timeout))).
+		Use(metricsMiddleware).
+		Use(securityHeadersMiddleware()).
+		Use(rateLimitMiddleware(cfg.RateLimit, cfg.Burst)).
+		Use(compressionMiddleware(defaultCompressMinSize)).
+		Use(normalizePathMiddleware).
+		Then(http.DefaultServeMux)
+	// Затем он вызывает listenAndServe, которая в зависимости от
+	// настроек TLS слушает адрес -addr по HTTP или порт 443 по HTTPS (см. tls.go).
 	// Эта функция будет блокироваться до завершения программы.
 	// ListenAndServe всегда возвращает ошибку, поскольку она возвращается 
 	// только тогда, когда случилась неожиданная ошибка. 
 	// Чтобы записать эту ошибку в лог, мы заключаем вызов функции в log.Fatal.:
-	log.Fatal(http.ListenAndServe(":8080", nil))
+	log.Fatal(listenAndServe(root, cfg.Addr, cfg.CertFile, cfg.KeyFile, ServerTimeouts{
+		Read:  time.Duration(cfg.ReadTimeout),
+		Write: time.Duration(cfg.WriteTimeout),
+		Idle:  time.Duration(cfg.IdleTimeout),
+	}))
+}
+
+// envString возвращает значение переменной окружения name
+// или def, если переменная не задана.
+func envString(name, def string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return def
+}
+
+// envInt возвращает значение переменной окружения name как число
+// или def, если переменная не задана. Некорректное значение
+// останавливает сервер при старте.
+func envInt(name string, def int) int {
+	v := os.Getenv(name)
+	if v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		log.Fatalf("некорректное значение %s: %q", name, v)
+	}
+	return n
 }
 
 // Функция handler имеет тип http.HandlerFunc. 
@@ -61,92 +553,680 @@ func main()  {
 // написав в него, мы отправляем данные HTTP-клиенту.
 // http.Request - это структура данных, которая представляет клиентский HTTP-запрос.
 func handler(w http.ResponseWriter, r *http.Request) {
-	// r.URL.Path является компонентом пути URL запроса. 
-	// Конечный [1:] означает "создать под-срез Path от 1-го символа до конца."
-	// Это удаляет ведущий "/" из имени пути.
-	fmt.Fprintf(w, "Hi there, I love %s!", r.URL.Path[1:])
-	// w.Write([]byte("Hi there, I love Go!"))
+	// Шаблон "/" в mux совпадает с любым путем, для которого нет
+	// другого обработчика, поэтому все, кроме самого "/", - это 404.
+	if r.URL.Path != "/" {
+		notFoundHandler(w, r)
+		return
+	}
+	// Сам "/" показывает список всех страниц из хранилища.
+	titles, err := store.List()
+	if err != nil {
+		errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	// Анонимным пользователям закрытые страницы не показываются.
+	if titles, err = visibleTitles(r, titles); err != nil {
+		errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	sort.Strings(titles)
+	index, err := tagIndexCache.Index(titles)
+	if err != nil {
+		errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	pg := paginate(len(titles), queryInt(r, "page", 1), queryInt(r, "size", defaultPageSize))
+	renderTemplate(w, "index", struct {
+		Titles []string
+		Tags   []tagCount
+		Pagination
+	}{titles[pg.start:pg.end], tagCloud(index), pg})
+}
+
+// defaultPageSize - число страниц на одной странице списка,
+// если параметр size не указан.
+const defaultPageSize = 50
+
+// Pagination описывает одну страницу списка: ее номер (с единицы),
+// общее число страниц и соседние номера для ссылок. Prev и Next
+// равны нулю, если соседней страницы нет.
+type Pagination struct {
+	Page, Pages, Size int
+	Prev, Next        int
+	start, end        int
+}
+
+// paginate делит total элементов на страницы по size и возвращает
+// страницу page. Номер вне допустимого диапазона прижимается
+// к первой или последней странице.
+func paginate(total, page, size int) Pagination {
+	if size < 1 {
+		size = defaultPageSize
+	}
+	pages := (total + size - 1) / size
+	if pages < 1 {
+		pages = 1
+	}
+	if page < 1 {
+		page = 1
+	}
+	if page > pages {
+		page = pages
+	}
+	p := Pagination{Page: page, Pages: pages, Size: size}
+	if page > 1 {
+		p.Prev = page - 1
+	}
+	if page < pages {
+		p.Next = page + 1
+	}
+	p.start = (page - 1) * size
+	p.end = p.start + size
+	if p.end > total {
+		p.end = total
+	}
+	return p
 }
 
-func (p *Page) save() error {
-	filename := p.Title + ".txt"
-	return ioutil.WriteFile(filename, p.Body, 0600)
+// queryInt возвращает целый параметр запроса name или def, если
+// параметра нет или он не число.
+func queryInt(r *http.Request, name string, def int) int {
+	n, err := strconv.Atoi(r.URL.Query().Get(name))
+	if err != nil {
+		return def
+	}
+	return n
+}
+
+// maxPageSize - наибольший размер тела запроса на сохранение
+// страницы в байтах (флаг -maxsize или max_size в файле настроек,
+// по умолчанию WEB_MAX_PAGE_SIZE или 512 КБ). Реализации Storage.Save
+// отказываются сохранять страницу длиннее, даже если обработчик
+// забыл ее проверить.
+var maxPageSize int64 = 512 << 10
+
+// maxFormSize - предел тела запроса с текстом страницы. В форме текст
+// закодирован процентами (до трех байт на байт текста), в JSON -
+// экранирован, и рядом есть другие поля, поэтому тело может быть
+// длиннее maxPageSize; сам текст затем проверяется по maxPageSize.
+func maxFormSize() int64 {
+	return 3*maxPageSize + 64<<10
+}
+
+// readOnly включается флагом -readonly: страницы нельзя создавать
+// и менять ни через HTML-интерфейс, ни через API и GraphQL, а
+// несуществующая страница - 404, а не форма редактирования.
+var readOnly bool
+
+var errReadOnly = errors.New("the wiki is read-only")
+
+// readOnlyMiddleware в режиме -readonly отвечает 405 на все запросы,
+// кроме GET, HEAD и OPTIONS, - так закрыты все изменения через API.
+func readOnlyMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !readOnly {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("Allow", "GET, HEAD, OPTIONS")
+		writeJSONError(w, http.StatusMethodNotAllowed, errReadOnly.Error())
+	})
+}
+
+var errPageTooLarge = errors.New("page is larger than the allowed size")
+
+// pageFileMode - права, с которыми создаются файлы страниц (флаг -perm).
+var pageFileMode os.FileMode = 0600
+
+// Метод save не перезаписывает файл страницы на месте: новое содержимое
+// пишется во временный файл, который затем атомарно переименовывается
+// поверх старого. Предыдущая версия перед этим попадает в историю.
+// Одновременные сохранения одной страницы выполняются по очереди.
+func (p *Page) save(filename string) error {
+	return withPageLock(p.Title, func() error {
+		old, err := ioutil.ReadFile(filename)
+		if err == nil {
+			if p.Create {
+				return errPageExists
+			}
+			if _, err := versions.Save(p.Title, old); err != nil {
+				return err
+			}
+		} else if !os.IsNotExist(err) {
+			return err
+		}
+		return writeFileAtomic(filename, p.Body, pageFileMode)
+	})
+}
+
+// writeFileAtomic записывает data во временный файл в том же каталоге
+// и переименовывает его в filename, так что читатели видят либо старое,
+// либо новое содержимое целиком. Если запись не удалась, прежний файл
+// остается нетронутым, а временный удаляется.
+func writeFileAtomic(filename string, data []byte, perm os.FileMode) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(filename), filepath.Base(filename)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return err
+	}
+	// Данные должны оказаться на диске до переименования, иначе после
+	// сбоя питания на месте страницы может остаться пустой файл.
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filename)
 }
 
-func loadPage(title string) (*Page, error) {
-	filename := title + ".txt"
-	body, err := ioutil.ReadFile(filename)
+func loadPage(filename, title string) (*Page, error) {
+	var body []byte
+	var info os.FileInfo
+	err := withPageRLock(title, func() (err error) {
+		body, err = ioutil.ReadFile(filename)
+		if err != nil {
+			return err
+		}
+		info, err = os.Stat(filename)
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
-	return &Page{Title: title, Body: body}, nil
+	meta, _ := parseFrontmatter(body)
+	return &Page{Title: title, Body: body, Modified: info.ModTime(), Meta: meta}, nil
 }
 
-func viewHandler(w http.ResponseWriter, r *http.Request, title string) {
+func pageResourceHandler(w http.ResponseWriter, r *http.Request, title string) {
+	// Страница отдается в HTML или, если клиент просит JSON
+	// (curl -H "Accept: application/json" /view/Title), в том же
+	// виде, что GET /api/v1/pages/{title}.
+	w.Header().Add("Vary", "Accept")
+	asJSON := negotiateContentType(r.Header.Get("Accept")) == "json"
+	fail := func(status int, msg string) {
+		if !asJSON {
+			errorHandler(w, r, status, msg)
+		} else if status >= 500 {
+			serverError(w, errors.New(msg))
+		} else {
+			writeJSONError(w, status, msg)
+		}
+	}
 	// Опять же, обратите внимание на использование _ для игнорирования error, 
 	// при возвращении значения из loadPage. Это сделано здесь для простоты и 
 	// вообще считается плохой практикой. 
-	p, err := loadPage(title)
+	p, err := store.Load(title)
+	if errors.Is(err, os.ErrNotExist) {
+		// /view/{slug} показывает страницу, которой принадлежит slug.
+		if t, ok, _ := slugs.Resolve(title); ok {
+			title = t
+			p, err = store.Load(title)
+		}
+	}
+	if errors.Is(err, os.ErrNotExist) {
+		// Переименованная страница навсегда переехала по новому адресу.
+		if to, ok, _ := redirects.Lookup(title); ok {
+			http.Redirect(w, r, withQuery(r, "/view/"+to), http.StatusMovedPermanently)
+			return
+		}
+		// Неизвестный slug - не заголовок, создать такую страницу нельзя.
+		// Клиенту JSON и в режиме -readonly предлагать форму
+		// редактирования незачем.
+		if readOnly && !asJSON {
+			notFoundHandler(w, r)
+			return
+		}
+		if asJSON {
+			writeJSONError(w, http.StatusNotFound, "page not found")
+			return
+		}
+		if validateTitle(title) != nil {
+			notFoundHandler(w, r)
+			return
+		}
+	}
 	if err != nil {
-		// Функция http.Redirect добавляет код статуса HTTP http.StatusFound(302) и
+		if asJSON {
+			serverError(w, err)
+			return
+		}
+		// Функция redirectTo добавляет код статуса HTTP http.StatusFound(302) и
 		// Location заголовок к HTTP ответу.
-		http.Redirect(w, r, "/edit/"+ title, http.StatusFound)
+		redirectTo(w, r, "/edit/"+title)
+		return
+	}
+	meta, err := metas.Load(title)
+	if err != nil {
+		fail(http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !meta.Public && !isEditor(userFromContext(r.Context())) {
+		// Закрытую страницу можно открыть без входа по ссылке
+		// с токеном из POST /api/v1/pages/{title}/share.
+		tok := r.URL.Query().Get("token")
+		if tok == "" {
+			if asJSON {
+				writeJSONError(w, http.StatusUnauthorized, "authentication required")
+				return
+			}
+			requireLogin(w, r)
+			return
+		}
+		if err := shares.Check(title, tok, time.Now()); err != nil {
+			if err != errShareInvalid && err != errShareExpired {
+				fail(http.StatusInternalServerError, err.Error())
+				return
+			}
+			fail(http.StatusForbidden, "This share link is invalid or has expired")
+			return
+		}
+	}
+	if asJSON {
+		if p.Slug, err = slugs.Get(title); err != nil {
+			serverError(w, err)
+			return
+		}
+		if notModified(w, r, pageETag(p, nil), p.Modified) {
+			return
+		}
+		writeJSON(w, http.StatusOK, p)
+		return
+	}
+	p.Tags = pageTagsFor(p, meta)
+	// Строки с тегами остаются в тексте для редактирования,
+	// но при просмотре вместо них показывается список тегов.
+	_, p.Body = contentTags(p.Body)
+	v := newPageView(r, p)
+	v.Private = !meta.Public
+	v.HTML = renderBody(p.Body, pageExists)
+	if v.Comments, err = comments.List(title); err != nil {
+		errorHandler(w, r, http.StatusInternalServerError, err.Error())
 		return
 	}
-	renderTemplate(w, "view", p)
+	modified := p.Modified
+	for _, c := range v.Comments {
+		if c.CreatedAt.After(modified) {
+			modified = c.CreatedAt
+		}
+	}
+	if notModified(w, r, pageETag(p, v.Comments), modified) {
+		return
+	}
+	// Просмотром считается только отданная HTML-страница: ни JSON,
+	// ни 304 из кэша браузера счетчик не увеличивают. Поэтому и в ETag
+	// он не входит.
+	if v.Views, err = metas.CountView(title); err != nil {
+		fail(http.StatusInternalServerError, err.Error())
+		return
+	}
+	renderTemplate(w, "view", v)
+}
+
+// rawHandler отдает текст страницы в том виде, в каком он сохранен,
+// без шаблонов и обработки ссылок.
+func rawHandler(w http.ResponseWriter, r *http.Request, title string) {
+	if !allowMethod(w, r, http.MethodGet, http.MethodHead) {
+		return
+	}
+	// Видимость проверяется до загрузки, а закрытая страница отвечает
+	// тем же 404, что и несуществующая: иначе по ответам без входа
+	// можно было бы узнать, какие закрытые страницы есть.
+	ok, err := canRead(r, title)
+	if err != nil {
+		serverError(w, err)
+		return
+	}
+	if !ok {
+		http.Error(w, "404 page not found", http.StatusNotFound)
+		return
+	}
+	p, err := store.Load(title)
+	if errors.Is(err, os.ErrNotExist) {
+		http.Error(w, "404 page not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		serverError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if notModified(w, r, pageETag(p, nil), p.Modified) {
+		return
+	}
+	w.Write(p.Body)
+}
+
+// pageETag вычисляет ETag страницы: SHA-256 ее тела, тегов и
+// комментариев в шестнадцатеричном виде. Тег слабый (W/): CSRF-токен
+// и CSP nonce в HTML меняются от запроса к запросу, но содержание
+// страницы при этом то же самое.
+func pageETag(p *Page, list []Comment) string {
+	h := sha256.New()
+	h.Write(p.Body)
+	for _, t := range p.Tags {
+		h.Write([]byte{0})
+		h.Write([]byte(t))
+	}
+	h.Write([]byte{1})
+	for _, c := range list {
+		h.Write([]byte{0})
+		h.Write([]byte(c.ID))
+	}
+	return fmt.Sprintf(`W/"%x"`, h.Sum(nil))
+}
+
+// notModified ставит заголовки ETag и Last-Modified и, если условный
+// запрос показывает, что у клиента та же версия, отвечает 304 без тела
+// и возвращает true. If-None-Match, если он есть, важнее
+// If-Modified-Since. Время сравнивается с точностью до секунды,
+// как в заголовке.
+func notModified(w http.ResponseWriter, r *http.Request, etag string, modified time.Time) bool {
+	w.Header().Set("ETag", etag)
+	if !modified.IsZero() {
+		w.Header().Set("Last-Modified", modified.UTC().Format(http.TimeFormat))
+	}
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		if !etagMatches(inm, etag) {
+			return false
+		}
+	} else {
+		since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+		if err != nil || modified.IsZero() || modified.Truncate(time.Second).After(since) {
+			return false
+		}
+	}
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// etagMatches сообщает, совпадает ли etag с одним из тегов
+// заголовка If-None-Match. Как и положено для If-None-Match,
+// теги сравниваются без учета префикса W/.
+func etagMatches(header, etag string) bool {
+	if header == "" {
+		return false
+	}
+	if strings.TrimSpace(header) == "*" {
+		return true
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, t := range strings.Split(header, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(t), "W/") == etag {
+			return true
+		}
+	}
+	return false
 }
 
 // Функция editHandler загружает страницу (или, если он не существует, 
 // создает пустую структуру Page), и отображает HTML форму.
 func editHandler(w http.ResponseWriter, r *http.Request, title string) {
-	p, err := loadPage(title)
+	p, err := store.Load(title)
 	if err != nil {
 		p = &Page{Title: title}
 	}
-	renderTemplate(w, "edit", p)
+	if meta, err := metas.Load(title); err == nil {
+		p.Tags = meta.Tags
+	}
+	v := newPageView(r, p)
+	// Форма получает блокировку страницы, и сохранить страницу из другой
+	// формы, открытой раньше или другим пользователем, уже нельзя.
+	if l, ok := acquireEditLock(title, editorName(r), time.Now()); ok {
+		v.LockToken = l.Token
+	} else {
+		v.Error = fmt.Sprintf("%s has been editing this page since %s. Saving will fail until they finish or the lock expires.",
+			l.User, l.AcquiredAt.Format("15:04"))
+	}
+	renderTemplate(w, "edit", v)
 }
 
-func renderTemplate(w http.ResponseWriter, tmpl string, p *Page) {
-	// Функция template.ParseFiles будет читать содержимое *.html
-	// и возвращать *template.Template.
-	err :=templates.ExecuteTemplate(w, tmpl + ".html", p)
+func renderTemplate(w http.ResponseWriter, tmpl string, p interface{}) {
+	// Шаблон берется из уже разобранного набора templates,
+	// поэтому диск на каждом запросе не читается.
+	// Тип указывается явно: без него браузер угадывает кодировку
+	// по началу ответа и может исказить кириллицу.
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	err := templates.Templates().ExecuteTemplate(w, tmpl + ".html", p)
 	if err != nil {
-		// Функция http.Error отправляет указанный код HTTP ответа
-		// (в данном случае "Internal Server Error") и сообщение об ошибке. 
-		// Решение о том, чтобы поместить обработку шаблонов в 
-		// отдельную функцию, уже окупается.
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		// Функция serverError записывает подробности в лог и отправляет
+		// клиенту код "Internal Server Error" без текста ошибки, в котором
+		// могли бы оказаться пути к файлам. Решение о том, чтобы поместить
+		// обработку шаблонов в отдельную функцию, уже окупается.
+		serverError(w, err)
 		return
 	}
-	// Метод t.Execute выполняет шаблон, записывая сгенерированный
-	// HTML для http.ResponseWriter. Точечные идентификаторы .Title
-	// и .Body относятся к p.Title и p.Body. 
-	// err = t.Execute(w, p)
-	// if err != nil {
-	// 	http.Error(w, err.Error(), http.StatusInternalServerError)
-	// }
 }
 
 // Функция saveHandler будет обрабатывать отправку форм, 
 // которые находятся на страницах редактирования.
 func saveHandler(w http.ResponseWriter, r *http.Request, title string) {
+	// Сохранение меняет данные, поэтому принимается только POST:
+	// иначе страницу можно было бы перезаписать обычной ссылкой.
+	if !allowMethod(w, r, http.MethodPost) {
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxFormSize())
+	if err := r.ParseForm(); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			errorHandler(w, r, http.StatusRequestEntityTooLarge, "Page is larger than the allowed size")
+			return
+		}
+		errorHandler(w, r, http.StatusBadRequest, "Malformed form: "+err.Error())
+		return
+	}
 	// Заголовок страницы (указан в URL) и единственное поле формы, 
-	// Body хранятся на новой Page. Затем вызывается метод save() 
-	// для записи данных в файл, и клиент перенаправляется на страницу /view/.
+	// Body хранятся на новой Page. Затем она передается в store.Save
+	// для записи в хранилище, и клиент перенаправляется на страницу /view/.
 	body := r.FormValue("body")
 	// Значение, возвращаемое FormValue, имеет тип string. 
 	// Мы должны преобразовать это значение в []byte, прежде 
 	// чем оно уместится в структуре Page. Мы используем
 	// []byte(body) для выполнения преобразования.
-	p := &Page{Title: title, Body: []byte(body)}
-	err := p.save()
-	// О любых ошибках, возникающих во время p.save(), 
+	// Форму мог уже прочитать csrfMiddleware, до того как тело
+	// было ограничено, поэтому размер текста проверяется еще раз.
+	if int64(len(body)) > maxPageSize {
+		errorHandler(w, r, http.StatusRequestEntityTooLarge, "Page is larger than the allowed size")
+		return
+	}
+	p := &Page{Title: title, Body: []byte(body), LastEditor: editorName(r)}
+	// Поле tags - список тегов через запятую.
+	p.Tags = normalizeTags(strings.Split(r.FormValue("tags"), ","))
+	// Пока страницу держит форма, открытая позже или другим
+	// пользователем, сохранение затерло бы чужую правку.
+	lockToken := r.FormValue("lock_token")
+	if l := checkEditLock(title, lockToken, time.Now()); l != nil {
+		if wantsJSON(r) {
+			lockConflict(w, l)
+			return
+		}
+		// Браузеру форма показывается снова вместе с отправленным
+		// текстом, чтобы правка не пропала.
+		v := newPageView(r, p)
+		v.Error = fmt.Sprintf("Not saved: this page is locked by %s since %s. Keep your text and save again when they finish or the lock expires.",
+			l.User, l.AcquiredAt.Format("15:04"))
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusConflict)
+		renderTemplate(w, "edit", v)
+		return
+	}
+	// Пустое поле чаще всего стерто случайно, поэтому без явного
+	// ?allowempty=1 страница не затирается, а форма показывается снова.
+	if strings.TrimSpace(body) == "" && r.URL.Query().Get("allowempty") != "1" {
+		v := newPageView(r, p)
+		v.LockToken = lockToken
+		v.Error = "The page text is empty. Press Save again to save an empty page."
+		v.AllowEmpty = true
+		renderTemplate(w, "edit", v)
+		return
+	}
+	action := auditEdit
+	if _, err := store.Load(title); errors.Is(err, os.ErrNotExist) {
+		action = auditCreate
+	}
+	err := store.Save(p)
+	// О любых ошибках, возникающих во время store.Save, 
 	// будет сообщено пользователю.
+	if err == errPageTooLarge {
+		errorHandler(w, r, http.StatusRequestEntityTooLarge, "Page is larger than the allowed size")
+		return
+	}
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if err := metas.Update(title, func(m *PageMeta) { m.Tags = p.Tags }); err != nil {
+		errorHandler(w, r, http.StatusInternalServerError, err.Error())
 		return
 	}
-	http.Redirect(w, r, "/view/" + title, http.StatusFound)
+	if _, err := slugs.Assign(title); err != nil {
+		errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	releaseEditLock(title, lockToken)
+	audit(r, action, title)
+	redirectTo(w, r, "/view/"+title)
+}
+
+// redirectParams - параметры запроса, которые относятся только к самому
+// запросу и при переадресации отбрасываются.
+var redirectParams = []string{"allowempty"}
+
+// withQuery добавляет к path параметры запроса r (кроме redirectParams),
+// например ?theme=dark, чтобы они сохранялись при переходе.
+func withQuery(r *http.Request, path string) string {
+	q := r.URL.Query()
+	for _, p := range redirectParams {
+		q.Del(p)
+	}
+	if len(q) == 0 {
+		return path
+	}
+	sep := "?"
+	if strings.Contains(path, "?") {
+		sep = "&"
+	}
+	return path + sep + q.Encode()
+}
+
+// redirectTo отправляет клиента на path (302 Found) с параметрами
+// исходного запроса.
+func redirectTo(w http.ResponseWriter, r *http.Request, path string) {
+	http.Redirect(w, r, withQuery(r, path), http.StatusFound)
+}
+
+// Функция deleteHandler удаляет страницу и возвращает пользователя
+// к списку страниц. Как и сохранение, удаление принимается только POST.
+func deleteHandler(w http.ResponseWriter, r *http.Request, title string) {
+	if !allowMethod(w, r, http.MethodPost) {
+		return
+	}
+	if l := checkEditLock(title, r.FormValue("lock_token"), time.Now()); l != nil {
+		errorHandler(w, r, http.StatusConflict, "Cannot delete the page: "+l.Error())
+		return
+	}
+	err := store.Delete(title)
+	if errors.Is(err, os.ErrNotExist) {
+		notFoundHandler(w, r)
+		return
+	}
+	if err != nil {
+		errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	audit(r, auditDelete, title)
+	http.Redirect(w, r, "/", http.StatusFound)
+}
+
+// renamePage переименовывает страницу в хранилище вместе с ее
+// метаданными и комментариями, назначает ей slug по новому заголовку
+// и запоминает перенаправление со старого заголовка.
+func renamePage(oldTitle, newTitle string) error {
+	if err := store.Rename(oldTitle, newTitle); err != nil {
+		return err
+	}
+	if err := metas.Rename(oldTitle, newTitle); err != nil {
+		return err
+	}
+	if err := comments.Rename(oldTitle, newTitle); err != nil {
+		return err
+	}
+	if err := slugs.Remove(oldTitle); err != nil {
+		return err
+	}
+	if _, err := slugs.Assign(newTitle); err != nil {
+		return err
+	}
+	return redirects.Add(oldTitle, newTitle)
+}
+
+// Функция renameHandler переименовывает страницу: POST /rename/{old}
+// с полем формы newtitle. Старый адрес после этого перенаправляет
+// на новый. Если страница с новым заголовком уже есть, отвечает 409.
+func renameHandler(w http.ResponseWriter, r *http.Request, title string) {
+	if !allowMethod(w, r, http.MethodPost) {
+		return
+	}
+	newTitle := normalizeTitle(r.FormValue("newtitle"))
+	if err := validateTitle(newTitle); err != nil {
+		errorHandler(w, r, http.StatusBadRequest, "Invalid new title: "+err.Error())
+		return
+	}
+	if newTitle == title {
+		errorHandler(w, r, http.StatusConflict, "Page "+newTitle+" already exists")
+		return
+	}
+	for _, t := range []string{title, newTitle} {
+		if l := checkEditLock(t, r.FormValue("lock_token"), time.Now()); l != nil {
+			errorHandler(w, r, http.StatusConflict, "Cannot rename the page: "+l.Error())
+			return
+		}
+	}
+	err := renamePage(title, newTitle)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		notFoundHandler(w, r)
+		return
+	case err == errPageExists:
+		errorHandler(w, r, http.StatusConflict, "Page "+newTitle+" already exists")
+		return
+	case err != nil:
+		errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	audit(r, auditRename, title)
+	http.Redirect(w, r, "/view/"+newTitle, http.StatusFound)
+}
+
+// Функция allowMethod проверяет, что метод запроса - один из methods.
+// Если нет, она отвечает 405 Method Not Allowed с заголовком Allow
+// и возвращает false. Ее стоит вызывать в начале каждого обработчика,
+// который изменяет данные.
+func allowMethod(w http.ResponseWriter, r *http.Request, methods ...string) bool {
+	for _, m := range methods {
+		if r.Method == m {
+			return true
+		}
+	}
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+	return false
 }
 
 // Теперь давайте напишем функцию, которая использует validPath выражение
@@ -171,16 +1251,24 @@ func getTitle (w http.ResponseWriter, r *http.Request) (string, error) {
 // http.HandlerFunc). Замыкание извлекает title из пути запроса и 
 // проверяет его с помощью TitleValidator regexp. Если title 
 // недействителен, ошибка будет записана в ResponseWriter с помощью
-// функции http.NotFound. Если title допустим, вложенная 
+// функции notFoundHandler. Если title допустим, вложенная 
 // функция-обработчик fn будет вызываться с помощью ResponseWriter,
 // Request и title в качестве аргументов.
 func makeHandler(fn func(http.ResponseWriter, *http.Request, string)) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		m := validPath.FindStringSubmatch(r.URL.Path)
 		if m == nil {
-			http.NotFound(w, r)
+			notFoundHandler(w, r)
 			return
 		}
+		if err := validateTitle(m[2]); err != nil {
+			// Для /view/ вместо заголовка может стоять slug;
+			// pageResourceHandler сам найдет по нему страницу.
+			if !slugViewPath.MatchString(r.URL.Path) {
+				errorHandler(w, r, http.StatusBadRequest, "Invalid page title: "+err.Error())
+				return
+			}
+		}
 		fn(w, r, m[2])
 	}
 }
\ No newline at end of file
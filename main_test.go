@@ -0,0 +1,626 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	graphql "github.com/graph-gophers/graphql-go"
+)
+
+func TestRawHandler(t *testing.T) {
+	testDataDir(t)
+	body := "# Public\r\ntext with [[Link]]\n"
+	savePage(t, "Public", body)
+	savePage(t, "Private", "secret")
+	if err := metas.Update("Private", func(m *PageMeta) { m.Public = false }); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		title    string
+		user     *User
+		want     int
+		wantBody string
+	}{
+		{"public page", "Public", nil, http.StatusOK, body},
+		{"private page looks missing", "Private", nil, http.StatusNotFound, ""},
+		{"missing page", "Missing", nil, http.StatusNotFound, ""},
+		{"private page with login", "Private", &User{Username: "bob"}, http.StatusOK, "secret"},
+		{"missing page with login", "Missing", &User{Username: "bob"}, http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/raw/"+tt.title, nil)
+			if tt.user != nil {
+				r = r.WithContext(context.WithValue(r.Context(), userContextKey, tt.user))
+			}
+			w := httptest.NewRecorder()
+			makeHandler(rawHandler)(w, r)
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d", w.Code, tt.want)
+			}
+			if tt.wantBody != "" && w.Body.String() != tt.wantBody {
+				t.Errorf("body = %q, want %q", w.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
+
+// setReadOnly включает режим -readonly до конца теста.
+func setReadOnly(t *testing.T) {
+	readOnly = true
+	t.Cleanup(func() { readOnly = false })
+}
+
+func TestViewMissingPage(t *testing.T) {
+	tests := []struct {
+		name     string
+		readOnly bool
+		path     string
+		want     int
+		wantLoc  string
+	}{
+		{"offers the edit form", false, "/view/Missing", http.StatusFound, "/edit/Missing"},
+		{"read-only", true, "/view/Missing", http.StatusNotFound, ""},
+		{"renamed page", false, "/view/Old", http.StatusMovedPermanently, "/view/New"},
+		{"renamed page in read-only mode", true, "/view/Old?x=1", http.StatusMovedPermanently, "/view/New?x=1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testDataDir(t)
+			if err := redirects.Add("Old", "New"); err != nil {
+				t.Fatal(err)
+			}
+			if tt.readOnly {
+				setReadOnly(t)
+			}
+			w := httptest.NewRecorder()
+			makeHandler(pageResourceHandler)(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d", w.Code, tt.want)
+			}
+			if loc := w.Header().Get("Location"); loc != tt.wantLoc {
+				t.Errorf("Location = %q, want %q", loc, tt.wantLoc)
+			}
+		})
+	}
+}
+
+func TestReadOnlyRejectsAPIWrites(t *testing.T) {
+	testDataDir(t)
+	savePage(t, "Foo", "text")
+	setReadOnly(t)
+	h := readOnlyMiddleware(apiPageHandler(func(h http.Handler) http.Handler { return h }, func(h http.Handler) http.Handler { return h }))
+	tests := []struct {
+		method, path, body string
+		want               int
+	}{
+		{http.MethodGet, "/api/v1/pages/Foo", "", http.StatusOK},
+		{http.MethodPut, "/api/v1/pages/Foo", `{"body":"new"}`, http.StatusMethodNotAllowed},
+		{http.MethodDelete, "/api/v1/pages/Foo", "", http.StatusMethodNotAllowed},
+		{http.MethodPost, "/api/v1/pages/Foo/rename", `{"new_title":"Bar"}`, http.StatusMethodNotAllowed},
+		{http.MethodPost, "/api/v1/pages/Foo/clone", `{"new_title":"Bar"}`, http.StatusMethodNotAllowed},
+		{http.MethodPatch, "/api/v1/pages/Foo/visibility", `{"public":false}`, http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		if w := serve(h.ServeHTTP, tt.method, tt.path, tt.body); w.Code != tt.want {
+			t.Errorf("%s %s: status = %d, want %d", tt.method, tt.path, w.Code, tt.want)
+		}
+	}
+	if p, err := store.Load("Foo"); err != nil || string(p.Body) != "text" {
+		t.Errorf("page after rejected writes = %v, %v; want it unchanged", p, err)
+	}
+
+	schema := graphql.MustParseSchema(graphqlSchema, &graphqlResolver{})
+	resp := schema.Exec(graphqlContext(&User{Username: "bob"}), `mutation { deletePage(title: "Foo") }`, "", nil)
+	if len(resp.Errors) != 1 || resp.Errors[0].Message != errReadOnly.Error() {
+		t.Errorf("deletePage in read-only mode: errors = %v, want %q", resp.Errors, errReadOnly)
+	}
+}
+
+func TestViewIfModifiedSince(t *testing.T) {
+	testDataDir(t)
+	savePage(t, "Foo", "text")
+	view := func(header map[string]string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/view/Foo", nil)
+		for k, v := range header {
+			r.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		makeHandler(pageResourceHandler)(w, r)
+		return w
+	}
+	modified := view(nil).Header().Get("Last-Modified")
+	lm, err := http.ParseTime(modified)
+	if err != nil {
+		t.Fatalf("Last-Modified = %q: %v", modified, err)
+	}
+	tests := []struct {
+		name   string
+		header map[string]string
+		want   int
+	}{
+		{"future date", map[string]string{"If-Modified-Since": time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)}, http.StatusNotModified},
+		{"same date", map[string]string{"If-Modified-Since": modified}, http.StatusNotModified},
+		{"older date", map[string]string{"If-Modified-Since": lm.Add(-time.Second).Format(http.TimeFormat)}, http.StatusOK},
+		{"malformed date", map[string]string{"If-Modified-Since": "yesterday"}, http.StatusOK},
+		{"If-None-Match wins", map[string]string{
+			"If-Modified-Since": time.Now().Add(time.Hour).UTC().Format(http.TimeFormat),
+			"If-None-Match":     `"other"`,
+		}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := view(tt.header)
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d", w.Code, tt.want)
+			}
+			if tt.want == http.StatusNotModified && w.Body.Len() != 0 {
+				t.Errorf("304 response has a body: %q", w.Body)
+			}
+		})
+	}
+}
+
+func TestViewETag(t *testing.T) {
+	testDataDir(t)
+	savePage(t, "Foo", "text")
+	first := httptest.NewRecorder()
+	makeHandler(pageResourceHandler)(first, httptest.NewRequest(http.MethodGet, "/view/Foo", nil))
+	etag := first.Header().Get("ETag")
+	if first.Code != http.StatusOK || etag == "" {
+		t.Fatalf("first request: status = %d, ETag = %q; want 200 with an ETag", first.Code, etag)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/view/Foo", nil)
+	r.Header.Set("If-None-Match", etag)
+	second := httptest.NewRecorder()
+	makeHandler(pageResourceHandler)(second, r)
+	if second.Code != http.StatusNotModified || second.Body.Len() != 0 {
+		t.Errorf("second request: status = %d, body %q; want 304 without a body", second.Code, second.Body)
+	}
+	if got := second.Header().Get("ETag"); got != etag {
+		t.Errorf("304 ETag = %q, want %q", got, etag)
+	}
+}
+
+// Сохранение меняет ETag, а условные заголовки не превращают
+// отсутствующую страницу в 304.
+func TestConditionalGetAfterSave(t *testing.T) {
+	handlers := []struct {
+		name   string
+		h      http.HandlerFunc
+		target string
+		// wantMissing - ответ для отсутствующей страницы: /view
+		// предлагает ее создать.
+		wantMissing int
+	}{
+		{"view", makeHandler(pageResourceHandler), "/view/", http.StatusFound},
+		{"api", apiGetPage, "/api/v1/pages/", http.StatusNotFound},
+	}
+	for _, hh := range handlers {
+		t.Run(hh.name, func(t *testing.T) {
+			testDataDir(t)
+			get := func(title, etag string) *httptest.ResponseRecorder {
+				r := httptest.NewRequest(http.MethodGet, hh.target+title, nil)
+				if etag != "" {
+					r.Header.Set("If-None-Match", etag)
+					r.Header.Set("If-Modified-Since", time.Now().Add(time.Hour).UTC().Format(http.TimeFormat))
+				}
+				w := httptest.NewRecorder()
+				hh.h(w, r)
+				return w
+			}
+			savePage(t, "Foo", "old")
+			etag := get("Foo", "").Header().Get("ETag")
+			if w := get("Foo", etag); w.Code != http.StatusNotModified {
+				t.Fatalf("unchanged page: status = %d, want 304", w.Code)
+			}
+
+			savePage(t, "Foo", "new")
+			w := get("Foo", etag)
+			if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "new") {
+				t.Errorf("after save: status = %d, body %q; want 200 with the new text", w.Code, w.Body)
+			}
+			if got := w.Header().Get("ETag"); got == etag || got == "" {
+				t.Errorf("ETag after save = %q, want a new one (was %q)", got, etag)
+			}
+
+			if w := get("Missing", etag); w.Code != hh.wantMissing {
+				t.Errorf("missing page with cache headers: status = %d, want %d", w.Code, hh.wantMissing)
+			}
+		})
+	}
+}
+
+func TestValidateTitle(t *testing.T) {
+	tests := []struct {
+		name    string
+		title   string
+		wantErr string
+	}{
+		{"plain", "FrontPage", ""},
+		{"empty", "", "empty"},
+		{"199 characters", strings.Repeat("я", 199), ""},
+		{"200 characters", strings.Repeat("я", 200), ""},
+		{"201 characters", strings.Repeat("я", 201), "longer than 200"},
+		{"newline", "a\nb", "control character"},
+		{"tab", "a\tb", "control character"},
+		{"space", "a b", "only letters and digits"},
+		{"hyphen", "a-b", "only letters and digits"},
+	}
+	for _, c := range titleForbidden {
+		tests = append(tests, struct {
+			name    string
+			title   string
+			wantErr string
+		}{fmt.Sprintf("forbidden %q", c), "a" + string(c) + "b", "forbidden character"})
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateTitle(tt.title)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("validateTitle(%q) = %v, want nil", tt.title, err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("validateTitle(%q) = %v, want an error about %q", tt.title, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// Неверный заголовок в URL дает 400: JSON для API, HTML для браузера.
+func TestInvalidTitleResponses(t *testing.T) {
+	testDataDir(t)
+	noop := func(h http.Handler) http.Handler { return h }
+	tests := []struct {
+		name     string
+		h        http.Handler
+		target   string
+		wantType string
+	}{
+		{"api", apiPageHandler(noop, noop), "/api/v1/pages/a:b", "application/json"},
+		{"api too long", apiPageHandler(noop, noop), "/api/v1/pages/" + strings.Repeat("a", 201), "application/json"},
+		{"edit", makeHandler(editHandler), "/edit/a*b", "text/html"},
+		{"save", makeHandler(saveHandler), "/save/a%3Cb", "text/html"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			tt.h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.target, nil))
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("status = %d, want 400", w.Code)
+			}
+			if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, tt.wantType) {
+				t.Errorf("Content-Type = %q, want %s", ct, tt.wantType)
+			}
+			if tt.wantType == "application/json" {
+				var body struct{ Error string }
+				if err := json.NewDecoder(w.Body).Decode(&body); err != nil || body.Error == "" {
+					t.Errorf("body = %q, want {\"error\": ...}", w.Body)
+				}
+			}
+		})
+	}
+}
+
+// Кириллические заголовки допустимы, а составная и готовая формы
+// одного символа ведут к одной странице.
+func TestUnicodeTitles(t *testing.T) {
+	dir := testDataDir(t)
+	const composed, decomposed = "Ёлка", "Е\u0308лка"
+	for _, title := range []string{"Главная", "Страница2", composed, decomposed} {
+		if err := validateTitle(normalizeTitle(title)); err != nil {
+			t.Errorf("validateTitle(%q) = %v, want nil", title, err)
+		}
+	}
+	if normalizeTitle(decomposed) != composed {
+		t.Fatalf("normalizeTitle(%q) = %q, want %q", decomposed, normalizeTitle(decomposed), composed)
+	}
+
+	if err := store.Save(&Page{Title: decomposed, Body: []byte("ель")}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, composed+".txt")); err != nil {
+		t.Errorf("page file is not stored under the NFC title: %v", err)
+	}
+	p, err := store.Load(composed)
+	if err != nil || string(p.Body) != "ель" || p.Title != composed {
+		t.Errorf("Load(%q) = %+v, %v; want the page saved under the decomposed title", composed, p, err)
+	}
+
+	// Путь запроса в форме NFD доходит до обработчика в NFC.
+	h := normalizePathMiddleware(makeHandler(pageResourceHandler))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/view/"+url.PathEscape(decomposed), nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "ель") {
+		t.Errorf("GET /view/ with a decomposed title: status = %d, want 200 with the page", w.Code)
+	}
+}
+
+func TestSaveSizeLimit(t *testing.T) {
+	oldMax := maxPageSize
+	maxPageSize = 1 << 10
+	t.Cleanup(func() { maxPageSize = oldMax })
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"below limit", strings.Repeat("a", 1<<10-1), http.StatusFound},
+		{"at limit", strings.Repeat("a", 1<<10), http.StatusFound},
+		// Каждый символ в форме занимает 6 байт (%D1%8F), а текст - 2.
+		{"at limit, percent-encoded", strings.Repeat("я", 1<<9), http.StatusFound},
+		{"over limit", strings.Repeat("a", 1<<10+1), http.StatusRequestEntityTooLarge},
+		{"far over limit", strings.Repeat("a", 1<<20), http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := testDataDir(t)
+			w := postForm(makeHandler(saveHandler), "/save/Foo", url.Values{"body": {tt.body}, "tags": {"go"}})
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d", w.Code, tt.want)
+			}
+			_, err := os.Stat(filepath.Join(dir, "Foo.txt"))
+			if saved := err == nil; saved != (tt.want == http.StatusFound) {
+				t.Errorf("page file exists = %v after status %d", saved, w.Code)
+			}
+
+			// PUT /api/v1/pages/{title} соблюдает тот же предел.
+			data, _ := json.Marshal(map[string]string{"body": tt.body})
+			w = serve(apiPutPage, http.MethodPut, "/api/v1/pages/Bar", string(data))
+			wantAPI := http.StatusCreated
+			if tt.want != http.StatusFound {
+				wantAPI = tt.want
+			}
+			if w.Code != wantAPI {
+				t.Errorf("PUT status = %d, want %d", w.Code, wantAPI)
+			}
+			_, err = os.Stat(filepath.Join(dir, "Bar.txt"))
+			if saved := err == nil; saved != (wantAPI == http.StatusCreated) {
+				t.Errorf("page file exists = %v after PUT status %d", saved, w.Code)
+			}
+		})
+	}
+}
+
+// Изменяющие обработчики принимают только POST: ссылка или
+// предзагрузка браузера не должны создавать и удалять страницы.
+func TestMutatingHandlersRequirePost(t *testing.T) {
+	handlers := map[string]func(http.ResponseWriter, *http.Request, string){
+		"save":   saveHandler,
+		"delete": deleteHandler,
+		"rename": renameHandler,
+	}
+	for name, fn := range handlers {
+		for _, method := range []string{http.MethodGet, http.MethodHead, http.MethodPut} {
+			t.Run(name+" "+method, func(t *testing.T) {
+				testDataDir(t)
+				savePage(t, "Foo", "old")
+				target := "/" + name + "/Foo?body=new&newtitle=Bar"
+				w := httptest.NewRecorder()
+				makeHandler(fn)(w, httptest.NewRequest(method, target, nil))
+				if w.Code != http.StatusMethodNotAllowed {
+					t.Fatalf("status = %d, want 405", w.Code)
+				}
+				if allow := w.Header().Get("Allow"); allow != "POST" {
+					t.Errorf("Allow = %q, want POST", allow)
+				}
+				if p, err := store.Load("Foo"); err != nil || string(p.Body) != "old" {
+					t.Errorf("page after %s = %v, %v; want it untouched", method, p, err)
+				}
+			})
+		}
+	}
+}
+
+// HTML-ответы объявляют кодировку явно, иначе браузер может
+// исказить кириллицу, угадывая ее по началу ответа.
+func TestContentTypes(t *testing.T) {
+	testDataDir(t)
+	savePage(t, "Главная", "привет")
+	const html = "text/html; charset=utf-8"
+	tests := []struct {
+		name   string
+		h      http.HandlerFunc
+		target string
+		want   string
+	}{
+		{"index", handler, "/", html},
+		{"view", makeHandler(pageResourceHandler), "/view/Главная", html},
+		{"edit", makeHandler(editHandler), "/edit/Главная", html},
+		{"raw", makeHandler(rawHandler), "/raw/Главная", "text/plain; charset=utf-8"},
+		{"tags", tagsHandler, "/tags", html},
+		{"recent", recentHandler, "/recent", html},
+		{"popular", popularHandler, "/popular", html},
+		{"history", historyHandler, "/history/Главная", html},
+		{"not found", handler, "/nonexistent", html},
+		{"bad title", makeHandler(editHandler), "/edit/a:b", html},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			tt.h(w, httptest.NewRequest(http.MethodGet, tt.target, nil))
+			if ct := w.Header().Get("Content-Type"); ct != tt.want {
+				t.Errorf("GET %s: Content-Type = %q, want %q (status %d)", tt.target, ct, tt.want, w.Code)
+			}
+		})
+	}
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	tests := []struct {
+		name string
+		// file - имя файла в каталоге теста; имя длиной в предел
+		// файловой системы не дает создать рядом временный файл.
+		file    string
+		wantErr bool
+	}{
+		{"write", "Foo.txt", false},
+		{"temporary file cannot be created", strings.Repeat("x", 251) + ".txt", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			filename := filepath.Join(dir, tt.file)
+			if err := ioutil.WriteFile(filename, []byte("original"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			err := writeFileAtomic(filename, []byte("replacement"), 0600)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, want error %v", err, tt.wantErr)
+			}
+			want, wantMode := "replacement", os.FileMode(0600)
+			if tt.wantErr {
+				want, wantMode = "original", 0644
+			}
+			data, err := ioutil.ReadFile(filename)
+			if err != nil || string(data) != want {
+				t.Errorf("file = %q, %v; want %q", data, err, want)
+			}
+			if info, err := os.Stat(filename); err != nil || info.Mode().Perm() != wantMode {
+				t.Errorf("file mode = %v, %v; want %v", info.Mode().Perm(), err, wantMode)
+			}
+			if files, _ := ioutil.ReadDir(dir); len(files) != 1 {
+				t.Errorf("%d files in the directory, want only the page: temporary file left behind", len(files))
+			}
+		})
+	}
+
+	// Если переименовать не удалось, временный файл тоже удаляется.
+	dir := t.TempDir()
+	target := filepath.Join(dir, "Foo.txt")
+	if err := os.MkdirAll(filepath.Join(target, "sub"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeFileAtomic(target, []byte("x"), 0600); err == nil {
+		t.Error("write over a non-empty directory succeeded")
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 1 {
+		t.Errorf("%d files in the directory after a failed rename, want 1", len(files))
+	}
+}
+
+// /view/ отдает JSON клиенту с Accept: application/json и HTML
+// всем остальным.
+func TestViewContentNegotiation(t *testing.T) {
+	testDataDir(t)
+	savePage(t, "Foo", "hello")
+	tests := []struct {
+		name, accept, wantType string
+	}{
+		{"no Accept", "", "text/html"},
+		{"browser", "text/html,application/xhtml+xml", "text/html"},
+		{"json", "application/json", "application/json"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/view/Foo", nil)
+			if tt.accept != "" {
+				r.Header.Set("Accept", tt.accept)
+			}
+			w := httptest.NewRecorder()
+			makeHandler(pageResourceHandler)(w, r)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200", w.Code)
+			}
+			if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, tt.wantType) {
+				t.Errorf("Content-Type = %q, want %s", ct, tt.wantType)
+			}
+			if tt.wantType == "text/html" {
+				if !strings.Contains(w.Body.String(), "<h1>Foo</h1>") {
+					t.Errorf("body is not an HTML page:\n%s", w.Body)
+				}
+				return
+			}
+			var p struct{ Title, Body string }
+			if err := json.NewDecoder(w.Body).Decode(&p); err != nil {
+				t.Fatal(err)
+			}
+			if p.Title != "Foo" || p.Body != "hello" {
+				t.Errorf("JSON page = %+v, want title Foo and body hello", p)
+			}
+		})
+	}
+}
+
+// Пустой текст без ?allowempty=1 страницу не затирает, а возвращает
+// форму с ошибкой.
+func TestSaveEmptyBody(t *testing.T) {
+	tests := []struct {
+		name, target, body string
+		want               int
+		wantBody           string
+	}{
+		{"empty", "/save/Foo", "", http.StatusOK, "old"},
+		{"whitespace", "/save/Foo", " \r\n\t", http.StatusOK, "old"},
+		{"confirmed", "/save/Foo?allowempty=1", "", http.StatusFound, ""},
+		{"text", "/save/Foo", "new", http.StatusFound, "new"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testDataDir(t)
+			savePage(t, "Foo", "old")
+			w := postForm(makeHandler(saveHandler), tt.target, url.Values{"body": {tt.body}})
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d", w.Code, tt.want)
+			}
+			if tt.want == http.StatusOK {
+				for _, want := range []string{`class="error"`, `action="/save/Foo?allowempty=1"`} {
+					if !strings.Contains(w.Body.String(), want) {
+						t.Errorf("edit form has no %s:\n%s", want, w.Body)
+					}
+				}
+			}
+			if p, err := store.Load("Foo"); err != nil || string(p.Body) != tt.wantBody {
+				t.Errorf("page = %v, %v; want body %q", p, err, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestWithQuery(t *testing.T) {
+	tests := []struct {
+		target, path, want string
+	}{
+		{"/save/Foo", "/view/Foo", "/view/Foo"},
+		{"/save/Foo?theme=dark", "/view/Foo", "/view/Foo?theme=dark"},
+		{"/save/Foo?theme=dark&lang=ru", "/view/Foo", "/view/Foo?lang=ru&theme=dark"},
+		{"/save/Foo?theme=dark", "/view/Foo?x=1", "/view/Foo?x=1&theme=dark"},
+		{"/save/Foo?allowempty=1", "/view/Foo", "/view/Foo"},
+		{"/save/Foo?allowempty=1&theme=dark", "/view/Foo", "/view/Foo?theme=dark"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodPost, tt.target, nil)
+		if got := withQuery(r, tt.path); got != tt.want {
+			t.Errorf("withQuery(%s, %s) = %s, want %s", tt.target, tt.path, got, tt.want)
+		}
+	}
+}
+
+// Параметры запроса переживают переход после сохранения и переход
+// к форме для несуществующей страницы.
+func TestRedirectsPreserveQuery(t *testing.T) {
+	testDataDir(t)
+	w := postForm(makeHandler(saveHandler), "/save/Foo?theme=dark", url.Values{"body": {"text"}})
+	if loc := w.Header().Get("Location"); w.Code != http.StatusFound || loc != "/view/Foo?theme=dark" {
+		t.Errorf("save: %d to %q, want 302 to /view/Foo?theme=dark", w.Code, loc)
+	}
+	w = serve(makeHandler(pageResourceHandler), http.MethodGet, "/view/Missing?theme=dark", "")
+	if loc := w.Header().Get("Location"); w.Code != http.StatusFound || loc != "/edit/Missing?theme=dark" {
+		t.Errorf("view of a missing page: %d to %q, want 302 to /edit/Missing?theme=dark", w.Code, loc)
+	}
+}
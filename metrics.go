@@ -0,0 +1,119 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "Число обработанных HTTP-запросов.",
+	}, []string{"method", "path", "status"})
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "Время обработки HTTP-запросов.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "path"})
+	pageLoads = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "page_loads_total",
+		Help: "Число чтений страниц из хранилища.",
+	})
+	pageSaves = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "page_saves_total",
+		Help: "Число сохранений страниц.",
+	})
+	pageLoadErrors = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "page_load_errors_total",
+		Help: "Число неудачных чтений страниц (кроме отсутствующих страниц).",
+	})
+)
+
+// routeLabel сводит путь запроса к маршруту, например "/view/Foo"
+// к "/view/", чтобы число рядов метрик не росло с числом страниц.
+func routeLabel(path string) string {
+	if i := strings.IndexByte(path[1:], '/'); i >= 0 {
+		return path[:i+2]
+	}
+	return path
+}
+
+// metricsMiddleware считает запросы и время их обработки.
+func metricsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		route := routeLabel(r.URL.Path)
+		httpRequests.WithLabelValues(r.Method, route, strconv.Itoa(rec.status)).Inc()
+		httpDuration.WithLabelValues(r.Method, route).Observe(time.Since(start).Seconds())
+	})
+}
+
+// MetricStorage считает чтения и сохранения страниц в обернутом Storage.
+type MetricStorage struct {
+	Storage
+}
+
+func (s MetricStorage) Load(title string) (*Page, error) {
+	pageLoads.Inc()
+	p, err := s.Storage.Load(title)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		pageLoadErrors.Inc()
+	}
+	return p, err
+}
+
+func (s MetricStorage) Save(p *Page) error {
+	err := s.Storage.Save(p)
+	if err == nil {
+		pageSaves.Inc()
+	}
+	return err
+}
+
+// ipAllowlistMiddleware пропускает только запросы с адресов из allowed.
+// Элементы списка - IP-адреса или подсети в записи CIDR.
+func ipAllowlistMiddleware(allowed []string) func(http.Handler) http.Handler {
+	var nets []*net.IPNet
+	for _, a := range allowed {
+		if !strings.Contains(a, "/") {
+			if strings.Contains(a, ":") {
+				a += "/128"
+			} else {
+				a += "/32"
+			}
+		}
+		if _, n, err := net.ParseCIDR(a); err == nil {
+			nets = append(nets, n)
+		}
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			host, _, err := net.SplitHostPort(r.RemoteAddr)
+			if err != nil {
+				host = r.RemoteAddr
+			}
+			if ip := net.ParseIP(host); ip != nil {
+				for _, n := range nets {
+					if n.Contains(ip) {
+						next.ServeHTTP(w, r)
+						return
+					}
+				}
+			}
+			http.Error(w, "Forbidden", http.StatusForbidden)
+		})
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/expfmt"
+	"github.com/prometheus/common/model"
+)
+
+// scrapeMetric возвращает значение ряда series из ответа /metrics
+// или 0, если такого ряда еще нет.
+func scrapeMetric(t *testing.T, series string) float64 {
+	t.Helper()
+	w := httptest.NewRecorder()
+	promhttp.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	sc := bufio.NewScanner(w.Body)
+	for sc.Scan() {
+		if v := strings.TrimPrefix(sc.Text(), series+" "); v != sc.Text() {
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return f
+		}
+	}
+	return 0
+}
+
+func TestMetricsMiddlewareCounts(t *testing.T) {
+	h := metricsMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "Missing") {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	const (
+		ok       = `http_requests_total{method="GET",path="/view/",status="200"}`
+		notFound = `http_requests_total{method="GET",path="/view/",status="404"}`
+		count    = `http_request_duration_seconds_count{method="GET",path="/view/"}`
+	)
+	beforeOK, beforeNotFound, beforeCount := scrapeMetric(t, ok), scrapeMetric(t, notFound), scrapeMetric(t, count)
+
+	for _, path := range []string{"/view/Foo", "/view/Bar", "/view/Missing"} {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	if got := scrapeMetric(t, ok) - beforeOK; got != 2 {
+		t.Errorf("200 responses counted %v times, want 2", got)
+	}
+	if got := scrapeMetric(t, notFound) - beforeNotFound; got != 1 {
+		t.Errorf("404 responses counted %v times, want 1", got)
+	}
+	if got := scrapeMetric(t, count) - beforeCount; got != 3 {
+		t.Errorf("duration histogram observed %v requests, want 3", got)
+	}
+}
+
+func TestRouteLabel(t *testing.T) {
+	for path, want := range map[string]string{
+		"/":               "/",
+		"/view/Foo":       "/view/",
+		"/api/v1/pages/X": "/api/",
+		"/metrics":        "/metrics",
+	} {
+		if got := routeLabel(path); got != want {
+			t.Errorf("routeLabel(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
+
+func TestMetricStorage(t *testing.T) {
+	testDataDir(t)
+	store = MetricStorage{store}
+	loads, saves, loadErrors := testutil.ToFloat64(pageLoads), testutil.ToFloat64(pageSaves), testutil.ToFloat64(pageLoadErrors)
+
+	savePage(t, "Foo", "foo")
+	if err := store.Save(&Page{Title: "bad/title"}); err == nil {
+		t.Fatal("Save accepted an invalid title")
+	}
+	store.Load("Foo")
+	store.Load("Missing")
+	// Каталог на месте файла страницы - ошибка чтения, а не отсутствие.
+	if err := os.Mkdir(filepath.Join(metas.Dir, "Broken.txt"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	store.Load("Broken")
+
+	if got := testutil.ToFloat64(pageSaves) - saves; got != 1 {
+		t.Errorf("page_saves_total grew by %v, want 1 (failed saves are not counted)", got)
+	}
+	if got := testutil.ToFloat64(pageLoads) - loads; got != 3 {
+		t.Errorf("page_loads_total grew by %v, want 3", got)
+	}
+	if got := testutil.ToFloat64(pageLoadErrors) - loadErrors; got != 1 {
+		t.Errorf("page_load_errors_total grew by %v, want 1 (missing pages are not errors)", got)
+	}
+}
+
+// /metrics отдает разбираемый текстовый формат Prometheus и только
+// разрешенным адресам.
+func TestMetricsEndpoint(t *testing.T) {
+	h := ipAllowlistMiddleware([]string{"127.0.0.1", "10.0.0.0/8", "::1"})(promhttp.Handler())
+	metricsMiddleware(http.NotFoundHandler()).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/view/Foo", nil))
+	tests := []struct {
+		remote string
+		want   int
+	}{
+		{"127.0.0.1:1234", http.StatusOK},
+		{"10.1.2.3:1234", http.StatusOK},
+		{"[::1]:1234", http.StatusOK},
+		{"192.0.2.1:1234", http.StatusForbidden},
+		{"[2001:db8::1]:1234", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		r.RemoteAddr = tt.remote
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != tt.want {
+			t.Errorf("GET /metrics from %s: status = %d, want %d", tt.remote, w.Code, tt.want)
+			continue
+		}
+		if w.Code != http.StatusOK {
+			continue
+		}
+		parser := expfmt.NewTextParser(model.UTF8Validation)
+		families, err := parser.TextToMetricFamilies(w.Body)
+		if err != nil {
+			t.Fatalf("/metrics is not in the Prometheus text format: %v", err)
+		}
+		for _, name := range []string{"http_requests_total", "http_request_duration_seconds", "page_loads_total", "page_saves_total", "page_load_errors_total"} {
+			if _, ok := families[name]; !ok {
+				t.Errorf("/metrics has no %s", name)
+			}
+		}
+	}
+}
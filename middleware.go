@@ -0,0 +1,30 @@
+package main
+
+import "net/http"
+
+// Middleware оборачивает обработчик дополнительным слоем.
+type Middleware func(http.Handler) http.Handler
+
+// MiddlewareChain собирает слои в порядке регистрации:
+//
+//	new(MiddlewareChain).Use(a).Use(b).Then(h) // то же, что a(b(h))
+//
+// Первый добавленный слой - внешний и видит запрос первым, h
+// вызывается последним.
+type MiddlewareChain struct {
+	mws []Middleware
+}
+
+// Use добавляет mw внутрь уже добавленных слоев.
+func (c *MiddlewareChain) Use(mw Middleware) *MiddlewareChain {
+	c.mws = append(c.mws, mw)
+	return c
+}
+
+// Then оборачивает h всеми слоями цепочки.
+func (c *MiddlewareChain) Then(h http.Handler) http.Handler {
+	for i := len(c.mws) - 1; i >= 0; i-- {
+		h = c.mws[i](h)
+	}
+	return h
+}
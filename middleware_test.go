@@ -0,0 +1,41 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// Слои вызываются в порядке Use, обработчик - последним, а ответ
+// проходит слои в обратном порядке.
+func TestMiddlewareChainOrder(t *testing.T) {
+	var calls []string
+	layer := func(name string) Middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls = append(calls, name)
+				next.ServeHTTP(w, r)
+				calls = append(calls, "/"+name)
+			})
+		}
+	}
+	h := new(MiddlewareChain).
+		Use(layer("a")).
+		Use(layer("b")).
+		Use(layer("c")).
+		Then(http.HandlerFunc(func(http.ResponseWriter, *http.Request) { calls = append(calls, "handler") }))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	if got, want := strings.Join(calls, " "), "a b c handler /c /b /a"; got != want {
+		t.Errorf("calls = %s, want %s", got, want)
+	}
+}
+
+func TestMiddlewareChainEmpty(t *testing.T) {
+	called := false
+	h := new(MiddlewareChain).Then(http.HandlerFunc(func(http.ResponseWriter, *http.Request) { called = true }))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	if !called {
+		t.Error("handler of an empty chain was not called")
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"embed"
+	"io/fs"
+	"net/http"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+// apiDocs - описание API в формате OpenAPI 3.0 (openapi.json),
+// страница Swagger UI для него и GraphiQL для /graphql. Файлы встроены в бинарный файл, так
+// что описание всегда соответствует версии сервера.
+//
+//go:embed apidocs
+var apiDocs embed.FS
+
+// openapiSpec возвращает описание API.
+func openapiSpec() []byte {
+	data, err := apiDocs.ReadFile("apidocs/openapi.json")
+	if err != nil {
+		// Файл встроен при сборке и не может пропасть.
+		panic(err)
+	}
+	return data
+}
+
+// validateOpenAPI проверяет, что openapi.json - корректный документ
+// OpenAPI 3.0. Ее вызывают при старте, чтобы ошибка в описании
+// не дошла до пользователей.
+func validateOpenAPI() error {
+	doc, err := openapi3.NewLoader().LoadFromData(openapiSpec())
+	if err != nil {
+		return err
+	}
+	return doc.Validate(context.Background())
+}
+
+// openapiHandler отдает описание API: GET /api/v1/openapi.json.
+func openapiHandler(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet, http.MethodHead) {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openapiSpec())
+}
+
+// apiDocsCSP - политика CSP страницы Swagger UI. Swagger UI 5.18.2
+// лежит в apidocs/swagger-ui/ и встроен в бинарный файл, поэтому
+// сторонние адреса не нужны; 'unsafe-inline' для стилей нужен
+// самому Swagger UI.
+const apiDocsCSP = "default-src 'self'; style-src 'self' 'unsafe-inline'; img-src 'self' data:"
+
+// graphiqlCSP - политика CSP страницы GraphiQL. React и GraphiQL
+// загружаются с cdn.jsdelivr.net точных версий и с проверкой
+// integrity, так что подмененный на CDN файл браузер не выполнит.
+const graphiqlCSP = "default-src 'self'; script-src 'self' https://cdn.jsdelivr.net; " +
+	"style-src 'self' 'unsafe-inline' https://cdn.jsdelivr.net; img-src 'self' data:"
+
+// apiDocsHandler показывает Swagger UI по /api/docs/.
+func apiDocsHandler() http.Handler {
+	sub, err := fs.Sub(apiDocs, "apidocs")
+	if err != nil {
+		panic(err)
+	}
+	files := http.StripPrefix("/api/docs/", http.FileServer(http.FS(sub)))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Security-Policy", apiDocsCSP)
+		files.ServeHTTP(w, r)
+	})
+}
+
+// graphiqlHandler показывает GraphiQL для POST /graphql.
+func graphiqlHandler(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet, http.MethodHead) {
+		return
+	}
+	w.Header().Set("Content-Security-Policy", graphiqlCSP)
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	data, err := apiDocs.ReadFile("apidocs/graphiql.html")
+	if err != nil {
+		serverError(w, err)
+		return
+	}
+	w.Write(data)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+// Swagger UI отдается из встроенных файлов, без обращений к CDN.
+func TestAPIDocsServesEmbeddedSwaggerUI(t *testing.T) {
+	h := apiDocsHandler()
+	tests := []struct {
+		path        string
+		contentType string
+	}{
+		{"/api/docs/", "text/html"},
+		{"/api/docs/init.js", "javascript"},
+		{"/api/docs/swagger-ui/swagger-ui-bundle.js", "javascript"},
+		{"/api/docs/swagger-ui/swagger-ui.css", "text/css"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+			}
+			if ct := w.Header().Get("Content-Type"); !strings.Contains(ct, tt.contentType) {
+				t.Errorf("Content-Type = %q, want %s", ct, tt.contentType)
+			}
+			if tt.contentType == "text/html" && strings.Contains(w.Body.String(), "https://") {
+				t.Errorf("Swagger UI page loads external resources:\n%s", w.Body.String())
+			}
+		})
+	}
+}
+
+// Каждый скрипт и стиль GraphiQL с CDN закреплен версией и integrity.
+func TestGraphiQLPinsExternalResources(t *testing.T) {
+	w := serve(graphiqlHandler, http.MethodGet, "/graphiql", "")
+	tags := regexp.MustCompile(`<(?:script|link)[^>]*https://[^>]*>`).FindAllString(w.Body.String(), -1)
+	if len(tags) == 0 {
+		t.Fatal("GraphiQL page has no external resources")
+	}
+	pinned := regexp.MustCompile(`@\d+\.\d+\.\d+/`)
+	for _, tag := range tags {
+		if !pinned.MatchString(tag) || !strings.Contains(tag, `integrity="sha256-`) || !strings.Contains(tag, `crossorigin="anonymous"`) {
+			t.Errorf("resource is not pinned: %s", tag)
+		}
+	}
+}
+
+func TestOpenAPISpec(t *testing.T) {
+	if err := validateOpenAPI(); err != nil {
+		t.Fatalf("openapi.json is not a valid OpenAPI document: %v", err)
+	}
+	doc, err := openapi3.NewLoader().LoadFromData(openapiSpec())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(doc.OpenAPI, "3.0.") {
+		t.Errorf("openapi = %q, want 3.0.x", doc.OpenAPI)
+	}
+
+	// Операции, которые обслуживают маршруты /api/v1/ из main.go
+	// и apiPageHandler.
+	routes := map[string]bool{
+		"GET /api/v1/pages/{title}":                  true,
+		"PUT /api/v1/pages/{title}":                  true,
+		"DELETE /api/v1/pages/{title}":               true,
+		"POST /api/v1/pages/{title}/rename":          true,
+		"POST /api/v1/pages/{title}/clone":           true,
+		"PATCH /api/v1/pages/{title}/visibility":     true,
+		"POST /api/v1/pages/{title}/share":           true,
+		"GET /api/v1/pages/{title}/stats":            true,
+		"GET /api/v1/pages/{title}/comments":         true,
+		"POST /api/v1/pages/{title}/comments":        true,
+		"DELETE /api/v1/pages/{title}/comments/{id}": true,
+		"GET /api/v1/trash":                          true,
+		"POST /api/v1/trash/{title}/restore":         true,
+		"DELETE /api/v1/locks/{title}":               true,
+		"GET /api/v1/cache/stats":                    true,
+		"GET /api/v1/openapi.json":                   true,
+	}
+	documented := make(map[string]bool)
+	for path, item := range doc.Paths.Map() {
+		for method := range item.Operations() {
+			documented[method+" "+path] = true
+		}
+	}
+	for op := range routes {
+		if !documented[op] {
+			t.Errorf("route %s is not described in openapi.json", op)
+		}
+	}
+	for op := range documented {
+		if !routes[op] {
+			t.Errorf("openapi.json describes %s, which the server does not serve", op)
+		}
+	}
+}
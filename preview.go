@@ -0,0 +1,45 @@
+package main
+
+import (
+	"errors"
+	"html/template"
+	"net/http"
+)
+
+// previewHandler показывает, как будет выглядеть текст до сохранения:
+// POST /preview с полем body возвращает HTML-фрагмент, тот же, что
+// /view/ выводит в тело страницы (текст экранируется, ссылки [[Title]]
+// становятся ссылками, строки с тегами пропускаются). Ничего
+// не сохраняет.
+func previewHandler(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodPost) {
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxFormSize())
+	if err := r.ParseForm(); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, "Page is larger than the allowed size", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "Malformed form: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	// Как и в saveHandler: форму мог прочитать csrfMiddleware
+	// до ограничения тела.
+	body := r.FormValue("body")
+	if int64(len(body)) > maxPageSize {
+		http.Error(w, "Page is larger than the allowed size", http.StatusRequestEntityTooLarge)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write([]byte(previewHTML([]byte(body))))
+}
+
+// previewHTML - HTML-фрагмент текста body в том виде, в каком его
+// покажет /view/.
+func previewHTML(body []byte) template.HTML {
+	_, text := contentTags(body)
+	return renderBody(text, pageExists)
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestPreviewHandler(t *testing.T) {
+	dir := testDataDir(t)
+	savePage(t, "Foo", "foo")
+	before, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := postForm(previewHandler, "/preview", url.Values{"body": {"#go\nSee [[Foo]] and [[Bar]] <script>alert(1)</script>"}})
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+		t.Errorf("Content-Type = %q, want text/html", ct)
+	}
+	got := w.Body.String()
+	for _, want := range []string{
+		`<a class="wikilink" href="/view/Foo">Foo</a>`,
+		`<a class="wikilink wikilink-missing" href="/view/Bar">Bar</a>`,
+		`&lt;script&gt;alert(1)&lt;/script&gt;`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("preview has no %s:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "<script>") || strings.Contains(got, "#go") {
+		t.Errorf("preview contains raw HTML or the tag line:\n%s", got)
+	}
+
+	after, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(after) != len(before) {
+		t.Errorf("preview changed the data directory: %d entries before, %d after", len(before), len(after))
+	}
+	if _, err := store.Load("Bar"); err == nil {
+		t.Error("preview created a page")
+	}
+
+	if w := serve(previewHandler, http.MethodGet, "/preview", ""); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET /preview: status = %d, want 405", w.Code)
+	}
+}
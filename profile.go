@@ -0,0 +1,201 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Profile - данные профиля пользователя, которые он меняет сам
+// на /profile. Хранятся отдельно от users.json, в файле
+// users/{username}.json.
+type Profile struct {
+	DisplayName string    `json:"display_name"`
+	AvatarURL   string    `json:"avatar_url"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// maxDisplayNameLen - наибольшая длина отображаемого имени в символах.
+const maxDisplayNameLen = 50
+
+// ProfileStore читает и пишет профили в каталоге Dir.
+type ProfileStore struct {
+	Dir string
+}
+
+var profiles = &ProfileStore{Dir: "users"}
+
+var errBadUsername = errors.New("username cannot be used as a file name")
+
+func (s *ProfileStore) path(username string) (string, error) {
+	if username == "" || strings.HasPrefix(username, ".") || strings.ContainsAny(username, `/\`) {
+		return "", errBadUsername
+	}
+	return filepath.Join(s.Dir, username+".json"), nil
+}
+
+func (s *ProfileStore) lockKey(username string) string {
+	return "profile/" + username
+}
+
+func (s *ProfileStore) read(username string) (*Profile, error) {
+	path, err := s.path(username)
+	if err != nil {
+		return nil, err
+	}
+	p := &Profile{}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return p, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return p, json.Unmarshal(data, p)
+}
+
+// Load возвращает профиль username. Если профиля еще нет,
+// возвращается пустой профиль без ошибки.
+func (s *ProfileStore) Load(username string) (*Profile, error) {
+	var p *Profile
+	err := withPageRLock(s.lockKey(username), func() error {
+		var err error
+		p, err = s.read(username)
+		return err
+	})
+	return p, err
+}
+
+// Update загружает профиль username, меняет его функцией fn
+// и записывает обратно. Время создания выставляется при первой записи.
+func (s *ProfileStore) Update(username string, fn func(*Profile)) error {
+	return withPageLock(s.lockKey(username), func() error {
+		p, err := s.read(username)
+		if err != nil {
+			return err
+		}
+		fn(p)
+		if p.CreatedAt.IsZero() {
+			p.CreatedAt = time.Now()
+		}
+		data, err := json.Marshal(p)
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(s.Dir, 0750); err != nil {
+			return err
+		}
+		path, _ := s.path(username)
+		return writeFileAtomic(path, data, 0600)
+	})
+}
+
+// Remove удаляет профиль username, если он есть.
+func (s *ProfileStore) Remove(username string) error {
+	return withPageLock(s.lockKey(username), func() error {
+		path, err := s.path(username)
+		if err != nil {
+			return err
+		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	})
+}
+
+// validateAvatarURL проверяет адрес аватара: пустой или абсолютный
+// https:// адрес с именем хоста. Другие схемы (javascript:, data:,
+// http:) не принимаются.
+func validateAvatarURL(s string) error {
+	if s == "" {
+		return nil
+	}
+	u, err := url.Parse(s)
+	if err != nil || u.Scheme != "https" || u.Host == "" || u.User != nil {
+		return errors.New("avatar URL must be an https:// address")
+	}
+	return nil
+}
+
+// profileView - данные шаблона profile.html.
+type profileView struct {
+	Profile
+	Username  string
+	Email     string
+	CSRFToken string
+	Error     string
+	Saved     bool
+}
+
+// profileImgSrc - директива, которую страница профиля добавляет
+// к Content-Security-Policy: аватар загружается с чужого сайта,
+// поэтому изображения разрешены с любого https:// адреса.
+const profileImgSrc = "img-src 'self' https:"
+
+// allowProfileImages добавляет profileImgSrc к политике, которую уже
+// поставил securityHeadersMiddleware, не трогая остальные директивы
+// (в том числе nonce для скриптов).
+func allowProfileImages(h http.Header) {
+	csp := h.Get("Content-Security-Policy")
+	if csp == "" {
+		csp = "default-src 'self'"
+	}
+	h.Set("Content-Security-Policy", csp+"; "+profileImgSrc)
+}
+
+// profileHandler показывает на GET /profile профиль вошедшего
+// пользователя, а на POST меняет display_name и avatar_url. Его ставят
+// внутри protect, который кладет пользователя в контекст.
+func profileHandler(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet, http.MethodPost) {
+		return
+	}
+	u := userFromContext(r.Context())
+	p, err := profiles.Load(u.Username)
+	if err != nil {
+		serverError(w, err)
+		return
+	}
+	// Email есть только у пользователей из users.json, которые
+	// зарегистрировались через /register.
+	v := profileView{Profile: *p, Username: u.Username, Email: u.Email, CSRFToken: csrfToken(r)}
+	allowProfileImages(w.Header())
+	if r.Method == http.MethodGet {
+		v.Saved = r.URL.Query().Get("saved") == "1"
+		renderTemplate(w, "profile", v)
+		return
+	}
+	name := strings.TrimSpace(r.FormValue("display_name"))
+	avatar := strings.TrimSpace(r.FormValue("avatar_url"))
+	v.DisplayName, v.AvatarURL = name, avatar
+	switch {
+	case utf8.RuneCountInString(name) > maxDisplayNameLen:
+		v.Error = "Display name must be at most 50 characters"
+	case validateAvatarURL(avatar) != nil:
+		// Отклоненный адрес не попадает даже в <img> формы.
+		v.Error = "Avatar URL must be an https:// address"
+		v.AvatarURL = ""
+	}
+	if v.Error != "" {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusBadRequest)
+		renderTemplate(w, "profile", v)
+		return
+	}
+	err = profiles.Update(u.Username, func(p *Profile) {
+		p.DisplayName, p.AvatarURL = name, avatar
+	})
+	if err != nil {
+		serverError(w, err)
+		return
+	}
+	http.Redirect(w, r, "/profile?saved=1", http.StatusFound)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// pushAssets - файлы, которые нужны каждой HTML-странице и которые
+// сервер HTTP/2 отправляет клиенту вместе с первой из них.
+var pushAssets = []string{"/static/style.css"}
+
+// pushedAssets - что уже отправлено по одному соединению: повторно
+// браузер возьмет файл из своего кэша push.
+type pushedAssets struct {
+	mu   sync.Mutex
+	done map[string]bool
+}
+
+// first отмечает target отправленным и сообщает, не был ли он
+// отправлен раньше.
+func (p *pushedAssets) first(target string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.done[target] {
+		return false
+	}
+	p.done[target] = true
+	return true
+}
+
+type pushContextKey struct{}
+
+// pushConnContext - http.Server.ConnContext: заводит для каждого
+// соединения свой список отправленных файлов.
+func pushConnContext(ctx context.Context, _ net.Conn) context.Context {
+	return context.WithValue(ctx, pushContextKey{}, &pushedAssets{done: make(map[string]bool)})
+}
+
+// pushMiddleware отправляет assets через HTTP/2 server push вместе
+// с HTML-страницами, каждый файл - один раз на соединение. Push
+// делается, только если клиент его принимает: соединение HTTP/2 с
+// включенным push (w реализует http.Pusher) и без Accept-Push-Policy:
+// none. Клиенты HTTP/1.x получают страницу как обычно. Middleware
+// должно быть внешним слоем: обертки ResponseWriter не передают
+// http.Pusher дальше.
+func pushMiddleware(assets []string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if pusher, ok := w.(http.Pusher); ok && wantsPush(r) {
+				pushed, _ := r.Context().Value(pushContextKey{}).(*pushedAssets)
+				for _, target := range assets {
+					if pushed != nil && !pushed.first(target) {
+						continue
+					}
+					if err := pusher.Push(target, nil); err != nil {
+						// http.ErrNotSupported - клиент отключил push.
+						if err != http.ErrNotSupported {
+							slog.Debug("server push не удался", "target", target, "err", err)
+						}
+						break
+					}
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// wantsPush сообщает, что r - загрузка HTML-страницы, к которой
+// стоит приложить pushAssets.
+func wantsPush(r *http.Request) bool {
+	if r.Method != http.MethodGet || strings.HasPrefix(r.URL.Path, "/static/") || strings.HasPrefix(r.URL.Path, "/api/") {
+		return false
+	}
+	if strings.EqualFold(strings.TrimSpace(r.Header.Get("Accept-Push-Policy")), "none") {
+		return false
+	}
+	return strings.Contains(r.Header.Get("Accept"), "text/html")
+}
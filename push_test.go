@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+)
+
+// h2Conn - клиент HTTP/2 поверх одного TLS-соединения, который, в
+// отличие от http.Client, принимает server push.
+type h2Conn struct {
+	t      *testing.T
+	framer *http2.Framer
+	stream uint32
+	// Таблицы HPACK общие для всего соединения.
+	buf bytes.Buffer
+	enc *hpack.Encoder
+	dec *hpack.Decoder
+}
+
+func dialH2(t *testing.T, srv *httptest.Server) *h2Conn {
+	t.Helper()
+	conn, err := tls.Dial("tcp", srv.Listener.Addr().String(), &tls.Config{InsecureSkipVerify: true, NextProtos: []string{"h2"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.Write([]byte(http2.ClientPreface)); err != nil {
+		t.Fatal(err)
+	}
+	c := &h2Conn{t: t, framer: http2.NewFramer(conn, conn), stream: 1, dec: hpack.NewDecoder(4096, nil)}
+	c.enc = hpack.NewEncoder(&c.buf)
+	if err := c.framer.WriteSettings(http2.Setting{ID: http2.SettingEnablePush, Val: 1}); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// get запрашивает path с заголовками header и возвращает пути файлов
+// из полученных PUSH_PROMISE.
+func (c *h2Conn) get(path string, header map[string]string) []string {
+	c.t.Helper()
+	c.buf.Reset()
+	fields := []hpack.HeaderField{
+		{Name: ":method", Value: "GET"},
+		{Name: ":scheme", Value: "https"},
+		{Name: ":authority", Value: "example.com"},
+		{Name: ":path", Value: path},
+	}
+	for k, v := range header {
+		fields = append(fields, hpack.HeaderField{Name: k, Value: v})
+	}
+	for _, f := range fields {
+		c.enc.WriteField(f)
+	}
+	stream := c.stream
+	c.stream += 2
+	if err := c.framer.WriteHeaders(http2.HeadersFrameParam{StreamID: stream, BlockFragment: c.buf.Bytes(), EndStream: true, EndHeaders: true}); err != nil {
+		c.t.Fatal(err)
+	}
+	var pushed []string
+	for {
+		f, err := c.framer.ReadFrame()
+		if err != nil {
+			c.t.Fatal(err)
+		}
+		switch f := f.(type) {
+		case *http2.SettingsFrame:
+			if !f.IsAck() {
+				c.framer.WriteSettingsAck()
+			}
+		case *http2.PushPromiseFrame:
+			fields, err := c.dec.DecodeFull(f.HeaderBlockFragment())
+			if err != nil {
+				c.t.Fatal(err)
+			}
+			for _, hf := range fields {
+				if hf.Name == ":path" {
+					pushed = append(pushed, hf.Value)
+				}
+			}
+		case *http2.HeadersFrame:
+			if _, err := c.dec.DecodeFull(f.HeaderBlockFragment()); err != nil {
+				c.t.Fatal(err)
+			}
+			if f.StreamID == stream && f.StreamEnded() {
+				return pushed
+			}
+		case *http2.DataFrame:
+			if f.StreamID == stream && f.StreamEnded() {
+				return pushed
+			}
+		}
+	}
+}
+
+func TestPushMiddleware(t *testing.T) {
+	h := pushMiddleware([]string{"/static/style.css"})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	srv := httptest.NewUnstartedServer(h)
+	srv.EnableHTTP2 = true
+	srv.Config.ConnContext = pushConnContext
+	srv.StartTLS()
+	defer srv.Close()
+
+	html := map[string]string{"accept": "text/html"}
+	tests := []struct {
+		name   string
+		path   string
+		header map[string]string
+		want   int // число push на запрос
+	}{
+		{"first page", "/view/Foo", html, 1},
+		{"second page on the same connection", "/view/Bar", html, 0},
+	}
+	c := dialH2(t, srv)
+	for _, tt := range tests {
+		if got := c.get(tt.path, tt.header); len(got) != tt.want || (tt.want == 1 && got[0] != "/static/style.css") {
+			t.Errorf("%s: pushed %v, want %d push of /static/style.css", tt.name, got, tt.want)
+		}
+	}
+
+	// Новое соединение получает файл снова, а запросы не за HTML
+	// и с Accept-Push-Policy: none - нет.
+	tests = []struct {
+		name   string
+		path   string
+		header map[string]string
+		want   int
+	}{
+		{"JSON", "/view/Foo", map[string]string{"accept": "application/json"}, 0},
+		{"push declined", "/view/Foo", map[string]string{"accept": "text/html", "accept-push-policy": "none"}, 0},
+		{"static file", "/static/style.css", html, 0},
+		{"page on a new connection", "/view/Foo", html, 1},
+	}
+	c = dialH2(t, srv)
+	for _, tt := range tests {
+		if got := c.get(tt.path, tt.header); len(got) != tt.want {
+			t.Errorf("%s: pushed %v, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+// Клиенты HTTP/1.x получают страницу без push.
+func TestPushMiddlewareHTTP1(t *testing.T) {
+	h := pushMiddleware(pushAssets)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	r := httptest.NewRequest(http.MethodGet, "/view/Foo", nil)
+	r.Header.Set("Accept", "text/html")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusOK || w.Body.String() != "ok" {
+		t.Errorf("response = %d %q, want 200 ok", w.Code, w.Body)
+	}
+}
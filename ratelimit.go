@@ -0,0 +1,103 @@
+package main
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// limiterIdleTTL - через сколько времени без запросов ограничитель
+// IP-адреса удаляется из памяти.
+const limiterIdleTTL = 10 * time.Minute
+
+// ipLimiter - ограничитель одного IP-адреса и время последнего запроса
+// с него в Unix-наносекундах.
+type ipLimiter struct {
+	limiter  *rate.Limiter
+	lastSeen int64
+	mu       sync.Mutex
+}
+
+// trustForwardedFor включает разбор X-Forwarded-For (флаг -trustproxy).
+// Включать его стоит только за обратным прокси: иначе клиент может
+// подставить в заголовок любой адрес и обойти ограничение.
+var trustForwardedFor bool
+
+// clientIP возвращает IP-адрес клиента. Если включен trustForwardedFor,
+// берется последний адрес из X-Forwarded-For - тот, который дописал
+// наш прокси; адреса левее него мог подставить сам клиент.
+func clientIP(r *http.Request) string {
+	if trustForwardedFor {
+		if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
+			parts := strings.Split(xff, ",")
+			if ip := strings.TrimSpace(parts[len(parts)-1]); net.ParseIP(ip) != nil {
+				return ip
+			}
+		}
+	}
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return ip
+}
+
+// rateLimitMiddleware ограничивает частоту запросов с каждого IP-адреса:
+// в среднем rps запросов в секунду и не больше burst подряд. Лишние
+// запросы получают 429 Too Many Requests с заголовком Retry-After.
+func rateLimitMiddleware(rps int, burst int) func(http.Handler) http.Handler {
+	var limiters sync.Map // IP-адрес -> *ipLimiter
+
+	// Фоновая горутина раз в минуту удаляет ограничители адресов,
+	// которые не появлялись дольше limiterIdleTTL.
+	go func() {
+		for now := range time.Tick(time.Minute) {
+			limiters.Range(func(key, value interface{}) bool {
+				l := value.(*ipLimiter)
+				l.mu.Lock()
+				idle := now.Sub(time.Unix(0, l.lastSeen)) > limiterIdleTTL
+				l.mu.Unlock()
+				if idle {
+					limiters.Delete(key)
+				}
+				return true
+			})
+		}
+	}()
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ip := clientIP(r)
+			v, ok := limiters.Load(ip)
+			if !ok {
+				v, _ = limiters.LoadOrStore(ip, &ipLimiter{
+					limiter: rate.NewLimiter(rate.Limit(rps), burst),
+				})
+			}
+			l := v.(*ipLimiter)
+			now := time.Now()
+			l.mu.Lock()
+			l.lastSeen = now.UnixNano()
+			l.mu.Unlock()
+
+			res := l.limiter.ReserveN(now, 1)
+			if delay := res.DelayFrom(now); !res.OK() || delay > 0 {
+				res.CancelAt(now)
+				retry := int(math.Ceil(delay.Seconds()))
+				if retry < 1 {
+					retry = 1
+				}
+				w.Header().Set("Retry-After", strconv.Itoa(retry))
+				http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
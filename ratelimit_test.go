@@ -0,0 +1,102 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// fire выполняет запрос к h с адреса ip и возвращает ответ.
+func fire(h http.Handler, ip string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = ip + ":1234"
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+var okHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+// Подряд проходит burst запросов, следующий получает 429, а у другого
+// адреса своя корзина.
+func TestRateLimitBurst(t *testing.T) {
+	h := rateLimitMiddleware(1, 3)(okHandler)
+	for i := 1; i <= 3; i++ {
+		if w := fire(h, "192.0.2.1"); w.Code != http.StatusOK {
+			t.Fatalf("request %d within the burst: status = %d", i, w.Code)
+		}
+	}
+	for i := 0; i < 5; i++ {
+		w := fire(h, "192.0.2.1")
+		if w.Code != http.StatusTooManyRequests {
+			t.Fatalf("request after the burst: status = %d, want 429", w.Code)
+		}
+		if ra := w.Header().Get("Retry-After"); ra != "1" {
+			t.Errorf("Retry-After = %q, want 1", ra)
+		}
+	}
+	for i := 1; i <= 3; i++ {
+		if w := fire(h, "192.0.2.2"); w.Code != http.StatusOK {
+			t.Errorf("request %d from another address: status = %d, want 200", i, w.Code)
+		}
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		name, remote, xff string
+		trust             bool
+		want              string
+	}{
+		{"remote address", "192.0.2.1:1234", "", false, "192.0.2.1"},
+		{"forwarded header ignored by default", "192.0.2.1:1234", "198.51.100.7", false, "192.0.2.1"},
+		{"trusted proxy", "10.0.0.1:1234", "198.51.100.7", true, "198.51.100.7"},
+		{"last hop wins over a spoofed one", "10.0.0.1:1234", "203.0.113.9, 198.51.100.7", true, "198.51.100.7"},
+		{"malformed header", "10.0.0.1:1234", "not-an-ip", true, "10.0.0.1"},
+		{"ipv6", "[2001:db8::1]:1234", "", false, "2001:db8::1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			old := trustForwardedFor
+			trustForwardedFor = tt.trust
+			defer func() { trustForwardedFor = old }()
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.remote
+			if tt.xff != "" {
+				r.Header.Set("X-Forwarded-For", tt.xff)
+			}
+			if got := clientIP(r); got != tt.want {
+				t.Errorf("clientIP = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// За прокси клиенты различаются по X-Forwarded-For: быстрые запросы
+// одного клиента упираются в 429, другой клиент того же прокси - нет.
+func TestRateLimitBehindProxy(t *testing.T) {
+	old := trustForwardedFor
+	trustForwardedFor = true
+	defer func() { trustForwardedFor = old }()
+	h := rateLimitMiddleware(1, 5)(okHandler)
+	send := func(client string) int {
+		r := httptest.NewRequest(http.MethodPost, "/save/Foo", nil)
+		r.RemoteAddr = "10.0.0.1:1234"
+		r.Header.Set("X-Forwarded-For", client)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w.Code
+	}
+	limited := 0
+	for i := 0; i < 20; i++ {
+		if send("198.51.100.7") == http.StatusTooManyRequests {
+			limited++
+		}
+	}
+	if limited != 15 {
+		t.Errorf("%d of 20 rapid requests got 429, want 15", limited)
+	}
+	if code := send("198.51.100.8"); code != http.StatusOK {
+		t.Errorf("another client behind the proxy: status = %d, want 200", code)
+	}
+}
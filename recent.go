@@ -0,0 +1,77 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// maxRecentLimit ограничивает параметр limit в /recent.
+const maxRecentLimit = 100
+
+// recentSnippetLen - длина отрывка текста страницы в /recent.
+const recentSnippetLen = 100
+
+// recentPage - строка списка /recent.
+type recentPage struct {
+	Title    string    `json:"title"`
+	Slug     string    `json:"slug,omitempty"`
+	Modified time.Time `json:"modified"`
+	Snippet  string    `json:"snippet"`
+}
+
+// negotiateContentType выбирает представление ответа по заголовку
+// Accept: "json", если в нем есть application/json и нет text/html,
+// иначе - "html" (в том числе без заголовка, как у браузера по ссылке).
+func negotiateContentType(accept string) string {
+	if strings.Contains(accept, "application/json") && !strings.Contains(accept, "text/html") {
+		return "json"
+	}
+	return "html"
+}
+
+// wantsJSON сообщает, что клиент просит JSON, а не HTML.
+func wantsJSON(r *http.Request) bool {
+	return negotiateContentType(r.Header.Get("Accept")) == "json"
+}
+
+// recentHandler показывает последние измененные страницы:
+// GET /recent?limit=10 (не больше maxRecentLimit). Браузер получает
+// HTML, а клиент с Accept: application/json - JSON-массив.
+func recentHandler(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet, http.MethodHead) {
+		return
+	}
+	limit := queryInt(r, "limit", 10)
+	if limit < 1 {
+		limit = 1
+	}
+	if limit > maxRecentLimit {
+		limit = maxRecentLimit
+	}
+	pages, err := recentPages(r, limit)
+	if err != nil {
+		errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	list := make([]recentPage, 0, len(pages))
+	for _, p := range pages {
+		slug, err := slugs.Get(p.Title)
+		if err != nil {
+			errorHandler(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+		list = append(list, recentPage{
+			Title:    p.Title,
+			Slug:     slug,
+			Modified: p.Modified.UTC().Truncate(time.Second),
+			Snippet:  pageSummary(p, recentSnippetLen),
+		})
+	}
+	w.Header().Add("Vary", "Accept")
+	if wantsJSON(r) {
+		writeJSON(w, http.StatusOK, list)
+		return
+	}
+	renderTemplate(w, "recent", struct{ Pages []recentPage }{list})
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNegotiateContentType(t *testing.T) {
+	tests := []struct {
+		accept, want string
+	}{
+		{"", "html"},
+		{"text/html", "html"},
+		{"application/json", "json"},
+		{"application/json; charset=utf-8", "json"},
+		{"text/html,application/xhtml+xml,application/json;q=0.9", "html"},
+		{"*/*", "html"},
+	}
+	for _, tt := range tests {
+		if got := negotiateContentType(tt.accept); got != tt.want {
+			t.Errorf("negotiateContentType(%q) = %q, want %q", tt.accept, got, tt.want)
+		}
+	}
+}
+
+// getRecent запрашивает target у recentHandler с заголовком Accept.
+func getRecent(target, accept string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, target, nil)
+	if accept != "" {
+		r.Header.Set("Accept", accept)
+	}
+	w := httptest.NewRecorder()
+	recentHandler(w, r)
+	return w
+}
+
+func TestRecentHandler(t *testing.T) {
+	dir := testDataDir(t)
+	// Страницы сохраняются в одном порядке, а время изменения
+	// им выставляется в другом: Middle новее Old, New новее обеих.
+	base := time.Now().Add(-time.Hour)
+	for title, age := range map[string]time.Duration{"New": 0, "Old": 2 * time.Minute, "Middle": time.Minute} {
+		savePage(t, title, "#tag\n"+title+" "+strings.Repeat("я", 150))
+		mod := base.Add(-age)
+		if err := os.Chtimes(filepath.Join(dir, title+".txt"), mod, mod); err != nil {
+			t.Fatal(err)
+		}
+	}
+	savePage(t, "Secret", "hidden")
+	if err := metas.Update("Secret", func(m *PageMeta) { m.Public = false }); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(filepath.Join(dir, "Secret.txt"), time.Now(), time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	w := getRecent("/recent?limit=10", "application/json")
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Fatalf("Content-Type = %q, want application/json", ct)
+	}
+	var list []recentPage
+	if err := json.NewDecoder(w.Body).Decode(&list); err != nil {
+		t.Fatal(err)
+	}
+	var titles []string
+	for _, p := range list {
+		titles = append(titles, p.Title)
+	}
+	if got := strings.Join(titles, ","); got != "New,Middle,Old" {
+		t.Fatalf("order = %s, want New,Middle,Old without private pages", got)
+	}
+	if got, want := list[0].Modified, base.UTC().Truncate(time.Second); !got.Equal(want) {
+		t.Errorf("modified = %v, want %v", got, want)
+	}
+	if n := len([]rune(list[0].Snippet)); n != recentSnippetLen+1 || strings.Contains(list[0].Snippet, "#tag") {
+		t.Errorf("snippet = %q (%d characters), want %d characters and an ellipsis without tags", list[0].Snippet, n, recentSnippetLen)
+	}
+
+	if err := json.NewDecoder(getRecent("/recent?limit=2", "application/json").Body).Decode(&list); err != nil || len(list) != 2 {
+		t.Errorf("limit=2 returned %d pages, %v", len(list), err)
+	}
+
+	w = getRecent("/recent", "text/html")
+	body := w.Body.String()
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+		t.Errorf("Content-Type = %q, want text/html", ct)
+	}
+	iNew, iMiddle, iOld := strings.Index(body, `href="/view/New"`), strings.Index(body, `href="/view/Middle"`), strings.Index(body, `href="/view/Old"`)
+	if iNew < 0 || !(iNew < iMiddle && iMiddle < iOld) {
+		t.Errorf("HTML list is not ordered New, Middle, Old:\n%s", body)
+	}
+	if !strings.Contains(w.Header().Get("Vary"), "Accept") {
+		t.Errorf("Vary = %q, want Accept", w.Header().Get("Vary"))
+	}
+}
+
+func TestRecentLimitCap(t *testing.T) {
+	testDataDir(t)
+	for i := 0; i < maxRecentLimit+5; i++ {
+		savePage(t, fmt.Sprintf("Page%d", i), "text")
+	}
+	var list []recentPage
+	if err := json.NewDecoder(getRecent("/recent?limit=1000", "application/json").Body).Decode(&list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != maxRecentLimit {
+		t.Errorf("limit=1000 returned %d pages, want %d", len(list), maxRecentLimit)
+	}
+}
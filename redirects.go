@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sync"
+)
+
+// RedirectStore хранит в JSON-файле Path соответствие старых
+// заголовков переименованных страниц новым. Цепочек не бывает:
+// каждая запись сразу указывает на текущий заголовок.
+type RedirectStore struct {
+	Path string
+	mu   sync.Mutex
+}
+
+var redirects = &RedirectStore{Path: "redirects.json"}
+
+func (s *RedirectStore) load() (map[string]string, error) {
+	m := make(map[string]string)
+	data, err := ioutil.ReadFile(s.Path)
+	if os.IsNotExist(err) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return m, json.Unmarshal(data, &m)
+}
+
+// Lookup возвращает новый заголовок для старого title.
+func (s *RedirectStore) Lookup(title string) (string, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m, err := s.load()
+	if err != nil {
+		return "", false, err
+	}
+	to, ok := m[title]
+	return to, ok, nil
+}
+
+// Add записывает переименование from -> to. Записи, которые вели
+// на from, перенаправляются сразу на to, а запись для самого to
+// удаляется: под этим заголовком теперь настоящая страница.
+func (s *RedirectStore) Add(from, to string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m, err := s.load()
+	if err != nil {
+		return err
+	}
+	for old, target := range m {
+		if target == from {
+			m[old] = to
+		}
+	}
+	m[from] = to
+	delete(m, to)
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.Path, data, 0600)
+}
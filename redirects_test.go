@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAPIRenamePage(t *testing.T) {
+	tests := []struct {
+		name       string
+		renames    [][2]string // переименования до проверки
+		wantStatus []int
+		wantMap    map[string]string // содержимое redirects.json
+		wantFiles  []string          // файлы страниц после переименований
+	}{
+		{
+			name:       "single rename",
+			renames:    [][2]string{{"A", "B"}},
+			wantStatus: []int{http.StatusOK},
+			wantMap:    map[string]string{"A": "B"},
+			wantFiles:  []string{"B.txt"},
+		},
+		{
+			name:       "chained rename points old titles at the newest",
+			renames:    [][2]string{{"A", "B"}, {"B", "C"}},
+			wantStatus: []int{http.StatusOK, http.StatusOK},
+			wantMap:    map[string]string{"A": "C", "B": "C"},
+			wantFiles:  []string{"C.txt"},
+		},
+		{
+			name:       "renaming back drops the redirect of the live title",
+			renames:    [][2]string{{"A", "B"}, {"B", "A"}},
+			wantStatus: []int{http.StatusOK, http.StatusOK},
+			wantMap:    map[string]string{"B": "A"},
+			wantFiles:  []string{"A.txt"},
+		},
+		{
+			name:       "existing title conflicts",
+			renames:    [][2]string{{"A", "Taken"}},
+			wantStatus: []int{http.StatusConflict},
+			wantMap:    map[string]string{},
+			wantFiles:  []string{"A.txt", "Taken.txt"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := testDataDir(t)
+			savePage(t, "A", "text")
+			if tt.wantStatus[0] == http.StatusConflict {
+				savePage(t, "Taken", "other")
+			}
+			for i, rn := range tt.renames {
+				w := serve(apiRenamePage, http.MethodPost, "/api/v1/pages/"+rn[0]+"/rename", `{"new_title":"`+rn[1]+`"}`)
+				if w.Code != tt.wantStatus[i] {
+					t.Fatalf("rename %s -> %s: status = %d, want %d", rn[0], rn[1], w.Code, tt.wantStatus[i])
+				}
+			}
+			got := map[string]string{}
+			if data, err := ioutil.ReadFile(filepath.Join(dir, "redirects.json")); err == nil {
+				if err := json.Unmarshal(data, &got); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if len(got) != len(tt.wantMap) {
+				t.Errorf("redirects = %v, want %v", got, tt.wantMap)
+			}
+			for from, to := range tt.wantMap {
+				if got[from] != to {
+					t.Errorf("redirects[%s] = %q, want %q", from, got[from], to)
+				}
+			}
+			for _, f := range tt.wantFiles {
+				if _, err := os.Stat(filepath.Join(dir, f)); err != nil {
+					t.Errorf("page file %s: %v", f, err)
+				}
+			}
+		})
+	}
+}
+
+// Старый адрес отвечает 301 сразу на последний заголовок.
+func TestViewRedirectsRenamedPage(t *testing.T) {
+	testDataDir(t)
+	savePage(t, "A", "text")
+	for _, rn := range [][2]string{{"A", "B"}, {"B", "C"}} {
+		if err := renamePage(rn[0], rn[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, old := range []string{"A", "B"} {
+		r := httptest.NewRequest(http.MethodGet, "/view/"+old, nil)
+		w := httptest.NewRecorder()
+		makeHandler(pageResourceHandler)(w, r)
+		if w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != "/view/C" {
+			t.Errorf("GET /view/%s: %d %q, want 301 to /view/C", old, w.Code, w.Header().Get("Location"))
+		}
+	}
+}
+
+func TestRenameHandler(t *testing.T) {
+	tests := []struct {
+		name     string
+		newTitle string
+		want     int
+	}{
+		{"success", "B", http.StatusFound},
+		{"existing title", "Taken", http.StatusConflict},
+		{"same title", "A", http.StatusConflict},
+		{"invalid title", "../B", http.StatusBadRequest},
+		{"empty title", "", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testDataDir(t)
+			savePage(t, "A", "first")
+			savePage(t, "A", "second") // первая версия уходит в историю
+			savePage(t, "Taken", "other")
+			if _, err := comments.Add("A", "bob", "nice page"); err != nil {
+				t.Fatal(err)
+			}
+			// История и комментарии удаленной страницы B не должны
+			// достаться странице, переименованной в B.
+			savePage(t, "B", "deleted")
+			savePage(t, "B", "deleted again")
+			if _, err := comments.Add("B", "eve", "old comment"); err != nil {
+				t.Fatal(err)
+			}
+			if err := store.Delete("B"); err != nil {
+				t.Fatal(err)
+			}
+
+			form := url.Values{"newtitle": {tt.newTitle}}
+			r := httptest.NewRequest(http.MethodPost, "/rename/A", strings.NewReader(form.Encode()))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			w := httptest.NewRecorder()
+			makeHandler(renameHandler)(w, r)
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d", w.Code, tt.want)
+			}
+			if tt.want != http.StatusFound {
+				if p, err := store.Load("A"); err != nil || string(p.Body) != "second" {
+					t.Errorf("page A after a failed rename = %v, %v", p, err)
+				}
+				return
+			}
+			if loc := w.Header().Get("Location"); loc != "/view/B" {
+				t.Errorf("Location = %q, want /view/B", loc)
+			}
+			if list, err := comments.List("B"); err != nil || len(list) != 1 || list[0].Body != "nice page" {
+				t.Errorf("comments of B = %v, %v; want the comment moved from A", list, err)
+			}
+			if list, err := versions.List("B"); err != nil || len(list) != 1 || string(list[0].Body) != "first" {
+				t.Errorf("history of B = %v, %v; want the history moved from A", list, err)
+			}
+			// Новая страница со старым заголовком начинается с чистого листа.
+			savePage(t, "A", "new page")
+			if list, err := comments.List("A"); err != nil || len(list) != 0 {
+				t.Errorf("comments of the new page A = %v, %v; want none", list, err)
+			}
+		})
+	}
+}
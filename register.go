@@ -0,0 +1,390 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"mime"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/smtp"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// registerBcryptCost - стоимость bcrypt для паролей, заданных
+// при регистрации.
+const registerBcryptCost = 12
+
+// verificationTTL - сколько действует ссылка подтверждения почты.
+const verificationTTL = 24 * time.Hour
+
+var validUsername = regexp.MustCompile(`^[a-zA-Z0-9_.-]{3,32}$`)
+
+// reservedUsernames - имена, которые нельзя занять регистрацией:
+// по ним пользователя можно принять за администратора или сам сайт.
+// Имена из adminUsers зарезервированы так же.
+var reservedUsernames = []string{"admin", "administrator", "root", "system", "wiki", "webmaster"}
+
+// reservedUsername сообщает, зарезервировано ли имя name. Регистр
+// не учитывается: "Admin" не должен выглядеть как "admin".
+func reservedUsername(name string) bool {
+	for _, list := range [][]string{reservedUsernames, adminUsers} {
+		for _, r := range list {
+			if strings.EqualFold(name, r) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// validatePassword проверяет сложность пароля: не короче 12 символов,
+// хотя бы одна цифра и один специальный символ. Длиннее 72 байт
+// пароль быть не может: дальше bcrypt его не учитывает.
+func validatePassword(password string) error {
+	if len([]rune(password)) < 12 {
+		return errors.New("password must be at least 12 characters long")
+	}
+	if len(password) > 72 {
+		return errors.New("password must be at most 72 bytes long")
+	}
+	var digit, special bool
+	for _, c := range password {
+		switch {
+		case unicode.IsDigit(c):
+			digit = true
+		case unicode.IsPunct(c) || unicode.IsSymbol(c):
+			special = true
+		}
+	}
+	if !digit || !special {
+		return errors.New("password must contain at least one digit and one special character")
+	}
+	return nil
+}
+
+// verification - выданная ссылка подтверждения почты.
+type verification struct {
+	Username  string    `json:"username"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// VerificationStore хранит токены подтверждения почты в JSON-файле
+// Path в виде {token: {username, expires_at}}. Токен одноразовый:
+// Consume удаляет его. Просроченные токены остаются до Expire, чтобы
+// вместе с ними удалить и неподтвержденных пользователей (см.
+// purgeUnverified).
+type VerificationStore struct {
+	Path string
+	mu   sync.Mutex
+}
+
+var verifications = &VerificationStore{Path: "verifications.json"}
+
+var (
+	errVerificationInvalid = errors.New("invalid verification token")
+	errVerificationExpired = errors.New("verification link has expired")
+)
+
+func (s *VerificationStore) load() (map[string]verification, error) {
+	m := make(map[string]verification)
+	data, err := ioutil.ReadFile(s.Path)
+	if os.IsNotExist(err) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return m, json.Unmarshal(data, &m)
+}
+
+func (s *VerificationStore) store(m map[string]verification) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.Path, data, 0600)
+}
+
+// Create выдает случайный токен подтверждения для username,
+// действительный до expires.
+func (s *VerificationStore) Create(username string, expires time.Time) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	tok := hex.EncodeToString(b)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m, err := s.load()
+	if err != nil {
+		return "", err
+	}
+	m[tok] = verification{Username: username, ExpiresAt: expires}
+	return tok, s.store(m)
+}
+
+// Consume погашает token и возвращает имя пользователя. Для
+// неизвестного или уже использованного токена возвращается
+// errVerificationInvalid, для просроченного - errVerificationExpired;
+// просроченный токен не удаляется, его удалит Expire.
+func (s *VerificationStore) Consume(token string, now time.Time) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m, err := s.load()
+	if err != nil {
+		return "", err
+	}
+	v, ok := m[token]
+	switch {
+	case !ok:
+		return "", errVerificationInvalid
+	case !now.Before(v.ExpiresAt):
+		return "", errVerificationExpired
+	}
+	delete(m, token)
+	return v.Username, s.store(m)
+}
+
+// Expire удаляет токены, просроченные к моменту now, и возвращает
+// имена пользователей, которым они были выданы.
+func (s *VerificationStore) Expire(now time.Time) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for tok, v := range m {
+		if !now.Before(v.ExpiresAt) {
+			delete(m, tok)
+			names = append(names, v.Username)
+		}
+	}
+	if len(names) == 0 {
+		return nil, nil
+	}
+	return names, s.store(m)
+}
+
+// purgeUnverified удаляет просроченные токены подтверждения вместе
+// с пользователями, которые так и не подтвердили по ним почту, и их
+// профилями. После этого имя и адрес почты снова свободны для
+// регистрации.
+func purgeUnverified(users *UserStore, now time.Time) error {
+	names, err := verifications.Expire(now)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		u, err := users.Lookup(name)
+		if errors.Is(err, errUnknownUser) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if !u.Unverified {
+			continue
+		}
+		if err := users.Remove(name); err != nil {
+			return err
+		}
+		if err := profiles.Remove(name); err != nil {
+			return err
+		}
+		slog.Info("удален неподтвержденный пользователь", "username", name)
+	}
+	return nil
+}
+
+// purgeUnverifiedEvery вызывает purgeUnverified при запуске и затем
+// раз в interval. Его запускает main в отдельной горутине, если
+// регистрация включена.
+func purgeUnverifiedEvery(users *UserStore, interval time.Duration) {
+	purge := func(now time.Time) {
+		if err := purgeUnverified(users, now); err != nil {
+			slog.Error("не удалось удалить неподтвержденных пользователей", "err", err)
+		}
+	}
+	purge(time.Now())
+	for now := range time.Tick(interval) {
+		purge(now)
+	}
+}
+
+// Mailer отправляет письма. Регистрация зависит только от этого
+// интерфейса, поэтому SMTP можно заменить другой доставкой.
+type Mailer interface {
+	Send(to, subject, body string) error
+}
+
+// SMTPMailer отправляет письма через SMTP-сервер Addr (host:port)
+// от имени From. Auth может быть nil, если сервер не требует входа.
+type SMTPMailer struct {
+	Addr string
+	From string
+	Auth smtp.Auth
+}
+
+// smtpMailerFromEnv настраивает SMTPMailer по переменным WEB_SMTP_HOST,
+// WEB_SMTP_PORT (по умолчанию 587), WEB_SMTP_USER, WEB_SMTP_PASS
+// и WEB_SMTP_FROM. Без WEB_SMTP_HOST возвращает nil.
+func smtpMailerFromEnv() *SMTPMailer {
+	host := os.Getenv("WEB_SMTP_HOST")
+	if host == "" {
+		return nil
+	}
+	m := &SMTPMailer{
+		Addr: net.JoinHostPort(host, envString("WEB_SMTP_PORT", "587")),
+		From: envString("WEB_SMTP_FROM", "wiki@"+host),
+	}
+	if user := os.Getenv("WEB_SMTP_USER"); user != "" {
+		m.Auth = smtp.PlainAuth("", user, os.Getenv("WEB_SMTP_PASS"), host)
+	}
+	return m
+}
+
+func (m *SMTPMailer) Send(to, subject, body string) error {
+	msg := "From: " + m.From + "\r\n" +
+		"To: " + to + "\r\n" +
+		"Subject: " + mime.QEncoding.Encode("utf-8", subject) + "\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n" +
+		"\r\n" + body
+	return smtp.SendMail(m.Addr, m.Auth, m.From, []string{to}, []byte(msg))
+}
+
+// registerHandler обслуживает POST /register с телом
+// {"username":"...","email":"...","password":"..."}: создает
+// неподтвержденного читателя (roleReader) и отправляет на email ссылку
+// baseURL/verify?token=... Адрес сайта берется из настроек, а не из
+// заголовка Host: иначе чужой запрос с поддельным Host отправил бы
+// в письме ссылку на другой сайт. Тело принимается только как
+// application/json, поэтому, как и /graphql, форма с чужого сайта его
+// не отправит.
+func registerHandler(users *UserStore, mailer Mailer, baseURL string) http.HandlerFunc {
+	baseURL = strings.TrimSuffix(baseURL, "/")
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", "POST")
+			writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		if mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mt != "application/json" {
+			writeJSONError(w, http.StatusUnsupportedMediaType, "Content-Type must be application/json")
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, 4<<10)
+		var req struct {
+			Username string `json:"username"`
+			Email    string `json:"email"`
+			Password string `json:"password"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "malformed JSON: "+err.Error())
+			return
+		}
+		if !validUsername.MatchString(req.Username) {
+			writeJSONError(w, http.StatusBadRequest, "username must be 3-32 letters, digits, '.', '_' or '-'")
+			return
+		}
+		if reservedUsername(req.Username) {
+			writeJSONError(w, http.StatusConflict, "username is reserved")
+			return
+		}
+		if addr, err := mail.ParseAddress(req.Email); err != nil || addr.Address != req.Email {
+			writeJSONError(w, http.StatusBadRequest, "invalid email address")
+			return
+		}
+		if err := validatePassword(req.Password); err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		// Имя или адрес почты может быть занят неподтвержденной
+		// учетной записью, ссылка для которой уже просрочена: такая
+		// запись удаляется, и регистрация ее заменяет.
+		if err := purgeUnverified(users, time.Now()); err != nil {
+			serverError(w, err)
+			return
+		}
+		hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), registerBcryptCost)
+		if err != nil {
+			serverError(w, err)
+			return
+		}
+		// Зарегистрировавшийся сам - только читатель: редактором его
+		// может сделать администратор в users.json.
+		u := User{Username: req.Username, PasswordHash: string(hash), Email: req.Email, Unverified: true, Role: roleReader}
+		if err := users.Add(u); errors.Is(err, errUserExists) || errors.Is(err, errEmailExists) {
+			writeJSONError(w, http.StatusConflict, err.Error())
+			return
+		} else if err != nil {
+			serverError(w, err)
+			return
+		}
+		tok, err := verifications.Create(u.Username, time.Now().Add(verificationTTL))
+		if err == nil {
+			link := baseURL + "/verify?token=" + url.QueryEscape(tok)
+			err = mailer.Send(u.Email, "Confirm your wiki account", fmt.Sprintf(
+				"Hello, %s!\r\n\r\nTo activate your account, open this link within 24 hours:\r\n%s\r\n",
+				u.Username, link))
+			if err != nil {
+				verifications.Consume(tok, time.Now())
+			}
+		}
+		if err != nil {
+			// Без письма учетную запись не подтвердить, поэтому она
+			// удаляется, и имя можно занять повторной регистрацией.
+			if rmErr := users.Remove(u.Username); rmErr != nil {
+				slog.Error("не удалось удалить неподтвержденного пользователя", "username", u.Username, "err", rmErr)
+			}
+			slog.Error("не удалось отправить письмо с подтверждением", "username", u.Username, "err", err)
+			writeJSONError(w, http.StatusBadGateway, "could not send verification email")
+			return
+		}
+		// Профиль создается сразу, чтобы в нем было время регистрации.
+		if err := profiles.Update(u.Username, func(*Profile) {}); err != nil {
+			slog.Error("не удалось создать профиль", "username", u.Username, "err", err)
+		}
+		writeJSON(w, http.StatusCreated, map[string]string{"username": u.Username, "email": u.Email})
+	}
+}
+
+// verifyHandler обслуживает GET /verify?token=...: погашает токен
+// и открывает вход пользователю, которому он выдан.
+func verifyHandler(users *UserStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !allowMethod(w, r, http.MethodGet) {
+			return
+		}
+		username, err := verifications.Consume(r.URL.Query().Get("token"), time.Now())
+		if err == nil {
+			err = users.Update(username, func(u *User) { u.Unverified = false })
+		}
+		switch {
+		case errors.Is(err, errVerificationExpired):
+			errorHandler(w, r, http.StatusGone, "This verification link has expired")
+		case errors.Is(err, errVerificationInvalid), errors.Is(err, errUnknownUser):
+			errorHandler(w, r, http.StatusBadRequest, "This verification link is invalid or has already been used")
+		case err != nil:
+			errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		default:
+			renderTemplate(w, "login", loginView{Notice: "Your email address is confirmed. You can log in now.", CSRFToken: csrfToken(r)})
+		}
+	}
+}
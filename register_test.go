@@ -0,0 +1,284 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testMailer запоминает отправленные письма вместо отправки.
+type testMailer struct {
+	sent []string // адресат и текст письма
+}
+
+func (m *testMailer) Send(to, subject, body string) error {
+	m.sent = append(m.sent, to+"\n"+body)
+	return nil
+}
+
+// register отправляет POST /register с телом body.
+func register(h http.Handler, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, "/register", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestRegisterReservedUsernames(t *testing.T) {
+	dir := testDataDir(t)
+	oldAdmins := adminUsers
+	adminUsers = []string{"boss"}
+	t.Cleanup(func() { adminUsers = oldAdmins })
+	users := &UserStore{Path: filepath.Join(dir, "users.json")}
+	h := registerHandler(users, &testMailer{}, "https://wiki.example.com")
+	tests := []struct {
+		username string
+		want     int
+	}{
+		{"admin", http.StatusConflict},
+		{"Admin", http.StatusConflict},
+		{"root", http.StatusConflict},
+		{"boss", http.StatusConflict},
+		{"BOSS", http.StatusConflict},
+		{"alice", http.StatusCreated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.username, func(t *testing.T) {
+			w := register(h, `{"username":"`+tt.username+`","email":"`+tt.username+`@example.com","password":"long-enough-passw0rd!"}`)
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+			if _, err := users.Lookup(tt.username); (err == nil) != (tt.want == http.StatusCreated) {
+				t.Errorf("Lookup(%q) error = %v", tt.username, err)
+			}
+		})
+	}
+}
+
+// Неподтвержденная учетная запись с просроченной ссылкой удаляется,
+// и ее имя и адрес почты можно занять заново.
+func TestRegisterReplacesExpiredUnverified(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing User
+		expires  time.Duration // срок ссылки для existing от текущего момента
+		want     int
+	}{
+		{"pending link keeps the name", User{Username: "bob", Email: "old@example.com", Unverified: true}, time.Hour, http.StatusConflict},
+		{"expired link frees the name", User{Username: "bob", Email: "old@example.com", Unverified: true}, -time.Hour, http.StatusCreated},
+		{"expired link frees the email", User{Username: "robert", Email: "bob@example.com", Unverified: true}, -time.Hour, http.StatusCreated},
+		{"verified account is kept", User{Username: "bob", Email: "old@example.com"}, -time.Hour, http.StatusConflict},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := testDataDir(t)
+			users := &UserStore{Path: filepath.Join(dir, "users.json")}
+			tt.existing.PasswordHash = "old hash"
+			if err := users.Add(tt.existing); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := verifications.Create(tt.existing.Username, time.Now().Add(tt.expires)); err != nil {
+				t.Fatal(err)
+			}
+			w := register(registerHandler(users, &testMailer{}, "https://wiki.example.com"), `{"username":"bob","email":"bob@example.com","password":"long-enough-passw0rd!"}`)
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+			list, err := users.load()
+			if err != nil {
+				t.Fatal(err)
+			}
+			kept := false
+			for _, u := range list {
+				kept = kept || u == tt.existing
+			}
+			if purged := tt.want == http.StatusCreated; kept == purged {
+				t.Errorf("existing account kept = %v, want %v", kept, !purged)
+			}
+		})
+	}
+}
+
+func TestPurgeUnverified(t *testing.T) {
+	dir := testDataDir(t)
+	users := &UserStore{Path: filepath.Join(dir, "users.json")}
+	now := time.Now()
+	for _, u := range []struct {
+		User
+		expires time.Time
+	}{
+		{User{Username: "expired", Unverified: true}, now.Add(-time.Minute)},
+		{User{Username: "pending", Unverified: true}, now.Add(time.Minute)},
+		{User{Username: "verified"}, now.Add(-time.Minute)},
+	} {
+		if err := users.Add(u.User); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := verifications.Create(u.Username, u.expires); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := purgeUnverified(users, now); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]bool{"expired": false, "pending": true, "verified": true} {
+		if _, err := users.Lookup(name); (err == nil) != want {
+			t.Errorf("user %s kept = %v, want %v", name, err == nil, want)
+		}
+	}
+	if names, err := verifications.Expire(now); err != nil || len(names) != 0 {
+		t.Errorf("Expire after purge = %v, %v; want no expired tokens left", names, err)
+	}
+}
+
+// Ссылка в письме строится от настроенного адреса сайта, а не от
+// заголовка Host запроса.
+func TestRegisterLinkUsesBaseURL(t *testing.T) {
+	dir := testDataDir(t)
+	users := &UserStore{Path: filepath.Join(dir, "users.json")}
+	mailer := &testMailer{}
+	h := registerHandler(users, mailer, "https://wiki.example.com/")
+	r := httptest.NewRequest(http.MethodPost, "/register", strings.NewReader(
+		`{"username":"bob","email":"bob@example.com","password":"long-enough-passw0rd!"}`))
+	r.Header.Set("Content-Type", "application/json")
+	r.Host = "evil.example.net"
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusCreated, w.Body)
+	}
+	if len(mailer.sent) != 1 {
+		t.Fatalf("sent %d emails, want 1", len(mailer.sent))
+	}
+	if msg := mailer.sent[0]; !strings.Contains(msg, "https://wiki.example.com/verify?token=") || strings.Contains(msg, "evil") {
+		t.Errorf("verification email does not link to the configured site:\n%s", msg)
+	}
+}
+
+// fakeSMTP - SMTP-сервер на localhost, который принимает одно письмо
+// и отдает его текст в канал.
+func fakeSMTP(t *testing.T) (addr string, messages <-chan string) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	ch := make(chan string, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		tp := textproto.NewConn(conn)
+		tp.PrintfLine("220 localhost ESMTP")
+		for {
+			line, err := tp.ReadLine()
+			if err != nil {
+				return
+			}
+			switch cmd := strings.ToUpper(strings.Fields(line + " ")[0]); cmd {
+			case "DATA":
+				tp.PrintfLine("354 go ahead")
+				data, err := tp.ReadDotBytes()
+				if err != nil {
+					return
+				}
+				ch <- string(data)
+				tp.PrintfLine("250 queued")
+			case "QUIT":
+				tp.PrintfLine("221 bye")
+				return
+			default:
+				tp.PrintfLine("250 ok")
+			}
+		}
+	}()
+	return l.Addr().String(), ch
+}
+
+// Регистрация целиком: письмо уходит через SMTP, ссылка из него
+// подтверждает адрес один раз, и пользователь становится читателем.
+func TestRegisterAndVerify(t *testing.T) {
+	dir := testDataDir(t)
+	users := &UserStore{Path: filepath.Join(dir, "users.json")}
+	addr, messages := fakeSMTP(t)
+	mailer := &SMTPMailer{Addr: addr, From: "wiki@example.com"}
+	w := register(registerHandler(users, mailer, "https://wiki.example.com"),
+		`{"username":"bob","email":"bob@example.com","password":"long-enough-passw0rd!"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("register status = %d, want 201: %s", w.Code, w.Body)
+	}
+	var msg string
+	select {
+	case msg = <-messages:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no email sent")
+	}
+	if !strings.Contains(msg, "To: bob@example.com") {
+		t.Errorf("email is not addressed to bob:\n%s", msg)
+	}
+	link := regexp.MustCompile(`https://wiki\.example\.com(/verify\?token=[0-9a-f]+)`).FindStringSubmatch(msg)
+	if link == nil {
+		t.Fatalf("no verification link in the email:\n%s", msg)
+	}
+	if u, err := users.Lookup("bob"); err != nil || !u.Unverified || u.Role != roleReader {
+		t.Fatalf("registered user = %+v, %v; want an unverified reader", u, err)
+	}
+
+	verify := func() int {
+		w := httptest.NewRecorder()
+		verifyHandler(users)(w, httptest.NewRequest(http.MethodGet, link[1], nil))
+		return w.Code
+	}
+	if code := verify(); code != http.StatusOK {
+		t.Fatalf("GET /verify status = %d, want 200", code)
+	}
+	if u, err := users.Lookup("bob"); err != nil || u.Unverified {
+		t.Errorf("user after verification = %+v, %v; want verified", u, err)
+	}
+	if code := verify(); code != http.StatusBadRequest {
+		t.Errorf("second GET /verify status = %d, want 400: the token must be consumed", code)
+	}
+}
+
+// Читатель, зарегистрировавшийся сам, не видит закрытых страниц
+// и не может их менять.
+func TestReaderRole(t *testing.T) {
+	testDataDir(t)
+	savePage(t, "Secret", "hidden")
+	if err := metas.Update("Secret", func(m *PageMeta) { m.Public = false }); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		user     *User
+		wantRead bool
+		wantEdit int
+	}{
+		{"editor", &User{Username: "alice"}, true, http.StatusOK},
+		{"reader", &User{Username: "bob", Role: roleReader}, false, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/edit/Secret", nil)
+			r = r.WithContext(context.WithValue(r.Context(), userContextKey, tt.user))
+			if ok, err := canRead(r, "Secret"); err != nil || ok != tt.wantRead {
+				t.Errorf("canRead = %v, %v; want %v", ok, err, tt.wantRead)
+			}
+			w := httptest.NewRecorder()
+			requireEditor(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})).ServeHTTP(w, r)
+			if w.Code != tt.wantEdit {
+				t.Errorf("requireEditor status = %d, want %d", w.Code, tt.wantEdit)
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"net/http"
+)
+
+// cspNonce возвращает nonce текущего запроса для атрибута nonce
+// встроенных скриптов (<script nonce="...">).
+func cspNonce(r *http.Request) string {
+	n, _ := r.Context().Value(cspNonceContextKey).(string)
+	return n
+}
+
+// securityHeadersMiddleware добавляет к каждому ответу заголовки,
+// которые запрещают браузеру угадывать тип содержимого, встраивать
+// сайт во фреймы чужих страниц и загружать ресурсы с других доменов.
+// Встроенные скрипты разрешены только с nonce, который генерируется
+// заново для каждого запроса. Strict-Transport-Security отправляется
+// только по HTTPS.
+func securityHeadersMiddleware() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			b := make([]byte, 16)
+			if _, err := rand.Read(b); err != nil {
+				serverError(w, err)
+				return
+			}
+			nonce := base64.StdEncoding.EncodeToString(b)
+			h := w.Header()
+			h.Set("X-Content-Type-Options", "nosniff")
+			h.Set("X-Frame-Options", "SAMEORIGIN")
+			h.Set("Referrer-Policy", "strict-origin-when-cross-origin")
+			h.Set("Content-Security-Policy", "default-src 'self'; script-src 'self' 'nonce-"+nonce+"'")
+			if r.TLS != nil {
+				h.Set("Strict-Transport-Security", "max-age=63072000; includeSubDomains")
+			}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), cspNonceContextKey, nonce)))
+		})
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// shareLink - выданная ссылка на страницу: чья она и до какого
+// времени действует.
+type shareLink struct {
+	Title   string    `json:"title"`
+	Expires time.Time `json:"expires"`
+}
+
+// ShareStore выдает и проверяет ссылки для чтения закрытых страниц.
+// Токен ссылки - HMAC-SHA256 от заголовка и срока действия на ключе
+// Key; выданные токены хранятся в JSON-файле Path. Просроченные
+// записи удаляются из файла при следующей проверке любой ссылки.
+type ShareStore struct {
+	Path string
+	Key  []byte
+	mu   sync.Mutex
+}
+
+var shares = &ShareStore{Path: "shares.json"}
+
+// loadShareKey возвращает ключ подписи ссылок из файла path, а если
+// файла еще нет - создает его со случайным ключом. Ключ сессий для
+// ссылок не годится: без WEB_SESSION_KEY он новый при каждом запуске,
+// и все выданные ссылки перестали бы открываться после перезапуска.
+func loadShareKey(path string) ([]byte, error) {
+	data, err := ioutil.ReadFile(path)
+	if err == nil {
+		return hex.DecodeString(strings.TrimSpace(string(data)))
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return key, writeFileAtomic(path, []byte(hex.EncodeToString(key)+"\n"), 0600)
+}
+
+var (
+	errShareInvalid = errors.New("invalid share token")
+	errShareExpired = errors.New("share link has expired")
+)
+
+func (s *ShareStore) load() (map[string]shareLink, error) {
+	m := make(map[string]shareLink)
+	data, err := ioutil.ReadFile(s.Path)
+	if os.IsNotExist(err) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return m, json.Unmarshal(data, &m)
+}
+
+func (s *ShareStore) store(m map[string]shareLink) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.Path, data, 0600)
+}
+
+func (s *ShareStore) token(title string, expires time.Time) string {
+	mac := hmac.New(sha256.New, s.Key)
+	mac.Write([]byte(title + "|" + strconv.FormatInt(expires.Unix(), 10)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Create выдает токен для чтения страницы title до expires.
+func (s *ShareStore) Create(title string, expires time.Time) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m, err := s.load()
+	if err != nil {
+		return "", err
+	}
+	expires = expires.Truncate(time.Second)
+	tok := s.token(title, expires)
+	m[tok] = shareLink{Title: title, Expires: expires}
+	return tok, s.store(m)
+}
+
+// Check проверяет, что token открывает страницу title в момент now.
+// Возвращает errShareExpired для просроченного токена и
+// errShareInvalid для неизвестного или подделанного.
+func (s *ShareStore) Check(title, token string, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m, err := s.load()
+	if err != nil {
+		return err
+	}
+	link, ok := m[token]
+	purged := false
+	for tok, l := range m {
+		if !now.Before(l.Expires) {
+			delete(m, tok)
+			purged = true
+		}
+	}
+	if purged {
+		if err := s.store(m); err != nil {
+			return err
+		}
+	}
+	switch {
+	case !ok || link.Title != title || !hmac.Equal([]byte(token), []byte(s.token(title, link.Expires))):
+		return errShareInvalid
+	case !now.Before(link.Expires):
+		return errShareExpired
+	}
+	return nil
+}
+
+// maxShareTTL - наибольший срок действия ссылки. Он же не дает
+// умножению на time.Second переполниться.
+const maxShareTTL = 365 * 24 * time.Hour
+
+var apiSharePath = regexp.MustCompile(`^/api/v1/pages/(` + titleChars + `)/share$`)
+
+// apiShareHandler выдает ссылку на чтение страницы, которая действует
+// и для закрытых страниц: POST /api/v1/pages/{title}/share с телом
+// {"expires_in_seconds":3600}.
+func apiShareHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	m := apiSharePath.FindStringSubmatch(r.URL.Path)
+	var req struct {
+		ExpiresIn int64 `json:"expires_in_seconds"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "malformed JSON: "+err.Error())
+		return
+	}
+	if max := int64(maxShareTTL / time.Second); req.ExpiresIn <= 0 || req.ExpiresIn > max {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("expires_in_seconds must be between 1 and %d", max))
+		return
+	}
+	_, err := store.Load(m[1])
+	if errors.Is(err, os.ErrNotExist) {
+		writeJSONError(w, http.StatusNotFound, "page not found")
+		return
+	}
+	if err != nil {
+		serverError(w, err)
+		return
+	}
+	expires := time.Now().Add(time.Duration(req.ExpiresIn) * time.Second)
+	tok, err := shares.Create(m[1], expires)
+	if err != nil {
+		serverError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, map[string]interface{}{
+		"share_url": viewURL(r, m[1]) + "?" + url.Values{"token": {tok}}.Encode(),
+		"expires":   expires.Truncate(time.Second),
+	})
+}
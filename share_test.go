@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAPIShareExpiresIn(t *testing.T) {
+	testDataDir(t)
+	old := shares.Key
+	shares.Key = []byte("key")
+	t.Cleanup(func() { shares.Key = old })
+	savePage(t, "Foo", "text")
+	tests := []struct {
+		expiresIn string
+		want      int
+	}{
+		{"3600", http.StatusCreated},
+		{strconv.Itoa(365 * 24 * 3600), http.StatusCreated},
+		{strconv.Itoa(365*24*3600 + 1), http.StatusBadRequest},
+		{"9223372036854775807", http.StatusBadRequest},
+		{"0", http.StatusBadRequest},
+		{"-5", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expiresIn, func(t *testing.T) {
+			w := serve(apiShareHandler, http.MethodPost, "/api/v1/pages/Foo/share", `{"expires_in_seconds":`+tt.expiresIn+`}`)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+		})
+	}
+}
+
+// Ключ ссылок создается один раз и читается из файла при следующих
+// запусках, так что выданные ссылки остаются действительными.
+func TestLoadShareKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "share.key")
+	first, err := loadShareKey(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(first) != 32 {
+		t.Fatalf("key length = %d, want 32", len(first))
+	}
+	again, err := loadShareKey(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(first, again) {
+		t.Error("share key changed between loads")
+	}
+}
+
+func TestShareLinkOpensPrivatePage(t *testing.T) {
+	testDataDir(t)
+	oldKey, oldBase := shares.Key, siteBaseURL
+	shares.Key, siteBaseURL = []byte("key"), "https://wiki.example.com"
+	t.Cleanup(func() { shares.Key, siteBaseURL = oldKey, oldBase })
+	savePage(t, "Secret", "hidden")
+	savePage(t, "Other", "also hidden")
+	for _, title := range []string{"Secret", "Other"} {
+		if err := metas.Update(title, func(m *PageMeta) { m.Public = false }); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/api/v1/pages/Secret/share", strings.NewReader(`{"expires_in_seconds":3600}`))
+	r.Host = "evil.example.net"
+	w := httptest.NewRecorder()
+	apiShareHandler(w, r)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("share status = %d: %s", w.Code, w.Body)
+	}
+	var resp struct {
+		ShareURL string `json:"share_url"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(resp.ShareURL)
+	if err != nil || u.Scheme+"://"+u.Host != "https://wiki.example.com" || u.Path != "/view/Secret" {
+		t.Fatalf("share_url = %q, want a link to /view/Secret on the configured site", resp.ShareURL)
+	}
+	valid := u.Query().Get("token")
+	expired, err := shares.Create("Secret", time.Now().Add(-time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered := []byte(valid)
+	tampered[0] ^= 1
+
+	tests := []struct {
+		name, path string
+		want       int
+	}{
+		{"valid token", "/view/Secret?token=" + valid, http.StatusOK},
+		{"no token", "/view/Secret", http.StatusFound},
+		{"expired token", "/view/Secret?token=" + expired, http.StatusForbidden},
+		{"tampered token", "/view/Secret?token=" + string(tampered), http.StatusForbidden},
+		{"token of another page", "/view/Other?token=" + valid, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			makeHandler(pageResourceHandler)(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d", w.Code, tt.want)
+			}
+			if tt.want == http.StatusOK && !strings.Contains(w.Body.String(), "hidden") {
+				t.Error("page text is missing")
+			}
+		})
+	}
+	// Просроченная ссылка удаляется из shares.json при проверке.
+	m, err := shares.load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := m[expired]; ok || len(m) != 1 {
+		t.Errorf("shares.json = %v, want only the valid token", m)
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// siteBaseURL - внешний адрес сайта для /sitemap.xml, /robots.txt,
+// лент и ссылок /share (флаг -baseurl или WEB_BASE_URL). Если он не
+// задан, адрес берется из запроса.
+var siteBaseURL string
+
+type sitemapURLSet struct {
+	XMLName xml.Name     `xml:"http://www.sitemaps.org/schemas/sitemap/0.9 urlset"`
+	URLs    []sitemapURL `xml:"url"`
+}
+
+type sitemapURL struct {
+	Loc        string `xml:"loc"`
+	LastMod    string `xml:"lastmod,omitempty"`
+	ChangeFreq string `xml:"changefreq,omitempty"`
+	Priority   string `xml:"priority,omitempty"`
+}
+
+// validBaseURL сообщает, подходит ли s для siteBaseURL: это должен
+// быть абсолютный http:// или https:// адрес.
+func validBaseURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// siteURL возвращает внешний адрес сайта без завершающей косой черты.
+func siteURL(r *http.Request) string {
+	if siteBaseURL != "" {
+		return strings.TrimSuffix(siteBaseURL, "/")
+	}
+	return baseURL(r)
+}
+
+// sitemapHandler отдает /sitemap.xml: главную страницу и облако тегов
+// с приоритетом 0.8 и все открытые страницы с временем изменения.
+func sitemapHandler(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet, http.MethodHead) {
+		return
+	}
+	titles, err := store.List()
+	if err != nil {
+		errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	// Обработчик не знает пользователя, поэтому visibleTitles
+	// оставляет только открытые страницы.
+	if titles, err = visibleTitles(r, titles); err != nil {
+		errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	base := siteURL(r)
+	set := sitemapURLSet{URLs: []sitemapURL{
+		{Loc: base + "/", Priority: "0.8"},
+		{Loc: base + "/tags", Priority: "0.8"},
+	}}
+	for _, t := range titles {
+		p, err := store.Load(t)
+		if err != nil {
+			errorHandler(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+		set.URLs = append(set.URLs, sitemapURL{
+			Loc:     base + "/view/" + url.PathEscape(t),
+			LastMod: p.Modified.UTC().Format(time.RFC3339),
+		})
+	}
+	out, err := xml.MarshalIndent(set, "", "  ")
+	if err != nil {
+		errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	w.Write([]byte(xml.Header))
+	w.Write(out)
+}
+
+// robotsHandler отдает /robots.txt со ссылкой на карту сайта.
+func robotsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintf(w, "User-agent: *\nAllow: /\nSitemap: %s/sitemap.xml\n", siteURL(r))
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/xml"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSitemap(t *testing.T) {
+	testDataDir(t)
+	old := siteBaseURL
+	siteBaseURL = "https://wiki.example.com/"
+	t.Cleanup(func() { siteBaseURL = old })
+	for _, title := range []string{"Foo", "Bar", "Главная", "Secret"} {
+		savePage(t, title, "text")
+	}
+	if err := metas.Update("Secret", func(m *PageMeta) { m.Public = false }); err != nil {
+		t.Fatal(err)
+	}
+
+	w := serve(sitemapHandler, http.MethodGet, "/sitemap.xml", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/xml" {
+		t.Errorf("Content-Type = %q, want application/xml", ct)
+	}
+	if !strings.HasPrefix(w.Body.String(), xml.Header) {
+		t.Error("sitemap has no XML declaration")
+	}
+	var set struct {
+		XMLName xml.Name
+		URLs    []struct {
+			Loc     string `xml:"loc"`
+			LastMod string `xml:"lastmod"`
+		} `xml:"url"`
+	}
+	if err := xml.Unmarshal(w.Body.Bytes(), &set); err != nil {
+		t.Fatalf("sitemap is not valid XML: %v", err)
+	}
+	if set.XMLName.Space != "http://www.sitemaps.org/schemas/sitemap/0.9" || set.XMLName.Local != "urlset" {
+		t.Errorf("root element = %v, want urlset in the sitemap namespace", set.XMLName)
+	}
+	lastmod := make(map[string]string)
+	for _, u := range set.URLs {
+		lastmod[u.Loc] = u.LastMod
+	}
+	for _, loc := range []string{
+		"https://wiki.example.com/",
+		"https://wiki.example.com/tags",
+		"https://wiki.example.com/view/Foo",
+		"https://wiki.example.com/view/Bar",
+		"https://wiki.example.com/view/%D0%93%D0%BB%D0%B0%D0%B2%D0%BD%D0%B0%D1%8F",
+	} {
+		mod, ok := lastmod[loc]
+		if !ok {
+			t.Errorf("sitemap has no %s", loc)
+			continue
+		}
+		if strings.Contains(loc, "/view/") {
+			if _, err := time.Parse(time.RFC3339, mod); err != nil {
+				t.Errorf("lastmod of %s = %q: %v", loc, mod, err)
+			}
+		}
+	}
+	if _, ok := lastmod["https://wiki.example.com/view/Secret"]; ok || len(set.URLs) != 5 {
+		t.Errorf("sitemap lists %d URLs including private pages: %v", len(set.URLs), lastmod)
+	}
+}
+
+func TestRobots(t *testing.T) {
+	old := siteBaseURL
+	siteBaseURL = "https://wiki.example.com"
+	t.Cleanup(func() { siteBaseURL = old })
+	w := serve(robotsHandler, http.MethodGet, "/robots.txt", "")
+	if !strings.Contains(w.Body.String(), "Sitemap: https://wiki.example.com/sitemap.xml\n") {
+		t.Errorf("robots.txt has no sitemap link:\n%s", w.Body)
+	}
+}
+
+// Без -baseurl адрес берется из запроса; главная и облако тегов идут
+// с приоритетом 0.8, а страниц в карте столько же, сколько открытых.
+func TestSitemapFromRequest(t *testing.T) {
+	testDataDir(t)
+	old := siteBaseURL
+	siteBaseURL = ""
+	t.Cleanup(func() { siteBaseURL = old })
+	for i, title := range []string{"A", "B", "C", "Hidden"} {
+		savePage(t, title, strings.Repeat("x", i+1))
+	}
+	if err := metas.Update("Hidden", func(m *PageMeta) { m.Public = false }); err != nil {
+		t.Fatal(err)
+	}
+
+	w := serve(sitemapHandler, http.MethodGet, "http://wiki.test/sitemap.xml", "")
+	if cc := w.Header().Get("Cache-Control"); cc != "public, max-age=3600" {
+		t.Errorf("Cache-Control = %q, want public, max-age=3600", cc)
+	}
+	var set sitemapURLSet
+	if err := xml.Unmarshal(w.Body.Bytes(), &set); err != nil {
+		t.Fatal(err)
+	}
+	pages := 0
+	for _, u := range set.URLs {
+		switch u.Loc {
+		case "http://wiki.test/", "http://wiki.test/tags":
+			if u.Priority != "0.8" {
+				t.Errorf("priority of %s = %q, want 0.8", u.Loc, u.Priority)
+			}
+		default:
+			if !strings.HasPrefix(u.Loc, "http://wiki.test/view/") {
+				t.Errorf("unexpected URL %s", u.Loc)
+			}
+			pages++
+		}
+	}
+	if pages != 3 {
+		t.Errorf("sitemap lists %d pages, want the 3 public ones", pages)
+	}
+
+	if w := serve(sitemapHandler, http.MethodPost, "/sitemap.xml", ""); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST /sitemap.xml: status = %d, want 405", w.Code)
+	}
+}
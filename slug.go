@@ -0,0 +1,129 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// slugify превращает заголовок в часть URL: буквы приводятся
+// к нижнему регистру, пробелы заменяются дефисами, все остальное,
+// кроме букв, цифр и дефисов, выбрасывается, а повторяющиеся дефисы
+// схлопываются. Буквы не из латиницы сохраняются как есть.
+func slugify(title string) string {
+	var b strings.Builder
+	hyphen := false
+	for _, c := range strings.ToLower(title) {
+		switch {
+		case unicode.IsLetter(c) || unicode.IsDigit(c):
+			b.WriteRune(c)
+			hyphen = false
+		case c == '-' || unicode.IsSpace(c):
+			if !hyphen && b.Len() > 0 {
+				b.WriteByte('-')
+				hyphen = true
+			}
+		}
+	}
+	return strings.TrimSuffix(b.String(), "-")
+}
+
+// SlugStore хранит slug каждой страницы в файле Dir/{title}.slug.
+// Slug уникален: если он уже занят другой страницей, к нему
+// добавляется -2, -3 и так далее.
+type SlugStore struct {
+	Dir string
+	mu  sync.Mutex
+}
+
+var slugs = &SlugStore{Dir: "."}
+
+const slugSuffix = ".slug"
+
+func (s *SlugStore) path(title string) string {
+	return filepath.Join(s.Dir, title+slugSuffix)
+}
+
+func (s *SlugStore) get(title string) (string, error) {
+	data, err := ioutil.ReadFile(s.path(title))
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	return strings.TrimSpace(string(data)), err
+}
+
+// all возвращает соответствие slug -> заголовок по всем файлам .slug.
+func (s *SlugStore) all() (map[string]string, error) {
+	files, err := filepath.Glob(filepath.Join(s.Dir, "*"+slugSuffix))
+	if err != nil {
+		return nil, err
+	}
+	m := make(map[string]string, len(files))
+	for _, f := range files {
+		title := strings.TrimSuffix(filepath.Base(f), slugSuffix)
+		slug, err := s.get(title)
+		if err != nil {
+			return nil, err
+		}
+		m[slug] = title
+	}
+	return m, nil
+}
+
+// Get возвращает slug страницы title или пустую строку, если
+// он еще не назначен.
+func (s *SlugStore) Get(title string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.get(title)
+}
+
+// Assign назначает странице title slug, если его еще нет,
+// и возвращает его.
+func (s *SlugStore) Assign(title string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if slug, err := s.get(title); slug != "" || err != nil {
+		return slug, err
+	}
+	taken, err := s.all()
+	if err != nil {
+		return "", err
+	}
+	base := slugify(title)
+	if base == "" {
+		base = "page"
+	}
+	slug := base
+	for n := 2; taken[slug] != ""; n++ {
+		slug = base + "-" + strconv.Itoa(n)
+	}
+	return slug, writeFileAtomic(s.path(title), []byte(slug+"\n"), pageFileMode)
+}
+
+// Resolve возвращает заголовок страницы со slug slug.
+func (s *SlugStore) Resolve(slug string) (string, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m, err := s.all()
+	if err != nil {
+		return "", false, err
+	}
+	title, ok := m[slug]
+	return title, ok, nil
+}
+
+// Remove освобождает slug страницы title.
+func (s *SlugStore) Remove(title string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := os.Remove(s.path(title))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSlugify(t *testing.T) {
+	tests := []struct {
+		title, want string
+	}{
+		{"FrontPage", "frontpage"},
+		{"Hello World", "hello-world"},
+		{"  Hello   World  ", "hello-world"},
+		{"C++ & Go!", "c-go"},
+		{"a--b", "a-b"},
+		{"Главная Страница", "главная-страница"},
+		{"Café 2024", "café-2024"},
+		{"東京", "東京"},
+		{"!!!", ""},
+	}
+	for _, tt := range tests {
+		if got := slugify(tt.title); got != tt.want {
+			t.Errorf("slugify(%q) = %q, want %q", tt.title, got, tt.want)
+		}
+	}
+}
+
+func TestSlugStore(t *testing.T) {
+	testDataDir(t)
+	tests := []struct {
+		title, want string
+	}{
+		{"FooBar", "foobar"},
+		{"Foobar", "foobar-2"}, // тот же slug уже занят
+		{"FOOBAR", "foobar-3"},
+		{"FooBar", "foobar"}, // назначенный slug не меняется
+		{"Главная", "главная"},
+	}
+	for _, tt := range tests {
+		slug, err := slugs.Assign(tt.title)
+		if err != nil || slug != tt.want {
+			t.Errorf("Assign(%q) = %q, %v; want %q", tt.title, slug, err, tt.want)
+			continue
+		}
+		if title, ok, err := slugs.Resolve(slug); err != nil || !ok || title != tt.title {
+			t.Errorf("Resolve(%q) = %q, %v, %v; want %q", slug, title, ok, err, tt.title)
+		}
+	}
+	if _, ok, err := slugs.Resolve("missing"); ok || err != nil {
+		t.Errorf("Resolve of an unknown slug = %v, %v; want not found", ok, err)
+	}
+
+	// Освобожденный slug достается следующей странице.
+	if err := slugs.Remove("Foobar"); err != nil {
+		t.Fatal(err)
+	}
+	if slug, err := slugs.Assign("FOOBar"); err != nil || slug != "foobar-2" {
+		t.Errorf("Assign after Remove = %q, %v; want foobar-2", slug, err)
+	}
+}
+
+// /view/{slug} показывает страницу, а API отдает и заголовок, и slug.
+func TestSlugRoundTrip(t *testing.T) {
+	testDataDir(t)
+	savePage(t, "Главная", "привет")
+	slug, err := slugs.Assign("Главная")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	makeHandler(pageResourceHandler)(w, httptest.NewRequest(http.MethodGet, "/view/"+slug, nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "привет") {
+		t.Errorf("GET /view/%s: status = %d, want 200 with the page", slug, w.Code)
+	}
+
+	w = serve(apiGetPage, http.MethodGet, "/api/v1/pages/Главная", "")
+	var p struct{ Title, Slug string }
+	if err := json.NewDecoder(w.Body).Decode(&p); err != nil {
+		t.Fatal(err)
+	}
+	if p.Title != "Главная" || p.Slug != slug {
+		t.Errorf("API page = %+v, want title Главная and slug %s", p, slug)
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"sync"
+)
+
+// staticHandler отдает файлы из root по путям /static/...
+// Каталоги не показываются (403), а ответы разрешено кэшировать
+// на сутки. ETag строится по времени изменения и размеру файла,
+// поэтому браузер может проверить свежесть файла условным запросом.
+// У встроенных в бинарный файл файлов времени изменения нет, и ETag
+// для них - хеш содержимого. Такие файлы не меняются, пока работает
+// сервер, поэтому хеш считается один раз на файл.
+func staticHandler(root http.FileSystem) http.Handler {
+	var hashes sync.Map // путь файла -> ETag по его содержимому
+	return http.StripPrefix("/static/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := path.Clean("/" + r.URL.Path)
+		f, err := root.Open(name)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		defer f.Close()
+		st, err := f.Stat()
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		if st.IsDir() {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		etag := fmt.Sprintf(`"%x-%x"`, st.ModTime().UnixNano(), st.Size())
+		if st.ModTime().IsZero() {
+			if cached, ok := hashes.Load(name); ok {
+				etag = cached.(string)
+			} else {
+				if etag, err = contentETag(f); err != nil {
+					serverError(w, err)
+					return
+				}
+				hashes.Store(name, etag)
+			}
+		}
+		w.Header().Set("Cache-Control", "public, max-age=86400")
+		w.Header().Set("ETag", etag)
+		// ServeContent выставляет Content-Type по расширению и сам
+		// отвечает 304 на If-None-Match и If-Modified-Since.
+		http.ServeContent(w, r, st.Name(), st.ModTime(), f)
+	}))
+}
+
+// contentETag возвращает ETag по хешу содержимого f и перематывает
+// f в начало, чтобы его можно было отдать.
+func contentETag(f http.File) (string, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf(`"%x"`, h.Sum(nil)[:16]), nil
+}
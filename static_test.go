@@ -0,0 +1,131 @@
+package main
+
+import (
+	"io/fs"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestStaticHandler(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "img"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "app.js"), []byte("console.log(1)"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	embedded, err := fs.Sub(embeddedAssets, "static")
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := map[string]http.FileSystem{"disk": http.Dir(dir), "embedded": http.FS(embedded)}
+	tests := []struct {
+		root, target string
+		want         int
+		wantType     string
+	}{
+		{"disk", "/static/app.js", http.StatusOK, "javascript"},
+		{"disk", "/static/missing.css", http.StatusNotFound, ""},
+		{"disk", "/static/img/", http.StatusForbidden, ""},
+		{"disk", "/static/img", http.StatusForbidden, ""},
+		{"disk", "/static/../static_test.go", http.StatusNotFound, ""},
+		{"embedded", "/static/style.css", http.StatusOK, "text/css"},
+		{"embedded", "/static/", http.StatusForbidden, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.root+" "+tt.target, func(t *testing.T) {
+			h := staticHandler(roots[tt.root])
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.target, nil))
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d", w.Code, tt.want)
+			}
+			if tt.want != http.StatusOK {
+				return
+			}
+			if ct := w.Header().Get("Content-Type"); !strings.Contains(ct, tt.wantType) {
+				t.Errorf("Content-Type = %q, want %s", ct, tt.wantType)
+			}
+			if cc := w.Header().Get("Cache-Control"); cc != "public, max-age=86400" {
+				t.Errorf("Cache-Control = %q", cc)
+			}
+			etag := w.Header().Get("ETag")
+			if etag == "" {
+				t.Fatal("no ETag")
+			}
+			r := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			r.Header.Set("If-None-Match", etag)
+			w = httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if w.Code != http.StatusNotModified {
+				t.Errorf("conditional request: status = %d, want 304", w.Code)
+			}
+		})
+	}
+}
+
+// readCountingFS считает чтения из открытых файлов.
+type readCountingFS struct {
+	http.FileSystem
+	reads *int32
+}
+
+func (fsys readCountingFS) Open(name string) (http.File, error) {
+	f, err := fsys.FileSystem.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return readCountingFile{f, fsys.reads}, nil
+}
+
+type readCountingFile struct {
+	http.File
+	reads *int32
+}
+
+func (f readCountingFile) Read(p []byte) (int, error) {
+	atomic.AddInt32(f.reads, 1)
+	return f.File.Read(p)
+}
+
+// Хеш встроенного файла считается только на первом запросе: условный
+// запрос после него отвечает 304, не читая файл.
+func TestStaticEmbeddedETagCached(t *testing.T) {
+	embedded, err := fs.Sub(embeddedAssets, "static")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reads int32
+	h := staticHandler(readCountingFS{http.FS(embedded), &reads})
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/static/style.css", nil))
+	want, err := fs.ReadFile(embedded, "style.css")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusOK || w.Body.String() != string(want) {
+		t.Fatalf("status = %d, body of %d bytes; want 200 with the whole file", w.Code, w.Body.Len())
+	}
+	etag := w.Header().Get("ETag")
+
+	atomic.StoreInt32(&reads, 0)
+	for i := 0; i < 3; i++ {
+		r := httptest.NewRequest(http.MethodGet, "/static/style.css", nil)
+		r.Header.Set("If-None-Match", etag)
+		w = httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != http.StatusNotModified || w.Header().Get("ETag") != etag {
+			t.Fatalf("request %d: status = %d, ETag = %q; want 304 with %q", i, w.Code, w.Header().Get("ETag"), etag)
+		}
+	}
+	if n := atomic.LoadInt32(&reads); n != 0 {
+		t.Errorf("conditional requests read the file %d times, want the cached hash", n)
+	}
+}
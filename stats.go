@@ -0,0 +1,99 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+)
+
+// popularSize - сколько страниц показывает /popular.
+const popularSize = 10
+
+// CountView увеличивает счетчик просмотров страницы title и возвращает
+// новое значение. Чтение и запись файла метаданных идут под блокировкой
+// страницы (см. Update), поэтому одновременные просмотры не теряются.
+func (s *MetaStore) CountView(title string) (uint64, error) {
+	var views uint64
+	err := s.Update(title, func(m *PageMeta) {
+		m.Views++
+		views = m.Views
+	})
+	return views, err
+}
+
+var apiStatsPath = regexp.MustCompile(`^/api/v1/pages/(` + titleChars + `)/stats$`)
+
+// apiStatsHandler отдает статистику страницы:
+// GET /api/v1/pages/{title}/stats -> {"views":N,"created_at":...,"updated_at":...}.
+func apiStatsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	m := apiStatsPath.FindStringSubmatch(r.URL.Path)
+	p, err := store.Load(m[1])
+	if errors.Is(err, os.ErrNotExist) {
+		writeJSONError(w, http.StatusNotFound, "page not found")
+		return
+	}
+	if err != nil {
+		serverError(w, err)
+		return
+	}
+	if ok, err := canRead(r, p.Title); err != nil || !ok {
+		if err != nil {
+			serverError(w, err)
+		} else {
+			writeJSONError(w, http.StatusUnauthorized, "authentication required")
+		}
+		return
+	}
+	meta, err := metas.Load(p.Title)
+	if err != nil {
+		serverError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"views":      meta.Views,
+		"created_at": optionalTime(p.CreatedAt),
+		"updated_at": optionalTime(p.UpdatedAt),
+	})
+}
+
+// pageViews - строка списка /popular.
+type pageViews struct {
+	Title string
+	Views uint64
+}
+
+// popularHandler показывает popularSize самых просматриваемых страниц,
+// из тех, что видны пользователю.
+func popularHandler(w http.ResponseWriter, r *http.Request) {
+	titles, err := store.List()
+	if err == nil {
+		titles, err = visibleTitles(r, titles)
+	}
+	if err != nil {
+		errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	var list []pageViews
+	for _, t := range titles {
+		meta, err := metas.Load(t)
+		if err != nil {
+			errorHandler(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if meta.Views > 0 {
+			list = append(list, pageViews{Title: t, Views: meta.Views})
+		}
+	}
+	sort.SliceStable(list, func(i, j int) bool { return list[i].Views > list[j].Views })
+	if len(list) > popularSize {
+		list = list[:popularSize]
+	}
+	renderTemplate(w, "popular", struct{ Pages []pageViews }{list})
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// Просмотр засчитывается только за отданную HTML-страницу.
+func TestViewCountsOnlyRenderedPages(t *testing.T) {
+	testDataDir(t)
+	savePage(t, "Foo", "text")
+	if err := metas.Update("Foo", func(m *PageMeta) { m.Public = true }); err != nil {
+		t.Fatal(err)
+	}
+	view := func(header, value string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/view/Foo", nil)
+		if header != "" {
+			r.Header.Set(header, value)
+		}
+		w := httptest.NewRecorder()
+		makeHandler(pageResourceHandler)(w, r)
+		return w
+	}
+	etag := view("", "").Header().Get("ETag")
+	tests := []struct {
+		name, header, value string
+		wantStatus          int
+		wantViews           uint64
+	}{
+		{"html", "", "", http.StatusOK, 2},
+		{"json", "Accept", "application/json", http.StatusOK, 2},
+		{"not modified", "If-None-Match", etag, http.StatusNotModified, 2},
+		{"html again", "", "", http.StatusOK, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := view(tt.header, tt.value); w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			meta, err := metas.Load("Foo")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if meta.Views != tt.wantViews {
+				t.Errorf("views = %d, want %d", meta.Views, tt.wantViews)
+			}
+		})
+	}
+}
+
+// Одновременные просмотры не теряют приращений счетчика.
+func TestViewCountConcurrent(t *testing.T) {
+	testDataDir(t)
+	savePage(t, "Foo", "text")
+	if err := metas.Update("Foo", func(m *PageMeta) { m.Public = true }); err != nil {
+		t.Fatal(err)
+	}
+	const n = 100
+	codes := make(chan int, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w := httptest.NewRecorder()
+			makeHandler(pageResourceHandler)(w, httptest.NewRequest(http.MethodGet, "/view/Foo", nil))
+			codes <- w.Code
+		}()
+	}
+	wg.Wait()
+	close(codes)
+	for code := range codes {
+		if code != http.StatusOK {
+			t.Fatalf("status = %d, want %d", code, http.StatusOK)
+		}
+	}
+	meta, err := metas.Load("Foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.Views != n {
+		t.Errorf("views = %d, want %d", meta.Views, n)
+	}
+}
@@ -0,0 +1,394 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// Storage - хранилище страниц. Обработчики работают только через
+// этот интерфейс, поэтому файлы можно заменить базой данных.
+// Load для несуществующей страницы возвращает ошибку, для которой
+// errors.Is(err, os.ErrNotExist) истинно.
+type Storage interface {
+	Load(title string) (*Page, error)
+	// Save с p.Create возвращает errPageExists, если страница уже есть.
+	Save(p *Page) error
+	List() ([]string, error)
+	Delete(title string) error
+	// Rename меняет заголовок страницы. Если страница newTitle уже
+	// есть, возвращается errPageExists.
+	Rename(oldTitle, newTitle string) error
+	// Health возвращает ошибку, если хранилище сейчас неработоспособно.
+	Health() error
+}
+
+// store - хранилище, с которым работают обработчики. main заменяет
+// его в зависимости от WEB_STORAGE_BACKEND.
+var store Storage = &FileStorage{}
+
+// FileStorage хранит каждую страницу в файле <title>.txt в каталоге
+// Dir (пустой Dir - текущий каталог), прошлые версии - в истории
+// versions, а удаленные страницы - в корзине trash.
+type FileStorage struct {
+	Dir string
+}
+
+// dataSubdirs - подкаталоги, которые NewFileStorage создает в каталоге
+// данных.
+var dataSubdirs = []string{"history", "trash", "comments", "static"}
+
+// NewFileStorage создает хранилище в каталоге baseDir вместе с его
+// подкаталогами. Ошибка возвращается, если каталог нельзя создать
+// или в него нельзя писать.
+func NewFileStorage(baseDir string) (*FileStorage, error) {
+	if err := os.MkdirAll(baseDir, 0750); err != nil {
+		return nil, err
+	}
+	for _, sub := range dataSubdirs {
+		if err := os.MkdirAll(filepath.Join(baseDir, sub), 0750); err != nil {
+			return nil, err
+		}
+	}
+	s := &FileStorage{Dir: baseDir}
+	if err := s.Health(); err != nil {
+		return nil, fmt.Errorf("data directory %s is not writable: %w", baseDir, err)
+	}
+	return s, nil
+}
+
+// useDataDir переносит в каталог dir все файлы сервера, которые не
+// относятся к самим страницам: историю, корзину, комментарии,
+// метаданные, slug, переадресации, ссылки, журнал аудита.
+func useDataDir(dir string) {
+	versions.Dir = filepath.Join(dir, "history")
+	trash.Dir = filepath.Join(dir, "trash")
+	trash.Pages = dir
+	comments.Dir = filepath.Join(dir, "comments")
+	metas.Dir = dir
+	slugs.Dir = dir
+	redirects.Path = filepath.Join(dir, "redirects.json")
+	shares.Path = filepath.Join(dir, "shares.json")
+	verifications.Path = filepath.Join(dir, "verifications.json")
+	profiles.Dir = filepath.Join(dir, "users")
+	auditLog.Path = filepath.Join(dir, "audit.log")
+}
+
+func (s *FileStorage) path(title string) string {
+	return filepath.Join(s.Dir, normalizeTitle(title)+".txt")
+}
+
+func (s *FileStorage) Load(title string) (*Page, error) {
+	return loadPage(s.path(title), title)
+}
+
+func (s *FileStorage) Save(p *Page) error {
+	p.Title = normalizeTitle(p.Title)
+	if err := validateTitle(p.Title); err != nil {
+		return err
+	}
+	setFrontmatter(p)
+	if int64(len(p.Body)) > maxPageSize {
+		return errPageTooLarge
+	}
+	return p.save(s.path(p.Title))
+}
+
+// List возвращает заголовки всех страниц, то есть файлов *.txt
+// с допустимым именем.
+func (s *FileStorage) List() ([]string, error) {
+	dir := s.Dir
+	if dir == "" {
+		dir = "."
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var titles []string
+	for _, f := range files {
+		// Файловая система может вернуть имя в другой форме
+		// (macOS хранит NFD), поэтому оно нормализуется.
+		title := normalizeTitle(strings.TrimSuffix(f.Name(), ".txt"))
+		if f.Mode().IsRegular() && title != f.Name() && validTitle.MatchString(title) {
+			titles = append(titles, title)
+		}
+	}
+	return titles, nil
+}
+
+// Delete не стирает файл, а перемещает его в корзину, откуда
+// страницу можно восстановить.
+func (s *FileStorage) Delete(title string) error {
+	return withPageLock(title, func() error {
+		_, err := trash.Put(title)
+		return err
+	})
+}
+
+// withPageLocks удерживает блокировки двух страниц сразу. Они всегда
+// берутся в порядке заголовков, чтобы два встречных переименования
+// не ждали друг друга вечно.
+func withPageLocks(a, b string, fn func() error) error {
+	if b < a {
+		a, b = b, a
+	}
+	return withPageLock(a, func() error {
+		return withPageLock(b, fn)
+	})
+}
+
+// Rename переименовывает файл страницы, а вместе с ним и ее историю.
+func (s *FileStorage) Rename(oldTitle, newTitle string) error {
+	return withPageLocks(oldTitle, newTitle, func() error {
+		if _, err := os.Stat(s.path(newTitle)); err == nil {
+			return errPageExists
+		}
+		if err := os.Rename(s.path(oldTitle), s.path(newTitle)); err != nil {
+			return err
+		}
+		// История, оставшаяся от удаленной страницы с новым
+		// заголовком, к переименованной странице не относится: она
+		// удаляется, даже если своей истории у страницы нет.
+		if err := os.Remove(versions.path(newTitle)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		err := os.Rename(versions.path(oldTitle), versions.path(newTitle))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	})
+}
+
+// Health проверяет, что в каталог страниц можно писать.
+func (s *FileStorage) Health() error {
+	f, err := ioutil.TempFile(s.Dir, ".healthcheck*")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+// SQLiteStorage хранит страницы в таблице pages базы SQLite.
+// Используется драйвер modernc.org/sqlite, которому не нужен CGo.
+// История версий для этого хранилища не ведется.
+type SQLiteStorage struct {
+	db *sql.DB
+}
+
+// NewSQLiteStorage открывает (или создает) базу по пути path и
+// создает таблицу pages, если ее еще нет. Путь ":memory:" дает
+// базу в памяти.
+func NewSQLiteStorage(path string) (*SQLiteStorage, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	if path == ":memory:" {
+		// Каждое соединение получило бы свою пустую базу в памяти,
+		// поэтому все запросы идут через одно соединение.
+		db.SetMaxOpenConns(1)
+	}
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS pages (
+		title    TEXT PRIMARY KEY,
+		body     BLOB NOT NULL,
+		modified INTEGER NOT NULL DEFAULT 0
+	)`)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	// В базах, созданных до появления столбца modified, его нужно
+	// добавить; если столбец уже есть, SQLite вернет ошибку, и это
+	// нормально.
+	db.Exec(`ALTER TABLE pages ADD COLUMN modified INTEGER NOT NULL DEFAULT 0`)
+	return &SQLiteStorage{db: db}, nil
+}
+
+func (s *SQLiteStorage) Load(title string) (*Page, error) {
+	title = normalizeTitle(title)
+	var body []byte
+	var modified int64
+	err := s.db.QueryRow(`SELECT body, modified FROM pages WHERE title = ?`, title).Scan(&body, &modified)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("page %q: %w", title, os.ErrNotExist)
+	}
+	if err != nil {
+		return nil, err
+	}
+	meta, _ := parseFrontmatter(body)
+	p := &Page{Title: title, Body: body, Meta: meta}
+	if modified != 0 {
+		p.Modified = time.Unix(0, modified)
+	}
+	return p, nil
+}
+
+func (s *SQLiteStorage) Save(p *Page) error {
+	p.Title = normalizeTitle(p.Title)
+	if err := validateTitle(p.Title); err != nil {
+		return err
+	}
+	setFrontmatter(p)
+	if int64(len(p.Body)) > maxPageSize {
+		return errPageTooLarge
+	}
+	if p.Create {
+		res, err := s.db.Exec(`INSERT INTO pages (title, body, modified) VALUES (?, ?, ?)
+			ON CONFLICT (title) DO NOTHING`,
+			p.Title, p.Body, time.Now().UnixNano())
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err == nil && n == 0 {
+			return errPageExists
+		}
+		return err
+	}
+	_, err := s.db.Exec(`INSERT INTO pages (title, body, modified) VALUES (?, ?, ?)
+		ON CONFLICT (title) DO UPDATE SET body = excluded.body, modified = excluded.modified`,
+		p.Title, p.Body, time.Now().UnixNano())
+	return err
+}
+
+func (s *SQLiteStorage) List() ([]string, error) {
+	rows, err := s.db.Query(`SELECT title FROM pages ORDER BY title`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var titles []string
+	for rows.Next() {
+		var title string
+		if err := rows.Scan(&title); err != nil {
+			return nil, err
+		}
+		titles = append(titles, title)
+	}
+	return titles, rows.Err()
+}
+
+func (s *SQLiteStorage) Delete(title string) error {
+	res, err := s.db.Exec(`DELETE FROM pages WHERE title = ?`, title)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("page %q: %w", title, os.ErrNotExist)
+	}
+	return err
+}
+
+func (s *SQLiteStorage) Rename(oldTitle, newTitle string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	var n int
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM pages WHERE title = ?`, newTitle).Scan(&n); err != nil {
+		return err
+	}
+	if n > 0 {
+		return errPageExists
+	}
+	res, err := tx.Exec(`UPDATE pages SET title = ? WHERE title = ?`, newTitle, oldTitle)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("page %q: %w", oldTitle, os.ErrNotExist)
+	}
+	return tx.Commit()
+}
+
+// Health запускает PRAGMA integrity_check и возвращает ошибку,
+// если база повреждена или недоступна.
+func (s *SQLiteStorage) Health() error {
+	var res string
+	if err := s.db.QueryRow(`PRAGMA integrity_check`).Scan(&res); err != nil {
+		return err
+	}
+	if res != "ok" {
+		return fmt.Errorf("integrity check: %s", res)
+	}
+	return nil
+}
+
+// Close закрывает базу данных.
+func (s *SQLiteStorage) Close() error {
+	return s.db.Close()
+}
+
+// timestampStorage дополняет любое хранилище временем создания
+// и последнего сохранения страниц, которое хранится в метаданных
+// metas. Для страниц, сохраненных до появления этих полей, UpdatedAt -
+// время изменения из хранилища, а CreatedAt неизвестно.
+type timestampStorage struct {
+	Storage
+}
+
+func (s timestampStorage) Load(title string) (*Page, error) {
+	p, err := s.Storage.Load(title)
+	if err != nil {
+		return nil, err
+	}
+	m, err := metas.Load(title)
+	if err != nil {
+		return nil, err
+	}
+	p.CreatedAt, p.UpdatedAt = m.CreatedAt, m.UpdatedAt
+	p.OriginalAuthor, p.LastEditor = m.OriginalAuthor, m.LastEditor
+	if p.UpdatedAt.IsZero() {
+		p.UpdatedAt = p.Modified
+	}
+	return p, nil
+}
+
+// Save сохраняет страницу и отмечает в метаданных время и автора
+// (p.LastEditor): при первом сохранении - CreatedAt и OriginalAuthor,
+// при каждом - UpdatedAt и LastEditor.
+func (s timestampStorage) Save(p *Page) error {
+	if err := s.Storage.Save(p); err != nil {
+		return err
+	}
+	now := time.Now()
+	return metas.Update(p.Title, func(m *PageMeta) {
+		if m.CreatedAt.IsZero() {
+			m.CreatedAt = now
+			m.OriginalAuthor = p.LastEditor
+		}
+		m.UpdatedAt = now
+		m.LastEditor = p.LastEditor
+		p.CreatedAt, p.UpdatedAt = m.CreatedAt, m.UpdatedAt
+		p.OriginalAuthor = m.OriginalAuthor
+	})
+}
+
+// openStorage создает хранилище по имени backend: "file" (по
+// умолчанию) в каталоге dataDir или "sqlite" с базой по пути
+// sqlitePath, а если он пуст - в dataDir/wiki.db.
+func openStorage(backend, dataDir, sqlitePath string) (Storage, error) {
+	switch backend {
+	case "", "file":
+		return NewFileStorage(dataDir)
+	case "sqlite":
+		if err := os.MkdirAll(dataDir, 0750); err != nil {
+			return nil, err
+		}
+		if sqlitePath == "" {
+			sqlitePath = filepath.Join(dataDir, "wiki.db")
+		}
+		return NewSQLiteStorage(sqlitePath)
+	}
+	return nil, fmt.Errorf("unknown storage backend %q", backend)
+}
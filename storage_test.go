@@ -0,0 +1,334 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestSQLiteStorage(t *testing.T) *SQLiteStorage {
+	t.Helper()
+	s, err := NewSQLiteStorage(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestSQLiteStorageSave(t *testing.T) {
+	s := newTestSQLiteStorage(t)
+	tests := []struct {
+		name    string
+		page    Page
+		wantErr error
+	}{
+		{"create", Page{Title: "Foo", Body: []byte("first")}, nil},
+		{"upsert", Page{Title: "Foo", Body: []byte("second")}, nil},
+		{"other page", Page{Title: "Bar", Body: []byte("bar")}, nil},
+		{"too large", Page{Title: "Big", Body: []byte(strings.Repeat("x", int(maxPageSize)+1))}, errPageTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := tt.page
+			if err := s.Save(&p); err != tt.wantErr {
+				t.Fatalf("Save error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+			got, err := s.Load(p.Title)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got.Body) != string(tt.page.Body) || got.Modified.IsZero() {
+				t.Errorf("Load = %q (modified %v), want %q", got.Body, got.Modified, tt.page.Body)
+			}
+		})
+	}
+	if err := s.Save(&Page{Title: "bad/title"}); err == nil {
+		t.Error("Save accepted an invalid title")
+	}
+	titles, err := s.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(titles, ",") != "Bar,Foo" {
+		t.Errorf("List = %v, want [Bar Foo]", titles)
+	}
+}
+
+func TestSQLiteStorageErrors(t *testing.T) {
+	s := newTestSQLiteStorage(t)
+	if err := s.Save(&Page{Title: "Foo", Body: []byte("foo")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Save(&Page{Title: "Bar", Body: []byte("bar")}); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		op   func() error
+		want error
+	}{
+		{"load missing", func() error { _, err := s.Load("Missing"); return err }, os.ErrNotExist},
+		{"delete missing", func() error { return s.Delete("Missing") }, os.ErrNotExist},
+		{"rename missing", func() error { return s.Rename("Missing", "Other") }, os.ErrNotExist},
+		{"rename onto existing", func() error { return s.Rename("Foo", "Bar") }, errPageExists},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.op(); !errors.Is(err, tt.want) {
+				t.Errorf("error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	// Ошибки самой базы доходят до вызывающего как есть.
+	s.Close()
+	if _, err := s.Load("Foo"); err == nil || errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Load on closed database: error = %v, want a database error", err)
+	}
+	if err := s.Save(&Page{Title: "Foo", Body: []byte("x")}); err == nil {
+		t.Error("Save on closed database succeeded")
+	}
+	if err := s.Health(); err == nil {
+		t.Error("Health on closed database succeeded")
+	}
+}
+
+func TestSQLiteStorageConcurrentReads(t *testing.T) {
+	s := newTestSQLiteStorage(t)
+	if err := s.Save(&Page{Title: "Foo", Body: []byte("shared")}); err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	errs := make(chan error, 50)
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p, err := s.Load("Foo")
+			if err == nil && string(p.Body) != "shared" {
+				err = errors.New("unexpected body " + string(p.Body))
+			}
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+// storageBackends - реализации Storage, которые проходят общий набор
+// проверок в TestStorageSuite.
+var storageBackends = []struct {
+	name string
+	open func(t *testing.T) Storage
+}{
+	{"file", func(t *testing.T) Storage {
+		s, err := NewFileStorage(testDataDir(t))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}},
+	{"sqlite", func(t *testing.T) Storage {
+		testDataDir(t)
+		return newTestSQLiteStorage(t)
+	}},
+}
+
+func TestStorageSuite(t *testing.T) {
+	for _, b := range storageBackends {
+		t.Run(b.name, func(t *testing.T) {
+			s := b.open(t)
+			save := func(title, body string) {
+				t.Helper()
+				if err := s.Save(&Page{Title: title, Body: []byte(body)}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			body := func(title string) string {
+				t.Helper()
+				p, err := s.Load(title)
+				if err != nil {
+					t.Fatalf("Load(%s): %v", title, err)
+				}
+				return string(p.Body)
+			}
+
+			if _, err := s.Load("Foo"); !errors.Is(err, os.ErrNotExist) {
+				t.Errorf("Load of a missing page: error = %v, want os.ErrNotExist", err)
+			}
+			save("Foo", "first")
+			save("Foo", "second")
+			save("Bar", "bar")
+			if got := body("Foo"); got != "second" {
+				t.Errorf("Foo = %q after overwrite, want second", got)
+			}
+			if titles, err := s.List(); err != nil || strings.Join(titles, ",") != "Bar,Foo" {
+				t.Errorf("List = %v, %v; want [Bar Foo]", titles, err)
+			}
+
+			if err := s.Save(&Page{Title: "Foo", Body: []byte("third"), Create: true}); err != errPageExists {
+				t.Errorf("Save with Create over an existing page: error = %v, want errPageExists", err)
+			}
+			if got := body("Foo"); got != "second" {
+				t.Errorf("Foo = %q after a refused create, want second", got)
+			}
+			if err := s.Save(&Page{Title: "New", Body: []byte("new"), Create: true}); err != nil {
+				t.Errorf("Save with Create of a new page: %v", err)
+			}
+			for _, p := range []*Page{
+				{Title: "bad/title"},
+				{Title: "Big", Body: []byte(strings.Repeat("x", int(maxPageSize)+1))},
+			} {
+				if err := s.Save(p); err == nil {
+					t.Errorf("Save(%.20q) succeeded, want an error", p.Title)
+				}
+			}
+
+			if err := s.Rename("Bar", "Foo"); err != errPageExists {
+				t.Errorf("Rename onto an existing page: error = %v, want errPageExists", err)
+			}
+			if err := s.Rename("Bar", "Baz"); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := s.Load("Bar"); !errors.Is(err, os.ErrNotExist) {
+				t.Errorf("Load of the old title after rename: error = %v, want os.ErrNotExist", err)
+			}
+			if got := body("Baz"); got != "bar" {
+				t.Errorf("Baz = %q after rename, want bar", got)
+			}
+
+			if err := s.Delete("Foo"); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := s.Load("Foo"); !errors.Is(err, os.ErrNotExist) {
+				t.Errorf("Load after delete: error = %v, want os.ErrNotExist", err)
+			}
+			if err := s.Delete("Foo"); !errors.Is(err, os.ErrNotExist) {
+				t.Errorf("Delete of a missing page: error = %v, want os.ErrNotExist", err)
+			}
+			if titles, err := s.List(); err != nil || strings.Join(titles, ",") != "Baz,New" {
+				t.Errorf("List = %v, %v; want [Baz New]", titles, err)
+			}
+			if err := s.Health(); err != nil {
+				t.Errorf("Health: %v", err)
+			}
+		})
+	}
+}
+
+func TestTimestampStorage(t *testing.T) {
+	testDataDir(t)
+	store = timestampStorage{store}
+
+	savePage(t, "Foo", "first")
+	first, err := store.Load("Foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.CreatedAt.IsZero() || !first.UpdatedAt.Equal(first.CreatedAt) {
+		t.Fatalf("after the first save CreatedAt = %v, UpdatedAt = %v; want both set and equal", first.CreatedAt, first.UpdatedAt)
+	}
+	time.Sleep(10 * time.Millisecond)
+	savePage(t, "Foo", "second")
+	second, err := store.Load("Foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !second.CreatedAt.Equal(first.CreatedAt) {
+		t.Errorf("CreatedAt changed on the second save: %v -> %v", first.CreatedAt, second.CreatedAt)
+	}
+	if !second.UpdatedAt.After(first.UpdatedAt) {
+		t.Errorf("UpdatedAt did not advance on the second save: %v -> %v", first.UpdatedAt, second.UpdatedAt)
+	}
+
+	// API отдает оба времени.
+	w := serve(apiGetPage, http.MethodGet, "/api/v1/pages/Foo", "")
+	var p struct {
+		CreatedAt time.Time `json:"created_at"`
+		UpdatedAt time.Time `json:"updated_at"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&p); err != nil {
+		t.Fatal(err)
+	}
+	if !p.CreatedAt.Equal(second.CreatedAt) || !p.UpdatedAt.Equal(second.UpdatedAt) {
+		t.Errorf("API times = %v, %v; want %v, %v", p.CreatedAt, p.UpdatedAt, second.CreatedAt, second.UpdatedAt)
+	}
+
+	// У страницы, сохраненной в обход metas, временем изменения
+	// считается время из хранилища.
+	if err := store.(timestampStorage).Storage.Save(&Page{Title: "Legacy", Body: []byte("old")}); err != nil {
+		t.Fatal(err)
+	}
+	legacy, err := store.Load("Legacy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !legacy.CreatedAt.IsZero() || !legacy.UpdatedAt.Equal(legacy.Modified) {
+		t.Errorf("legacy page CreatedAt = %v, UpdatedAt = %v; want zero and the modification time %v", legacy.CreatedAt, legacy.UpdatedAt, legacy.Modified)
+	}
+}
+
+func TestModifiedTime(t *testing.T) {
+	for _, b := range storageBackends {
+		t.Run(b.name, func(t *testing.T) {
+			s := b.open(t)
+			before := time.Now().Add(-time.Second)
+			if err := s.Save(&Page{Title: "Foo", Body: []byte("foo")}); err != nil {
+				t.Fatal(err)
+			}
+			p, err := s.Load("Foo")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if p.Modified.Before(before) || p.Modified.After(time.Now().Add(time.Second)) {
+				t.Errorf("Modified = %v, want about now", p.Modified)
+			}
+		})
+	}
+}
+
+// /view/ показывает время изменения, а у страницы, сохраненной
+// до появления метаданных, - время из хранилища.
+func TestViewShowsModifiedTime(t *testing.T) {
+	dir := testDataDir(t)
+	store = timestampStorage{store}
+	if err := store.(timestampStorage).Storage.Save(&Page{Title: "Legacy", Body: []byte("old")}); err != nil {
+		t.Fatal(err)
+	}
+	mod := time.Date(2023, time.May, 17, 9, 30, 0, 0, time.Local)
+	if err := os.Chtimes(filepath.Join(dir, "Legacy.txt"), mod, mod); err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	makeHandler(pageResourceHandler)(w, httptest.NewRequest(http.MethodGet, "/view/Legacy", nil))
+	body := w.Body.String()
+	if !strings.Contains(body, "Last edited 2023-05-17 09:30") {
+		t.Errorf("view has no modification time:\n%s", body)
+	}
+	if strings.Contains(body, "Created ") {
+		t.Errorf("view shows an unknown creation time:\n%s", body)
+	}
+
+	// Новой странице нечего показывать: форма правки без времени.
+	w = httptest.NewRecorder()
+	makeHandler(editHandler)(w, httptest.NewRequest(http.MethodGet, "/edit/New", nil))
+	if strings.Contains(w.Body.String(), "Last edited") || strings.Contains(w.Body.String(), "0001-01-01") {
+		t.Errorf("edit form of a new page shows a time:\n%s", w.Body)
+	}
+}
@@ -0,0 +1,369 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PageMeta - метаданные страницы, которые хранятся отдельно от ее
+// текста в файле {title}.meta.json рядом с {title}.txt.
+type PageMeta struct {
+	Tags []string `json:"tags"`
+	// Public - видна ли страница без входа. Страницы без файла
+	// метаданных или без этого поля открыты всем.
+	Public bool `json:"public"`
+	// CreatedAt и UpdatedAt - время первого и последнего сохранения
+	// страницы. В отличие от времени изменения файла, они не меняются
+	// при копировании файлов.
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	// Views - сколько раз страницу открывали в /view/ (см. CountView).
+	Views uint64 `json:"views"`
+	// OriginalAuthor - кто сохранил страницу первым, LastEditor -
+	// кто последним (см. timestampStorage). Пусто, если страницу
+	// сохранили без входа или до появления этих полей.
+	OriginalAuthor string `json:"original_author,omitempty"`
+	LastEditor     string `json:"last_editor,omitempty"`
+	// Title не хранится в файле, его заполняет pagesByAuthor.
+	Title string `json:"-"`
+}
+
+// MetaStore читает и пишет файлы метаданных страниц в каталоге Dir.
+// Метаданные не зависят от хранилища страниц и остаются в файлах
+// даже при WEB_STORAGE_BACKEND=sqlite.
+type MetaStore struct {
+	Dir string
+}
+
+var metas = &MetaStore{Dir: "."}
+
+const metaSuffix = ".meta.json"
+
+func (s *MetaStore) path(title string) string {
+	return filepath.Join(s.Dir, title+metaSuffix)
+}
+
+// lockKey отделяет блокировку метаданных от блокировки самой страницы.
+func (s *MetaStore) lockKey(title string) string {
+	return "meta/" + title
+}
+
+func (s *MetaStore) read(title string) (*PageMeta, error) {
+	m := &PageMeta{Public: true}
+	data, err := ioutil.ReadFile(s.path(title))
+	if os.IsNotExist(err) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return m, json.Unmarshal(data, m)
+}
+
+// Load возвращает метаданные страницы title. Если файла метаданных
+// нет, возвращаются метаданные по умолчанию без ошибки.
+func (s *MetaStore) Load(title string) (*PageMeta, error) {
+	var m *PageMeta
+	err := withPageRLock(s.lockKey(title), func() error {
+		var err error
+		m, err = s.read(title)
+		return err
+	})
+	return m, err
+}
+
+// Update загружает метаданные страницы title, меняет их функцией fn
+// и записывает обратно. Одновременные Update одной страницы
+// выполняются по очереди.
+func (s *MetaStore) Update(title string, fn func(*PageMeta)) error {
+	return withPageLock(s.lockKey(title), func() error {
+		m, err := s.read(title)
+		if err != nil {
+			return err
+		}
+		tags := m.Tags
+		fn(m)
+		if !equalTags(tags, m.Tags) {
+			tagIndexCache.Invalidate()
+		}
+		data, err := json.Marshal(m)
+		if err != nil {
+			return err
+		}
+		return writeFileAtomic(s.path(title), data, pageFileMode)
+	})
+}
+
+// Rename переносит метаданные страницы oldTitle на newTitle.
+// Отсутствие метаданных у oldTitle ошибкой не считается.
+func (s *MetaStore) Rename(oldTitle, newTitle string) error {
+	err := os.Rename(s.path(oldTitle), s.path(newTitle))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// normalizeTags приводит теги к нижнему регистру, обрезает пробелы,
+// выбрасывает пустые и повторяющиеся и сортирует результат.
+func normalizeTags(tags []string) []string {
+	seen := make(map[string]bool)
+	var out []string
+	for _, t := range tags {
+		t = strings.ToLower(strings.TrimSpace(t))
+		if t == "" || seen[t] {
+			continue
+		}
+		seen[t] = true
+		out = append(out, t)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// tagIndex просматривает файлы *.meta.json в каталоге dataDir
+// и возвращает для каждого тега отсортированный список страниц с ним.
+func tagIndex(dataDir string) (map[string][]string, error) {
+	files, err := filepath.Glob(filepath.Join(dataDir, "*"+metaSuffix))
+	if err != nil {
+		return nil, err
+	}
+	index := make(map[string][]string)
+	for _, f := range files {
+		title := normalizeTitle(strings.TrimSuffix(filepath.Base(f), metaSuffix))
+		if !validTitle.MatchString(title) {
+			continue
+		}
+		data, err := ioutil.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		var m PageMeta
+		if err := json.Unmarshal(data, &m); err != nil {
+			return nil, err
+		}
+		for _, t := range m.Tags {
+			index[t] = append(index[t], title)
+		}
+	}
+	for _, titles := range index {
+		sort.Strings(titles)
+	}
+	return index, nil
+}
+
+var contentTag = regexp.MustCompile("^#[a-zA-Z0-9_-]+$")
+
+// contentTags разбирает строки вида "#tag1 #tag2" в начале body
+// и возвращает найденные теги и текст без этих строк. Разбор
+// останавливается на первой строке, где есть что-то кроме тегов.
+// Заголовок Markdown "# Title" тегом не считается из-за пробела.
+// Блок метаданных "---" перед тегами (см. parseFrontmatter) тоже
+// отрезается, поэтому в показанном тексте его нет.
+func contentTags(body []byte) ([]string, []byte) {
+	var tags []string
+	_, rest := parseFrontmatter(body)
+	for len(rest) > 0 {
+		line := rest
+		next := []byte(nil)
+		if i := bytes.IndexByte(rest, '\n'); i >= 0 {
+			line, next = rest[:i], rest[i+1:]
+		}
+		fields := strings.Fields(string(line))
+		if len(fields) == 0 {
+			break
+		}
+		for _, f := range fields {
+			if !contentTag.MatchString(f) {
+				return normalizeTags(tags), rest
+			}
+		}
+		for _, f := range fields {
+			tags = append(tags, f[1:])
+		}
+		rest = next
+	}
+	return normalizeTags(tags), bytes.TrimLeft(rest, "\r\n")
+}
+
+// pageTagsFor объединяет теги из метаданных страницы (поле tags формы)
+// и теги из строк "#tag" в начале ее текста.
+func pageTagsFor(p *Page, meta *PageMeta) []string {
+	tags, _ := contentTags(p.Body)
+	return normalizeTags(append(append([]string(nil), meta.Tags...), tags...))
+}
+
+// liveTagIndex - указатель тегов по страницам list: tagIndex по файлам
+// метаданных плюс теги из текста страниц. Страницы не из list
+// пропускаются: файл метаданных удаленной страницы остается, чтобы
+// теги вернулись вместе с ней из корзины, а закрытые страницы
+// не должны попадать в указатель для анонимных пользователей.
+func liveTagIndex(list []string) (map[string][]string, error) {
+	metaIndex, err := tagIndex(metas.Dir)
+	if err != nil {
+		return nil, err
+	}
+	titleTags := make(map[string][]string, len(list))
+	for _, t := range list {
+		titleTags[t] = nil
+	}
+	for tag, titles := range metaIndex {
+		for _, t := range titles {
+			if _, ok := titleTags[t]; ok {
+				titleTags[t] = append(titleTags[t], tag)
+			}
+		}
+	}
+	index := make(map[string][]string)
+	for _, title := range list {
+		p, err := store.Load(title)
+		if err != nil {
+			return nil, err
+		}
+		for _, tag := range pageTagsFor(p, &PageMeta{Tags: titleTags[title]}) {
+			index[tag] = append(index[tag], title)
+		}
+	}
+	for _, titles := range index {
+		sort.Strings(titles)
+	}
+	return index, nil
+}
+
+// TagIndexCache хранит указатель тегов всех страниц (см. liveTagIndex),
+// чтобы списку страниц на "/" и /tags не нужно было читать каждую
+// страницу на каждом запросе. Указатель строится при первом обращении
+// и сбрасывается, когда меняется любая страница (см. publishPageEvent)
+// или теги в ее метаданных (см. MetaStore.Update).
+type TagIndexCache struct {
+	mu    sync.Mutex
+	index map[string][]string
+	gen   uint64 // растет при каждом сбросе
+}
+
+var tagIndexCache = &TagIndexCache{}
+
+// Invalidate сбрасывает указатель; следующий Index построит его заново.
+func (c *TagIndexCache) Invalidate() {
+	c.mu.Lock()
+	c.index = nil
+	c.gen++
+	c.mu.Unlock()
+}
+
+// Index возвращает указатель тегов страниц list. Страницы не из list
+// (закрытые для автора запроса) из него выбрасываются. Указатель,
+// построенный, пока страницы менялись, не запоминается.
+func (c *TagIndexCache) Index(list []string) (map[string][]string, error) {
+	c.mu.Lock()
+	index, gen := c.index, c.gen
+	c.mu.Unlock()
+	if index == nil {
+		all, err := store.List()
+		if err != nil {
+			return nil, err
+		}
+		if index, err = liveTagIndex(all); err != nil {
+			return nil, err
+		}
+		c.mu.Lock()
+		if c.gen == gen {
+			c.index = index
+		}
+		c.mu.Unlock()
+	}
+	visible := make(map[string]bool, len(list))
+	for _, t := range list {
+		visible[t] = true
+	}
+	out := make(map[string][]string)
+	for tag, titles := range index {
+		for _, t := range titles {
+			if visible[t] {
+				out[tag] = append(out[tag], t)
+			}
+		}
+	}
+	return out, nil
+}
+
+func equalTags(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// tagCloud возвращает теги указателя index с числом страниц
+// в алфавитном порядке.
+func tagCloud(index map[string][]string) []tagCount {
+	var list []tagCount
+	for t, titles := range index {
+		list = append(list, tagCount{t, len(titles)})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Tag < list[j].Tag })
+	return list
+}
+
+// tagCount - строка списка тегов в tags.html.
+type tagCount struct {
+	Tag   string
+	Count int
+}
+
+var tagPath = regexp.MustCompile("^/tags?/([^/]+)$")
+
+// Функция tagsHandler показывает на /tags все теги с числом страниц,
+// а на /tags/{tag} (или /tag/{tag}) - страницы с этим тегом.
+// Теги сравниваются без учета регистра.
+func tagsHandler(w http.ResponseWriter, r *http.Request) {
+	var tag string
+	if r.URL.Path != "/tags" {
+		m := tagPath.FindStringSubmatch(r.URL.Path)
+		if m == nil {
+			notFoundHandler(w, r)
+			return
+		}
+		tag = strings.ToLower(m[1])
+	}
+	list, err := store.List()
+	if err == nil {
+		list, err = visibleTitles(r, list)
+	}
+	if err != nil {
+		errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	index, err := tagIndexCache.Index(list)
+	if err != nil {
+		errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if tag != "" {
+		titles, ok := index[tag]
+		if !ok {
+			notFoundHandler(w, r)
+			return
+		}
+		renderTemplate(w, "tag", struct {
+			Tag    string
+			Titles []string
+		}{tag, titles})
+		return
+	}
+	renderTemplate(w, "tags", struct{ Tags []tagCount }{tagCloud(index)})
+}
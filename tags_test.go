@@ -0,0 +1,219 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTagIndexCache(t *testing.T) {
+	testDataDir(t)
+	mem := newMemStorage()
+	mem.pages["A"] = []byte("#go #web\ntext")
+	mem.pages["B"] = []byte("#go\ntext")
+	mem.pages["C"] = []byte("no tags")
+	store = eventStorage{mem}
+	tagIndexCache.Invalidate()
+	t.Cleanup(tagIndexCache.Invalidate)
+
+	index, err := tagIndexCache.Index([]string{"A", "B", "C"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][]string{"go": {"A", "B"}, "web": {"A"}}
+	if !reflect.DeepEqual(index, want) {
+		t.Errorf("Index = %v, want %v", index, want)
+	}
+	loads := mem.loads
+
+	tests := []struct {
+		name      string
+		change    func()
+		list      []string
+		want      map[string][]string
+		wantLoads bool // указатель строится заново
+	}{
+		{
+			name: "cached",
+			list: []string{"A", "B", "C"},
+			want: map[string][]string{"go": {"A", "B"}, "web": {"A"}},
+		},
+		{
+			name: "hidden pages are filtered out",
+			list: []string{"B", "C"},
+			want: map[string][]string{"go": {"B"}},
+		},
+		{
+			name:      "saving a page rebuilds the index",
+			change:    func() { store.Save(&Page{Title: "C", Body: []byte("#web\n")}) },
+			list:      []string{"A", "B", "C"},
+			want:      map[string][]string{"go": {"A", "B"}, "web": {"A", "C"}},
+			wantLoads: true,
+		},
+		{
+			name:      "changing tags in metadata rebuilds the index",
+			change:    func() { metas.Update("B", func(m *PageMeta) { m.Tags = []string{"news"} }) },
+			list:      []string{"A", "B", "C"},
+			want:      map[string][]string{"go": {"A", "B"}, "news": {"B"}, "web": {"A", "C"}},
+			wantLoads: true,
+		},
+		{
+			name:   "counting views keeps the index",
+			change: func() { metas.CountView("A") },
+			list:   []string{"A", "B", "C"},
+			want:   map[string][]string{"go": {"A", "B"}, "news": {"B"}, "web": {"A", "C"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.change != nil {
+				tt.change()
+			}
+			index, err := tagIndexCache.Index(tt.list)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(index, tt.want) {
+				t.Errorf("Index = %v, want %v", index, tt.want)
+			}
+			if rebuilt := mem.loads != loads; rebuilt != tt.wantLoads {
+				t.Errorf("index rebuilt = %v, want %v", rebuilt, tt.wantLoads)
+			}
+			loads = mem.loads
+		})
+	}
+}
+
+func TestNormalizeTags(t *testing.T) {
+	tests := []struct {
+		name string
+		in   []string
+		want []string
+	}{
+		{"lowercase and trim", []string{" Go ", "WEB"}, []string{"go", "web"}},
+		{"duplicates", []string{"go", "Go", " go"}, []string{"go"}},
+		{"empty entries", []string{"", "  ", "go", ""}, []string{"go"}},
+		{"sorted", []string{"web", "api", "go"}, []string{"api", "go", "web"}},
+		{"nothing", []string{"", " "}, nil},
+		{"cyrillic", []string{"Вики", "вики"}, []string{"вики"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := normalizeTags(tt.in); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("normalizeTags(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTagIndexScan(t *testing.T) {
+	dir := testDataDir(t)
+	savePage(t, "A", "a")
+	savePage(t, "B", "b")
+	savePage(t, "NoMeta", "no metadata file")
+	for title, tags := range map[string][]string{"A": {"go", "web"}, "B": {"go"}} {
+		tags := tags
+		if err := metas.Update(title, func(m *PageMeta) { m.Tags = tags }); err != nil {
+			t.Fatal(err)
+		}
+	}
+	index, err := tagIndex(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string][]string{"go": {"A", "B"}, "web": {"A"}}; !reflect.DeepEqual(index, want) {
+		t.Errorf("tagIndex = %v, want %v", index, want)
+	}
+
+	// Страница без .meta.json просто не имеет тегов.
+	m, err := metas.Load("NoMeta")
+	if err != nil || len(m.Tags) != 0 || !m.Public {
+		t.Errorf("metadata of a page without a .meta.json = %+v, %v; want public and no tags", m, err)
+	}
+	if empty, err := tagIndex(t.TempDir()); err != nil || len(empty) != 0 {
+		t.Errorf("tagIndex of an empty directory = %v, %v; want empty", empty, err)
+	}
+}
+
+// Поле tags формы сохраняется нормализованным.
+func TestSaveNormalizesTags(t *testing.T) {
+	testDataDir(t)
+	w := postForm(makeHandler(saveHandler), "/save/Foo", url.Values{"body": {"text"}, "tags": {" Go, web,GO,, Web "}})
+	if w.Code != http.StatusFound {
+		t.Fatalf("save status = %d, want 302", w.Code)
+	}
+	m, err := metas.Load("Foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"go", "web"}; !reflect.DeepEqual(m.Tags, want) {
+		t.Errorf("saved tags = %q, want %q", m.Tags, want)
+	}
+}
+
+func TestContentTags(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		wantTags []string
+		wantBody string
+	}{
+		{"one line", "#go #Web\ntext", []string{"go", "web"}, "text"},
+		{"several lines", "#go\n#web #go\n\ntext", []string{"go", "web"}, "text"},
+		{"no tags", "text\n#go", nil, "text\n#go"},
+		{"markdown heading", "# Title\ntext", nil, "# Title\ntext"},
+		{"mixed line stops parsing", "#go and more\ntext", nil, "#go and more\ntext"},
+		{"tags only", "#go", []string{"go"}, ""},
+		{"after frontmatter", "---\nauthor: ivan\n---\n#go\ntext", []string{"go"}, "text"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tags, body := contentTags([]byte(tt.body))
+			if !reflect.DeepEqual(tags, tt.wantTags) || string(body) != tt.wantBody {
+				t.Errorf("contentTags(%q) = %q, %q; want %q, %q", tt.body, tags, body, tt.wantTags, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestTagsHandler(t *testing.T) {
+	testDataDir(t)
+	tagIndexCache.Invalidate()
+	t.Cleanup(tagIndexCache.Invalidate)
+	savePage(t, "A", "#Go #web\ntext")
+	savePage(t, "B", "#go\ntext")
+	savePage(t, "C", "no tags")
+
+	tests := []struct {
+		target  string
+		want    int
+		wantIn  []string
+		wantOut []string
+	}{
+		{"/tags", http.StatusOK, []string{`href="/tags/go">go</a> (2)`, `href="/tags/web">web</a> (1)`}, nil},
+		{"/tag/go", http.StatusOK, []string{`href="/view/A"`, `href="/view/B"`}, []string{`href="/view/C"`}},
+		{"/tags/GO", http.StatusOK, []string{`href="/view/A"`, `href="/view/B"`}, nil},
+		{"/tag/web", http.StatusOK, []string{`href="/view/A"`}, []string{`href="/view/B"`}},
+		{"/tag/missing", http.StatusNotFound, nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			w := serve(tagsHandler, http.MethodGet, tt.target, "")
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d", w.Code, tt.want)
+			}
+			for _, s := range tt.wantIn {
+				if !strings.Contains(w.Body.String(), s) {
+					t.Errorf("page has no %q:\n%s", s, w.Body)
+				}
+			}
+			for _, s := range tt.wantOut {
+				if strings.Contains(w.Body.String(), s) {
+					t.Errorf("page has %q:\n%s", s, w.Body)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"html/template"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// TemplateManager хранит разобранный набор шаблонов templateNames.
+// Набор заменяется целиком (Reload), поэтому обработчик, получивший его
+// через Templates, дорисовывает ответ тем набором, с которого начал.
+type TemplateManager struct {
+	mu sync.RWMutex
+	t  *template.Template
+}
+
+// Templates возвращает текущий набор шаблонов.
+func (m *TemplateManager) Templates() *template.Template {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.t
+}
+
+// Reload заново разбирает шаблоны с учетом темы. Если разбор не
+// удался, остается прежний набор.
+func (m *TemplateManager) Reload() error {
+	t, err := template.ParseFS(assets, templateFiles(templateNames)...)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	m.t = t
+	m.mu.Unlock()
+	return nil
+}
+
+// Watch перечитывает шаблоны при каждом изменении файла .html
+// в каталоге dir и его подкаталогах-темах. Ошибка в шаблоне только
+// пишется в лог: до исправления файла работает прежний набор.
+// Слежение прекращается вызовом Close у возвращенного значения.
+func (m *TemplateManager) Watch(dir string) (io.Closer, error) {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	dirs := []string{dir}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		w.Close()
+		return nil, err
+	}
+	for _, e := range entries {
+		if e.IsDir() {
+			dirs = append(dirs, filepath.Join(dir, e.Name()))
+		}
+	}
+	for _, d := range dirs {
+		if err := w.Add(d); err != nil {
+			w.Close()
+			return nil, err
+		}
+	}
+	go func() {
+		for {
+			select {
+			case ev, ok := <-w.Events:
+				if !ok {
+					return
+				}
+				// Редакторы часто сохраняют файл через переименование
+				// временного, поэтому важны не только события Write.
+				if filepath.Ext(ev.Name) != ".html" || ev.Op == fsnotify.Chmod {
+					continue
+				}
+				if err := m.Reload(); err != nil {
+					slog.Error("шаблоны не перечитаны", "file", ev.Name, "err", err)
+					continue
+				}
+				slog.Info("шаблоны перечитаны", "file", ev.Name)
+			case err, ok := <-w.Errors:
+				if !ok {
+					return
+				}
+				slog.Error("ошибка слежения за шаблонами", "err", err)
+			}
+		}
+	}()
+	return w, nil
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"html/template"
+	"io/fs"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Каждое имя из templateNames, которое передают в renderTemplate,
+// должно быть шаблоном в разобранном наборе.
+func TestTemplateNames(t *testing.T) {
+	set := templates.Templates()
+	for _, name := range templateNames {
+		if set.Lookup(name+".html") == nil {
+			t.Errorf("template %q is not defined", name+".html")
+		}
+	}
+}
+
+func benchmarkView() pageView {
+	p := &Page{Title: "Bench", Body: []byte("Some text for the benchmark page.")}
+	return pageView{Page: p, HTML: renderBody(p.Body, func(string) bool { return true })}
+}
+
+// BenchmarkRenderTemplate рисует view.html из набора, разобранного
+// при старте, как renderTemplate на каждом запросе.
+func BenchmarkRenderTemplate(b *testing.B) {
+	v := benchmarkView()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		renderTemplate(httptest.NewRecorder(), "view", v)
+	}
+}
+
+// BenchmarkRenderTemplateParse для сравнения разбирает шаблон
+// заново перед каждым выводом, как было до кэширования.
+func BenchmarkRenderTemplateParse(b *testing.B) {
+	v := benchmarkView()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		t, err := template.ParseFS(assets, "html/view.html")
+		if err != nil {
+			b.Fatal(err)
+		}
+		if err := t.Execute(httptest.NewRecorder(), v); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// Изменение файла шаблона на диске видно следующему запросу без
+// перезапуска сервера.
+func TestTemplateManagerWatch(t *testing.T) {
+	dir := t.TempDir()
+	err := fs.WalkDir(embeddedAssets, "html", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return os.MkdirAll(filepath.Join(dir, name), 0755)
+		}
+		data, err := fs.ReadFile(embeddedAssets, name)
+		if err != nil {
+			return err
+		}
+		return ioutil.WriteFile(filepath.Join(dir, name), data, 0644)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	useDiskAssets(dir)
+	t.Cleanup(func() {
+		assets = embeddedAssets
+		if err := templates.Reload(); err != nil {
+			t.Error(err)
+		}
+	})
+	if err := templates.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	watcher, err := templates.Watch(filepath.Join(dir, "html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer watcher.Close()
+
+	notFound := func() string {
+		w := httptest.NewRecorder()
+		notFoundHandler(w, httptest.NewRequest(http.MethodGet, "/missing", nil))
+		return w.Body.String()
+	}
+	const marker = "page is not here after reload"
+	if strings.Contains(notFound(), marker) {
+		t.Fatal("marker is in the template before the change")
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "html", "404.html"), []byte("<p>"+marker+"</p>"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for deadline := time.Now().Add(5 * time.Second); !strings.Contains(notFound(), marker); {
+		if time.Now().After(deadline) {
+			t.Fatalf("404 page did not change after writing the template:\n%s", notFound())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// Шаблоны и статические файлы встроены в бинарный файл: они
+// работают и там, где рядом нет каталогов html/ и static/.
+func TestTemplatesRenderFromEmbeddedFS(t *testing.T) {
+	t.Chdir(t.TempDir())
+	if assets != fs.FS(embeddedAssets) {
+		t.Fatal("assets are not the embedded files by default")
+	}
+	t.Cleanup(func() {
+		if err := templates.Reload(); err != nil {
+			t.Error(err)
+		}
+	})
+	if err := templates.Reload(); err != nil {
+		t.Fatalf("parsing embedded templates: %v", err)
+	}
+	w := httptest.NewRecorder()
+	renderTemplate(w, "view", benchmarkView())
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "<h1>Bench</h1>") || !strings.Contains(w.Body.String(), "Some text") {
+		t.Errorf("view from the embedded template: status %d\n%s", w.Code, w.Body)
+	}
+	if _, err := fs.ReadFile(assets, "static/style.css"); err != nil {
+		t.Errorf("embedded static file: %v", err)
+	}
+}
+
+// В режиме разработки шаблоны читаются с диска.
+func TestTemplatesRenderFromDisk(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "html"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range templateNames {
+		content := "<p>" + name + "</p>"
+		if name == "view" {
+			content = "<p>from disk: {{.Title}}</p>"
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, "html", name+".html"), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	useDiskAssets(dir)
+	t.Cleanup(func() {
+		assets = embeddedAssets
+		if err := templates.Reload(); err != nil {
+			t.Error(err)
+		}
+	})
+	if err := templates.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	renderTemplate(w, "view", benchmarkView())
+	if got := w.Body.String(); got != "<p>from disk: Bench</p>" {
+		t.Errorf("view = %q, want the template from disk", got)
+	}
+}
+
+// Тема заменяет только свои шаблоны, остальные берутся из html/.
+func TestThemes(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) {
+		t.Helper()
+		file := filepath.Join(dir, "html", name)
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range templateNames {
+		write(name+".html", "<p>default "+name+"</p>")
+	}
+	write("dark/view.html", "<p>dark: {{.Title}}</p>")
+	write("light/view.html", "<p>light: {{.Title}}</p>")
+	useDiskAssets(dir)
+	t.Cleanup(func() {
+		assets = embeddedAssets
+		if err := useTheme(""); err != nil {
+			t.Error(err)
+		}
+	})
+
+	tests := []struct {
+		theme, wantView, wantEdit string
+	}{
+		{"", "<p>default view</p>", "<p>default edit</p>"},
+		{"dark", "<p>dark: Bench</p>", "<p>default edit</p>"},
+		{"light", "<p>light: Bench</p>", "<p>default edit</p>"},
+	}
+	for _, tt := range tests {
+		if err := useTheme(tt.theme); err != nil {
+			t.Fatalf("useTheme(%q): %v", tt.theme, err)
+		}
+		for name, want := range map[string]string{"view": tt.wantView, "edit": tt.wantEdit} {
+			w := httptest.NewRecorder()
+			renderTemplate(w, name, benchmarkView())
+			if got := w.Body.String(); got != want {
+				t.Errorf("theme %q: %s = %q, want %q", tt.theme, name, got, want)
+			}
+		}
+	}
+
+	if err := useTheme("missing"); err == nil || !strings.Contains(err.Error(), "dark, light") {
+		t.Errorf("useTheme of an unknown theme: error = %v, want one listing dark, light", err)
+	}
+	if theme != "light" {
+		t.Errorf("theme = %q after a failed switch, want light", theme)
+	}
+}
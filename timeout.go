@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// timeoutWriter копит ответ обработчика, пока timeoutMiddleware не
+// решит, успел ли тот уложиться в срок. После истечения срока запись
+// возвращает http.ErrHandlerTimeout.
+type timeoutWriter struct {
+	h    http.Header
+	buf  bytes.Buffer
+	code int
+
+	mu       sync.Mutex
+	timedOut bool
+}
+
+func (tw *timeoutWriter) Header() http.Header { return tw.h }
+
+func (tw *timeoutWriter) WriteHeader(code int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut || tw.code != 0 {
+		return
+	}
+	tw.code = code
+}
+
+func (tw *timeoutWriter) Write(b []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	if tw.code == 0 {
+		tw.code = http.StatusOK
+	}
+	return tw.buf.Write(b)
+}
+
+// untimedPaths - пути потоковых ответов, которые timeoutMiddleware
+// пропускает без срока и без буфера (см. handleUntimed).
+var untimedPaths = make(map[string]bool)
+
+// handleUntimed регистрирует h для pattern так же, как http.Handle,
+// но освобождает запросы к этому пути от общего срока обработки:
+// потоковый ответ не должен копиться в памяти и обрываться по сроку.
+// Как и в http.ServeMux, pattern с "/" на конце задает все пути,
+// которые с него начинаются.
+func handleUntimed(pattern string, h http.Handler) {
+	untimedPaths[pattern] = true
+	http.Handle(pattern, h)
+}
+
+func isUntimed(path string) bool {
+	if untimedPaths[path] {
+		return true
+	}
+	for p := range untimedPaths {
+		if strings.HasSuffix(p, "/") && strings.HasPrefix(path, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// routeTimeout - срок обработки маршрутов, которые при большом объеме
+// данных считают долго (сравнение версий, предпросмотр, GraphQL):
+// такой запрос лучше оборвать раньше общего срока -timeout.
+const routeTimeout = 5 * time.Second
+
+// timeoutMiddleware ограничивает обработку запроса сроком d: контекст
+// запроса отменяется по истечении срока, а клиент получает 503 Service
+// Unavailable с Retry-After: 5. Вложенный timeoutMiddleware с меньшим d
+// задает отдельный срок для своего маршрута. Ответ копится в памяти,
+// поэтому потоковые маршруты регистрируются через handleUntimed.
+func timeoutMiddleware(d time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if isUntimed(r.URL.Path) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			ctx, cancel := context.WithTimeout(r.Context(), d)
+			defer cancel()
+			r = r.WithContext(ctx)
+
+			tw := &timeoutWriter{h: w.Header().Clone()}
+			done := make(chan struct{})
+			panicked := make(chan interface{}, 1)
+			go func() {
+				defer func() {
+					if p := recover(); p != nil {
+						panicked <- p
+					}
+				}()
+				next.ServeHTTP(tw, r)
+				close(done)
+			}()
+
+			select {
+			case p := <-panicked:
+				// Паника переносится в горутину запроса, где ее
+				// перехватит recoveryMiddleware.
+				panic(p)
+			case <-done:
+				tw.mu.Lock()
+				defer tw.mu.Unlock()
+				dst := w.Header()
+				for k, vv := range tw.h {
+					dst[k] = vv
+				}
+				if tw.code == 0 {
+					tw.code = http.StatusOK
+				}
+				w.WriteHeader(tw.code)
+				w.Write(tw.buf.Bytes())
+			case <-ctx.Done():
+				tw.mu.Lock()
+				defer tw.mu.Unlock()
+				tw.timedOut = true
+				// Если клиент сам закрыл соединение, отвечать некому.
+				if ctx.Err() == context.DeadlineExceeded {
+					w.Header().Set("Retry-After", "5")
+					http.Error(w, "Service Unavailable: request timed out", http.StatusServiceUnavailable)
+				}
+			}
+		})
+	}
+}
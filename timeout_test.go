@@ -0,0 +1,72 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// sleepHandler отвечает "done" через d, если запрос к тому времени
+// не отменен.
+func sleepHandler(d time.Duration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(d):
+			w.Header().Set("X-Handler", "done")
+			w.Write([]byte("done"))
+		case <-r.Context().Done():
+		}
+	})
+}
+
+func TestTimeoutMiddleware(t *testing.T) {
+	tests := []struct {
+		name     string
+		h        http.Handler
+		path     string
+		want     int
+		wantBody string
+	}{
+		{"fast handler", timeoutMiddleware(time.Second)(sleepHandler(0)), "/", http.StatusOK, "done"},
+		{"slow handler", timeoutMiddleware(50 * time.Millisecond)(sleepHandler(time.Second)), "/", http.StatusServiceUnavailable, ""},
+		{
+			name: "route override is shorter than the global timeout",
+			h:    timeoutMiddleware(time.Minute)(timeoutMiddleware(50 * time.Millisecond)(sleepHandler(time.Second))),
+			path: "/",
+			want: http.StatusServiceUnavailable,
+		},
+		{
+			name:     "route override does not cut a fast handler",
+			h:        timeoutMiddleware(time.Minute)(timeoutMiddleware(time.Second)(sleepHandler(10 * time.Millisecond))),
+			path:     "/",
+			want:     http.StatusOK,
+			wantBody: "done",
+		},
+		{"untimed route", timeoutMiddleware(50 * time.Millisecond)(sleepHandler(100 * time.Millisecond)), "/untimed-test/stream", http.StatusOK, "done"},
+	}
+	untimedPaths["/untimed-test/"] = true
+	t.Cleanup(func() { delete(untimedPaths, "/untimed-test/") })
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			start := time.Now()
+			tt.h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d", w.Code, tt.want)
+			}
+			if tt.want == http.StatusServiceUnavailable {
+				if got := w.Header().Get("Retry-After"); got != "5" {
+					t.Errorf("Retry-After = %q, want 5", got)
+				}
+				if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+					t.Errorf("timed out after %v, want about 50ms", elapsed)
+				}
+				return
+			}
+			if w.Body.String() != tt.wantBody || w.Header().Get("X-Handler") != "done" {
+				t.Errorf("response = %q with headers %v, want the handler's own", w.Body, w.Header())
+			}
+		})
+	}
+}
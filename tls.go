@@ -0,0 +1,107 @@
+package main
+
+import (
+	"crypto/tls"
+	"log"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// redirectToHTTPS перенаправляет запрос на тот же URL по HTTPS.
+// Порт из Host отбрасывается: HTTPS всегда слушает стандартный 443.
+func redirectToHTTPS(w http.ResponseWriter, r *http.Request) {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+		// IPv6-адрес без порта в URL все равно пишется в скобках.
+		if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+	}
+	http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+}
+
+// acmeManager настраивает получение и продление сертификатов Let's
+// Encrypt только для доменов из списка; сертификаты хранятся в cacheDir.
+func acmeManager(domains []string, cacheDir string) *autocert.Manager {
+	return &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		HostPolicy: autocert.HostWhitelist(domains...),
+		Cache:      autocert.DirCache(cacheDir),
+	}
+}
+
+// ServerTimeouts - сроки соединения для всех серверов listenAndServe:
+// на чтение запроса, на запись ответа и на простой keep-alive
+// соединения между запросами. Ноль - без срока. Write должен быть
+// больше срока обработки timeoutMiddleware, иначе ответ 503
+// не успеет уйти клиенту.
+type ServerTimeouts struct {
+	Read  time.Duration
+	Write time.Duration
+	Idle  time.Duration
+}
+
+func (t ServerTimeouts) server(addr string, h http.Handler) *http.Server {
+	return &http.Server{
+		Addr:         addr,
+		Handler:      h,
+		ReadTimeout:  t.Read,
+		WriteTimeout: t.Write,
+		IdleTimeout:  t.Idle,
+		ConnContext:  pushConnContext,
+	}
+}
+
+// listenAndServe запускает сервер в одном из трех режимов:
+//   - WEB_TLS_ACME_DOMAIN (домены через запятую) - HTTPS с сертификатами
+//     Let's Encrypt, которые сохраняются в WEB_TLS_CACHE_DIR;
+//   - cert и key (флаги -cert и -key или WEB_TLS_CERT и WEB_TLS_KEY) -
+//     HTTPS с сертификатом из PEM-файлов;
+//   - иначе - обычный HTTP на адресе addr (флаг -addr, по умолчанию :8080).
+//
+// В режимах HTTPS порт 80 только перенаправляет на HTTPS. Если задан
+// только один из cert и key или сертификат не загружается, сервер
+// останавливается, а не начинает молча работать по HTTP.
+func listenAndServe(h http.Handler, addr, cert, key string, timeouts ServerTimeouts) error {
+	if domains := splitList(os.Getenv("WEB_TLS_ACME_DOMAIN")); len(domains) > 0 {
+		cacheDir := os.Getenv("WEB_TLS_CACHE_DIR")
+		if cacheDir == "" {
+			cacheDir = "certs"
+		}
+		m := acmeManager(domains, cacheDir)
+		// Порт 80 нужен еще и для проверки домена по HTTP-01.
+		go func() {
+			log.Fatal(timeouts.server(":80", m.HTTPHandler(http.HandlerFunc(redirectToHTTPS))).ListenAndServe())
+		}()
+		srv := timeouts.server(":443", h)
+		srv.TLSConfig = m.TLSConfig()
+		slog.Info("Режим HTTPS (Let's Encrypt): запуск сервера", "url", "https://"+domains[0])
+		return srv.ListenAndServeTLS("", "")
+	}
+	if (cert == "") != (key == "") {
+		log.Fatal("для HTTPS нужно задать и сертификат (-cert), и ключ (-key)")
+	}
+	if cert != "" {
+		// Сертификат проверяется заранее, чтобы ошибка была видна
+		// при старте с понятным сообщением.
+		if _, err := tls.LoadX509KeyPair(cert, key); err != nil {
+			log.Fatalf("не удалось загрузить сертификат TLS %s / %s: %v", cert, key, err)
+		}
+		go func() {
+			log.Fatal(timeouts.server(":80", http.HandlerFunc(redirectToHTTPS)).ListenAndServe())
+		}()
+		srv := timeouts.server(":443", h)
+		slog.Info("Режим HTTPS: запуск сервера", "url", "https://127.0.0.1")
+		return srv.ListenAndServeTLS(cert, key)
+	}
+	srv := timeouts.server(addr, h)
+	slog.Info("Режим HTTP: запуск сервера", "addr", addr)
+	return srv.ListenAndServe()
+}
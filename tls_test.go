@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRedirectToHTTPS(t *testing.T) {
+	tests := []struct {
+		host, target, want string
+	}{
+		{"example.com", "/", "https://example.com/"},
+		{"example.com:80", "/view/Foo?theme=dark", "https://example.com/view/Foo?theme=dark"},
+		{"example.com:8080", "/view/%D0%AF", "https://example.com/view/%D0%AF"},
+		{"[2001:db8::1]:80", "/tags", "https://[2001:db8::1]/tags"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, tt.target, nil)
+		r.Host = tt.host
+		w := httptest.NewRecorder()
+		redirectToHTTPS(w, r)
+		if w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != tt.want {
+			t.Errorf("%s%s: %d to %q, want 301 to %q", tt.host, tt.target, w.Code, w.Header().Get("Location"), tt.want)
+		}
+	}
+}
+
+func TestACMEHostPolicy(t *testing.T) {
+	m := acmeManager([]string{"wiki.example.com", "www.example.com"}, t.TempDir())
+	for host, allowed := range map[string]bool{
+		"wiki.example.com":  true,
+		"www.example.com":   true,
+		"example.com":       false,
+		"evil.example.com":  false,
+		"wiki.example.com.": false,
+	} {
+		err := m.HostPolicy(context.Background(), host)
+		if (err == nil) != allowed {
+			t.Errorf("HostPolicy(%s) = %v, want allowed %v", host, err, allowed)
+		}
+	}
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TrashEntry - одна удаленная страница в корзине. Version - время
+// удаления в секундах Unix, оно же входит в имя файла.
+type TrashEntry struct {
+	Title   string    `json:"title"`
+	Version int64     `json:"version"`
+	Deleted time.Time `json:"deleted_at"`
+}
+
+// TrashStore - корзина удаленных страниц в каталоге Dir. Страница Foo,
+// удаленная в момент 1700000000, лежит там в файле Foo.1700000000.txt,
+// так что одну страницу можно удалить и восстановить несколько раз.
+// Pages - каталог файлов страниц (пустой - текущий каталог).
+type TrashStore struct {
+	Dir   string
+	Pages string
+}
+
+var errPageExists = errors.New("page already exists")
+
+// trash - корзина, в которую FileStorage.Delete перемещает страницы.
+var trash = &TrashStore{Dir: "trash"}
+
+// trashMaxAge - сколько страница лежит в корзине до окончательного
+// удаления (флаг -trashmaxage). Ноль - хранить всегда.
+var trashMaxAge time.Duration
+
+func (t *TrashStore) pagePath(title string) string {
+	return filepath.Join(t.Pages, title+".txt")
+}
+
+func (t *TrashStore) path(title string, version int64) string {
+	return filepath.Join(t.Dir, fmt.Sprintf("%s.%d.txt", title, version))
+}
+
+// Put перемещает файл страницы title в корзину и возвращает версию
+// удаленной копии. Каталог корзины создается при необходимости.
+func (t *TrashStore) Put(title string) (int64, error) {
+	if err := os.MkdirAll(t.Dir, 0700); err != nil {
+		return 0, err
+	}
+	version := time.Now().Unix()
+	// Если в ту же секунду страницу уже удаляли, берем следующий номер.
+	for ; ; version++ {
+		_, err := os.Stat(t.path(title, version))
+		if err == nil {
+			continue
+		}
+		if os.IsNotExist(err) {
+			break
+		}
+		return 0, err
+	}
+	return version, os.Rename(t.pagePath(title), t.path(title, version))
+}
+
+// List возвращает содержимое корзины, начиная с недавно удаленных.
+// Если корзины еще нет, список пуст.
+func (t *TrashStore) List() ([]TrashEntry, error) {
+	files, err := ioutil.ReadDir(t.Dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var list []TrashEntry
+	for _, f := range files {
+		parts := strings.Split(normalizeTitle(f.Name()), ".")
+		if len(parts) != 3 || parts[2] != "txt" || !validTitle.MatchString(parts[0]) {
+			continue
+		}
+		version, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		list = append(list, TrashEntry{Title: parts[0], Version: version, Deleted: time.Unix(version, 0)})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Version > list[j].Version })
+	return list, nil
+}
+
+// find возвращает версию удаленной страницы title; version 0 означает
+// самую свежую. Если такой копии нет, возвращается os.ErrNotExist.
+func (t *TrashStore) find(title string, version int64) (int64, error) {
+	list, err := t.List()
+	if err != nil {
+		return 0, err
+	}
+	for _, e := range list {
+		if e.Title == title && (version == 0 || e.Version == version) {
+			return e.Version, nil
+		}
+	}
+	return 0, fmt.Errorf("trashed page %q: %w", title, os.ErrNotExist)
+}
+
+// Load читает удаленную копию страницы title; version 0 означает
+// самую свежую. Возвращается и версия прочитанной копии.
+func (t *TrashStore) Load(title string, version int64) (*Page, int64, error) {
+	version, err := t.find(title, version)
+	if err != nil {
+		return nil, 0, err
+	}
+	p, err := loadPage(t.path(title, version), title)
+	return p, version, err
+}
+
+// restorePage возвращает удаленную копию страницы на место от имени
+// editor. Страница сохраняется через store, как любая правка, так что
+// кэш, /events, метаданные и резервные копии узнают о ней; копия из
+// корзины удаляется только после сохранения. Если страница с таким
+// заголовком уже существует, возвращается errPageExists: хранилище
+// проверяет это под блокировкой страницы вместе с записью (Page.Create),
+// так что страница, сохраненная во время восстановления, не затирается.
+func restorePage(title string, version int64, editor string) (*Page, error) {
+	var p *Page
+	// Восстановления одной страницы из корзины идут по очереди, чтобы
+	// одну копию не прочитали и не удалили дважды.
+	err := withPageLock("trash/"+title, func() error {
+		var err error
+		if p, version, err = trash.Load(title, version); err != nil {
+			return err
+		}
+		p.LastEditor, p.Create = editor, true
+		if err := store.Save(p); err != nil {
+			return err
+		}
+		return trash.Remove(title, version)
+	})
+	return p, err
+}
+
+// Remove окончательно удаляет копию страницы из корзины.
+func (t *TrashStore) Remove(title string, version int64) error {
+	version, err := t.find(title, version)
+	if err != nil {
+		return err
+	}
+	return os.Remove(t.path(title, version))
+}
+
+// Purge окончательно удаляет из корзины копии, удаленные раньше before,
+// и возвращает их число.
+func (t *TrashStore) Purge(before time.Time) (int, error) {
+	list, err := t.List()
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, e := range list {
+		if !e.Deleted.Before(before) {
+			continue
+		}
+		if err := os.Remove(t.path(e.Title, e.Version)); err != nil && !os.IsNotExist(err) {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// purgeTrash при запуске и затем раз в interval удаляет из корзины
+// страницы старше maxAge (флаг -trashmaxage). Его запускает main
+// в отдельной горутине, если maxAge задан.
+func purgeTrash(maxAge, interval time.Duration) {
+	purge := func(now time.Time) {
+		n, err := trash.Purge(now.Add(-maxAge))
+		if err != nil {
+			slog.Error("не удалось очистить корзину", "err", err)
+			return
+		}
+		if n > 0 {
+			slog.Info("из корзины удалены старые страницы", "count", n, "max_age", maxAge.String())
+		}
+	}
+	purge(time.Now())
+	for now := range time.Tick(interval) {
+		purge(now)
+	}
+}
+
+// trashHandler показывает на /trash удаленные страницы с кнопками
+// восстановления.
+func trashHandler(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet, http.MethodHead) {
+		return
+	}
+	list, err := trash.List()
+	if err != nil {
+		errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	renderTemplate(w, "trash", struct {
+		Entries   []TrashEntry
+		CSRFToken string
+		MaxAge    time.Duration
+	}{list, csrfToken(r), trashMaxAge})
+}
+
+var restorePath = regexp.MustCompile(`^/restore/(` + titleChars + `)$`)
+
+// restoreHandler восстанавливает страницу из корзины: POST
+// /restore/{title} с полем version (без него - последняя удаленная
+// копия), как POST /api/v1/trash/{title}/restore для формы /trash.
+func restoreHandler(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodPost) {
+		return
+	}
+	m := restorePath.FindStringSubmatch(r.URL.Path)
+	if m == nil {
+		notFoundHandler(w, r)
+		return
+	}
+	title := normalizeTitle(m[1])
+	var version int64
+	if v := r.FormValue("version"); v != "" {
+		var err error
+		if version, err = strconv.ParseInt(v, 10, 64); err != nil {
+			errorHandler(w, r, http.StatusBadRequest, "Invalid version")
+			return
+		}
+	}
+	_, err := restorePage(title, version, editorName(r))
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		notFoundHandler(w, r)
+	case err == errPageExists:
+		errorHandler(w, r, http.StatusConflict, "A page with this title already exists. Rename or delete it first.")
+	case err != nil:
+		errorHandler(w, r, http.StatusInternalServerError, err.Error())
+	default:
+		audit(r, auditRestore, title)
+		http.Redirect(w, r, "/view/"+title, http.StatusFound)
+	}
+}
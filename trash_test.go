@@ -0,0 +1,74 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// postForm отправляет h форму values методом POST на target.
+func postForm(h http.HandlerFunc, target string, values url.Values) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, target, strings.NewReader(values.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	h(w, r)
+	return w
+}
+
+func TestDeleteAndRestoreForms(t *testing.T) {
+	tests := []struct {
+		name     string
+		path     string
+		version  string
+		recreate bool // после удаления страница снова сохранена
+		want     int
+		wantBody string // текст Foo после восстановления
+	}{
+		{"restore", "/restore/Foo", "", false, http.StatusFound, "hello"},
+		{"existing page", "/restore/Foo", "", true, http.StatusConflict, "recreated"},
+		{"nothing in trash", "/restore/Other", "", false, http.StatusNotFound, ""},
+		{"unknown version", "/restore/Foo", "1", false, http.StatusNotFound, ""},
+		{"invalid version", "/restore/Foo", "latest", false, http.StatusBadRequest, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testDataDir(t)
+			savePage(t, "Foo", "hello")
+			if w := postForm(makeHandler(deleteHandler), "/delete/Foo", nil); w.Code != http.StatusFound {
+				t.Fatalf("delete status = %d, want 302", w.Code)
+			}
+			if _, err := store.Load("Foo"); err == nil {
+				t.Fatal("page still exists after delete")
+			}
+			if tt.recreate {
+				savePage(t, "Foo", "recreated")
+			}
+
+			values := url.Values{}
+			if tt.version != "" {
+				values.Set("version", tt.version)
+			}
+			w := postForm(restoreHandler, tt.path, values)
+			if w.Code != tt.want {
+				t.Fatalf("restore status = %d, want %d", w.Code, tt.want)
+			}
+			if tt.want == http.StatusFound && w.Header().Get("Location") != "/view/Foo" {
+				t.Errorf("Location = %q, want /view/Foo", w.Header().Get("Location"))
+			}
+			if tt.wantBody != "" {
+				if p, err := store.Load("Foo"); err != nil || string(p.Body) != tt.wantBody {
+					t.Errorf("page after restore = %v, %v; want body %q", p, err, tt.wantBody)
+				}
+			}
+			list, err := trash.List()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if wantTrashed := tt.want != http.StatusFound; (len(list) == 1) != wantTrashed {
+				t.Errorf("trash after restore = %v, want the copy kept %v", list, wantTrashed)
+			}
+		})
+	}
+}
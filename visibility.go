@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"regexp"
+)
+
+// canRead сообщает, может ли автор запроса r читать страницу title:
+// открытые страницы видны всем, закрытые - только вошедшим
+// редакторам (isEditor). Пользователя в контекст кладет
+// identify-middleware (identifyMiddleware).
+func canRead(r *http.Request, title string) (bool, error) {
+	if isEditor(userFromContext(r.Context())) {
+		return true, nil
+	}
+	m, err := metas.Load(title)
+	if err != nil {
+		return false, err
+	}
+	return m.Public, nil
+}
+
+// visibleTitles оставляет из titles только страницы, которые
+// может читать автор запроса r.
+func visibleTitles(r *http.Request, titles []string) ([]string, error) {
+	if isEditor(userFromContext(r.Context())) {
+		return titles, nil
+	}
+	var out []string
+	for _, t := range titles {
+		ok, err := canRead(r, t)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			out = append(out, t)
+		}
+	}
+	return out, nil
+}
+
+// requireLogin отправляет браузер на страницу входа, когда
+// закрытую страницу открывает анонимный пользователь.
+func requireLogin(w http.ResponseWriter, r *http.Request) {
+	http.Redirect(w, r, "/login", http.StatusFound)
+}
+
+var apiVisibilityPath = regexp.MustCompile(`^/api/v1/pages/(` + titleChars + `)/visibility$`)
+
+// apiVisibilityHandler открывает или закрывает страницу:
+// PATCH /api/v1/pages/{title}/visibility с телом {"public":false}.
+func apiVisibilityHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPatch {
+		w.Header().Set("Allow", "PATCH")
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	m := apiVisibilityPath.FindStringSubmatch(r.URL.Path)
+	var req struct {
+		Public *bool `json:"public"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "malformed JSON: "+err.Error())
+		return
+	}
+	if req.Public == nil {
+		writeJSONError(w, http.StatusBadRequest, `missing "public"`)
+		return
+	}
+	_, err := store.Load(m[1])
+	if errors.Is(err, os.ErrNotExist) {
+		writeJSONError(w, http.StatusNotFound, "page not found")
+		return
+	}
+	if err == nil {
+		err = metas.Update(m[1], func(meta *PageMeta) { meta.Public = *req.Public })
+	}
+	if err != nil {
+		serverError(w, err)
+		return
+	}
+	audit(r, auditVisibility, m[1])
+	writeJSON(w, http.StatusOK, map[string]interface{}{"title": m[1], "public": *req.Public})
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPrivatePageAccess(t *testing.T) {
+	testDataDir(t)
+	tagIndexCache.Invalidate()
+	t.Cleanup(tagIndexCache.Invalidate)
+	savePage(t, "Open", "open text")
+	savePage(t, "Secret", "secret text")
+	if w := serveAs(http.HandlerFunc(apiVisibilityHandler), "bob", http.MethodPatch, "/api/v1/pages/Secret/visibility", `{"public":false}`); w.Code != http.StatusOK {
+		t.Fatalf("PATCH visibility: status = %d: %s", w.Code, w.Body)
+	}
+
+	view := makeHandler(pageResourceHandler)
+	tests := []struct {
+		name    string
+		h       http.HandlerFunc
+		target  string
+		user    *User
+		want    int
+		wantLoc string
+	}{
+		{"api anonymous", apiGetPage, "/api/v1/pages/Secret", nil, http.StatusUnauthorized, ""},
+		{"api logged in", apiGetPage, "/api/v1/pages/Secret", &User{Username: "bob"}, http.StatusOK, ""},
+		{"api reader", apiGetPage, "/api/v1/pages/Secret", &User{Username: "rita", Role: roleReader}, http.StatusUnauthorized, ""},
+		{"api public page", apiGetPage, "/api/v1/pages/Open", nil, http.StatusOK, ""},
+		{"view anonymous", view, "/view/Secret", nil, http.StatusFound, "/login"},
+		{"view logged in", view, "/view/Secret", &User{Username: "bob"}, http.StatusOK, ""},
+		{"view public page", view, "/view/Open", nil, http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			if tt.user != nil {
+				r = r.WithContext(context.WithValue(r.Context(), userContextKey, tt.user))
+			}
+			w := httptest.NewRecorder()
+			tt.h(w, r)
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d", w.Code, tt.want)
+			}
+			if loc := w.Header().Get("Location"); loc != tt.wantLoc {
+				t.Errorf("Location = %q, want %q", loc, tt.wantLoc)
+			}
+			if tt.want == http.StatusOK && strings.Contains(tt.target, "Secret") && !strings.Contains(w.Body.String(), "secret text") {
+				t.Errorf("body has no page text:\n%s", w.Body)
+			}
+		})
+	}
+
+	// Список страниц на / скрывает закрытые от анонимных пользователей.
+	index := serve(handler, http.MethodGet, "/", "").Body.String()
+	if !strings.Contains(index, "/view/Open") || strings.Contains(index, "/view/Secret") {
+		t.Errorf("anonymous index lists the wrong pages:\n%s", index)
+	}
+	index = serveAs(http.HandlerFunc(handler), "bob", http.MethodGet, "/", "").Body.String()
+	if !strings.Contains(index, "/view/Secret") {
+		t.Errorf("index of a logged-in editor has no private page:\n%s", index)
+	}
+
+	// Страницу можно снова открыть.
+	serveAs(http.HandlerFunc(apiVisibilityHandler), "bob", http.MethodPatch, "/api/v1/pages/Secret/visibility", `{"public":true}`)
+	if w := serve(apiGetPage, http.MethodGet, "/api/v1/pages/Secret", ""); w.Code != http.StatusOK {
+		t.Errorf("GET after making the page public: status = %d, want 200", w.Code)
+	}
+}
+
+func TestVisibilityRequests(t *testing.T) {
+	testDataDir(t)
+	savePage(t, "Foo", "foo")
+	tests := []struct {
+		name, method, target, body string
+		want                       int
+	}{
+		{"missing field", http.MethodPatch, "/api/v1/pages/Foo/visibility", `{}`, http.StatusBadRequest},
+		{"malformed", http.MethodPatch, "/api/v1/pages/Foo/visibility", `{`, http.StatusBadRequest},
+		{"missing page", http.MethodPatch, "/api/v1/pages/Missing/visibility", `{"public":false}`, http.StatusNotFound},
+		{"wrong method", http.MethodPost, "/api/v1/pages/Foo/visibility", `{"public":false}`, http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := serve(apiVisibilityHandler, tt.method, tt.target, tt.body); w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
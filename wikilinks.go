@@ -0,0 +1,37 @@
+package main
+
+import (
+	"html/template"
+	"net/url"
+	"regexp"
+)
+
+// wikiLink - ссылка вида [[Title]] в тексте страницы.
+var wikiLink = regexp.MustCompile(`\[\[([^\[\]]+)\]\]`)
+
+// renderBody превращает текст страницы в HTML для просмотра: текст
+// экранируется, а каждая ссылка [[Title]] с допустимым заголовком
+// становится ссылкой на /view/Title. Ссылки на страницы, для которых
+// exists возвращает false, получают класс wikilink-missing. Скобки
+// с недопустимым заголовком остаются в тексте как есть.
+func renderBody(body []byte, exists func(title string) bool) template.HTML {
+	escaped := template.HTMLEscapeString(string(body))
+	html := wikiLink.ReplaceAllStringFunc(escaped, func(m string) string {
+		title := wikiLink.FindStringSubmatch(m)[1]
+		if validateTitle(title) != nil {
+			return m
+		}
+		class := "wikilink"
+		if !exists(title) {
+			class = "wikilink wikilink-missing"
+		}
+		return `<a class="` + class + `" href="/view/` + url.PathEscape(title) + `">` + title + `</a>`
+	})
+	return template.HTML(html)
+}
+
+// pageExists сообщает, есть ли в хранилище страница title.
+func pageExists(title string) bool {
+	_, err := store.Load(title)
+	return err == nil
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRenderBody(t *testing.T) {
+	exists := func(title string) bool { return title == "Foo" || title == "Главная" }
+	tests := []struct {
+		name, body, want string
+	}{
+		{"existing page", "see [[Foo]]", `see <a class="wikilink" href="/view/Foo">Foo</a>`},
+		{"missing page", "see [[Bar]]", `see <a class="wikilink wikilink-missing" href="/view/Bar">Bar</a>`},
+		{"cyrillic title", "[[Главная]]", `<a class="wikilink" href="/view/%D0%93%D0%BB%D0%B0%D0%B2%D0%BD%D0%B0%D1%8F">Главная</a>`},
+		{"several links", "[[Foo]] [[Bar]]", `<a class="wikilink" href="/view/Foo">Foo</a> <a class="wikilink wikilink-missing" href="/view/Bar">Bar</a>`},
+		{"invalid title stays text", "[[../etc]] [[a b]]", "[[../etc]] [[a b]]"},
+		{"markup is escaped", "<b>[[Foo]]</b>", `&lt;b&gt;<a class="wikilink" href="/view/Foo">Foo</a>&lt;/b&gt;`},
+		{"script in brackets", "[[<script>]]", "[[&lt;script&gt;]]"},
+		{"unclosed", "[[Foo", "[[Foo"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(renderBody([]byte(tt.body), exists)); got != tt.want {
+				t.Errorf("renderBody(%q) =\n%s\nwant\n%s", tt.body, got, tt.want)
+			}
+		})
+	}
+}
+
+// /view/ отмечает ссылки на несуществующие страницы.
+func TestViewWikiLinks(t *testing.T) {
+	testDataDir(t)
+	savePage(t, "Foo", "see [[Bar]] and [[Missing]]")
+	savePage(t, "Bar", "bar")
+	w := httptest.NewRecorder()
+	makeHandler(pageResourceHandler)(w, httptest.NewRequest(http.MethodGet, "/view/Foo", nil))
+	for _, want := range []string{
+		`<a class="wikilink" href="/view/Bar">Bar</a>`,
+		`<a class="wikilink wikilink-missing" href="/view/Missing">Missing</a>`,
+	} {
+		if !strings.Contains(w.Body.String(), want) {
+			t.Errorf("view has no %s:\n%s", want, w.Body)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"net/http"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+var wsPreviewPath = regexp.MustCompile(`^/ws/preview/(` + titleChars + `)$`)
+
+// wsWriteTimeout - сколько ждать отправки одного кадра клиенту.
+const wsWriteTimeout = 10 * time.Second
+
+// previewUpgrader по умолчанию отклоняет запросы с чужим Origin,
+// так что чужой сайт не откроет соединение от имени пользователя.
+var previewUpgrader = websocket.Upgrader{}
+
+// presenceFrame сообщает, где курсор пользователя User в тексте
+// страницы. Left - пользователь закрыл редактор.
+type presenceFrame struct {
+	User   string `json:"user"`
+	Cursor int    `json:"cursor"`
+	Left   bool   `json:"left,omitempty"`
+}
+
+// previewClient - одно соединение /ws/preview/. Кадры в него пишут
+// и его читатель, и рассылка присутствия, поэтому запись под mu.
+type previewClient struct {
+	user string
+	conn *websocket.Conn
+
+	mu sync.Mutex
+}
+
+func (c *previewClient) send(v interface{}) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	return c.conn.WriteJSON(v)
+}
+
+// PreviewHub - кто сейчас редактирует какую страницу.
+type PreviewHub struct {
+	mu    sync.Mutex
+	rooms map[string]map[*previewClient]bool
+}
+
+var previews = &PreviewHub{rooms: make(map[string]map[*previewClient]bool)}
+
+func (h *PreviewHub) join(title string, c *previewClient) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.rooms[title] == nil {
+		h.rooms[title] = make(map[*previewClient]bool)
+	}
+	h.rooms[title][c] = true
+}
+
+func (h *PreviewHub) leave(title string, c *previewClient) {
+	h.mu.Lock()
+	delete(h.rooms[title], c)
+	if len(h.rooms[title]) == 0 {
+		delete(h.rooms, title)
+	}
+	h.mu.Unlock()
+	h.broadcast(title, presenceFrame{User: c.user, Left: true})
+}
+
+// broadcast отправляет f всем, кто редактирует title. Клиент, которому
+// не удалось отправить кадр, отключится сам, когда его чтение
+// завершится ошибкой.
+func (h *PreviewHub) broadcast(title string, f presenceFrame) {
+	h.mu.Lock()
+	clients := make([]*previewClient, 0, len(h.rooms[title]))
+	for c := range h.rooms[title] {
+		clients = append(clients, c)
+	}
+	h.mu.Unlock()
+	for _, c := range clients {
+		c.send(f)
+	}
+}
+
+// wsPreviewHandler - живой предпросмотр в редакторе: GET
+// /ws/preview/{title} переходит на WebSocket. Клиент присылает кадры
+// {"body":"..."} с текстом из формы и получает в ответ {"html":"..."},
+// как от POST /preview, а кадры {"cursor":N} рассылаются всем
+// редакторам этой страницы как {"user":"...","cursor":N}.
+func wsPreviewHandler(w http.ResponseWriter, r *http.Request) {
+	m := wsPreviewPath.FindStringSubmatch(r.URL.Path)
+	if m == nil {
+		http.NotFound(w, r)
+		return
+	}
+	if !websocket.IsWebSocketUpgrade(r) {
+		http.Error(w, "Bad Request: WebSocket upgrade required", http.StatusBadRequest)
+		return
+	}
+	// Upgrade сам отвечает клиенту, если переход не удался.
+	conn, err := previewUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	conn.SetReadLimit(2 * maxPageSize)
+
+	title := m[1]
+	c := &previewClient{user: userFromContext(r.Context()).Username, conn: conn}
+	previews.join(title, c)
+	defer previews.leave(title, c)
+	for {
+		var msg struct {
+			Body   *string `json:"body"`
+			Cursor *int    `json:"cursor"`
+		}
+		if err := conn.ReadJSON(&msg); err != nil {
+			return
+		}
+		if msg.Body != nil {
+			if err := c.send(map[string]string{"html": string(previewHTML([]byte(*msg.Body)))}); err != nil {
+				return
+			}
+		}
+		if msg.Cursor != nil {
+			previews.broadcast(title, presenceFrame{User: c.user, Cursor: *msg.Cursor})
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// dialPreview открывает /ws/preview/{title} от имени user и ждет,
+// пока сервер начнет читать кадры соединения.
+func dialPreview(t *testing.T, srv *httptest.Server, title, user string) *websocket.Conn {
+	t.Helper()
+	u := "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws/preview/" + title + "?user=" + user
+	conn, _, err := websocket.DefaultDialer.Dial(u, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	if err := conn.WriteJSON(map[string]string{"body": ""}); err != nil {
+		t.Fatal(err)
+	}
+	var reply map[string]string
+	readFrame(t, conn, &reply)
+	return conn
+}
+
+func readFrame(t *testing.T, conn *websocket.Conn, v interface{}) {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if err := conn.ReadJSON(v); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWSPreview(t *testing.T) {
+	testDataDir(t)
+	savePage(t, "Foo", "foo")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := &User{Username: r.URL.Query().Get("user")}
+		wsPreviewHandler(w, r.WithContext(context.WithValue(r.Context(), userContextKey, user)))
+	}))
+	defer srv.Close()
+	alice := dialPreview(t, srv, "Page", "alice")
+	bob := dialPreview(t, srv, "Page", "bob")
+	other := dialPreview(t, srv, "Other", "carol")
+
+	// Текст отрисовывается так же, как в POST /preview.
+	if err := alice.WriteJSON(map[string]string{"body": "see [[Foo]] <b>"}); err != nil {
+		t.Fatal(err)
+	}
+	var reply map[string]string
+	readFrame(t, alice, &reply)
+	if want := string(previewHTML([]byte("see [[Foo]] <b>"))); reply["html"] != want {
+		t.Errorf("html = %q, want %q", reply["html"], want)
+	}
+
+	// Курсор получают все редакторы страницы, включая автора.
+	if err := alice.WriteJSON(map[string]int{"cursor": 42}); err != nil {
+		t.Fatal(err)
+	}
+	for name, conn := range map[string]*websocket.Conn{"alice": alice, "bob": bob} {
+		var f presenceFrame
+		readFrame(t, conn, &f)
+		if f != (presenceFrame{User: "alice", Cursor: 42}) {
+			t.Errorf("%s got presence %+v, want alice at 42", name, f)
+		}
+	}
+	// Редактор другой страницы этих кадров не получает.
+	other.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	if _, data, err := other.ReadMessage(); err == nil {
+		t.Errorf("editor of another page got %s", data)
+	}
+
+	// Закрытие соединения убирает пользователя и сообщает об этом
+	// остальным.
+	bob.Close()
+	var f presenceFrame
+	readFrame(t, alice, &f)
+	if f != (presenceFrame{User: "bob", Left: true}) {
+		t.Errorf("presence after bob left = %+v, want bob left", f)
+	}
+	previews.mu.Lock()
+	n := len(previews.rooms["Page"])
+	previews.mu.Unlock()
+	if n != 1 {
+		t.Errorf("%d editors of Page after bob left, want 1", n)
+	}
+}
+
+func TestWSPreviewRequiresUpgrade(t *testing.T) {
+	w := httptest.NewRecorder()
+	wsPreviewHandler(w, httptest.NewRequest(http.MethodGet, "/ws/preview/Foo", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("plain GET: status = %d, want 400", w.Code)
+	}
+}